@@ -2,12 +2,22 @@ package cron
 
 import (
 	"context"
+	"sync/atomic"
+	"time"
 
+	"github.com/adampresley/adamgokit/metrics"
 	cronv3 "github.com/robfig/cron/v3"
 )
 
 var internalCron *cronv3.Cron
 
+var jobMetrics atomic.Pointer[cronMetrics]
+
+type cronMetrics struct {
+	duration *metrics.Histogram
+	runs     *metrics.Counter
+}
+
 func init() {
 	internalCron = cronv3.New()
 }
@@ -17,7 +27,42 @@ Add adds a function to run on a schedule. The schedule is defined by the
 standard cron syntax. See https://crontab.guru
 */
 func Add(schedule string, cronFunc func()) {
-	internalCron.AddFunc(schedule, cronFunc)
+	internalCron.AddFunc(schedule, func() {
+		m := jobMetrics.Load()
+
+		if m == nil {
+			cronFunc()
+			return
+		}
+
+		start := time.Now()
+		defer func() {
+			m.runs.Inc(schedule)
+			m.duration.ObserveDuration(start, schedule)
+		}()
+
+		cronFunc()
+	})
+}
+
+/*
+RegisterMetrics registers "cron_job_runs_total" and "cron_job_duration_seconds"
+metrics, labelled by schedule, and records every job run from then on.
+*/
+func RegisterMetrics(registry *metrics.Registry) {
+	jobMetrics.Store(&cronMetrics{
+		duration: registry.NewHistogram(
+			"cron_job_duration_seconds",
+			"Duration of cron job runs in seconds.",
+			[]float64{.01, .1, .5, 1, 5, 10, 30, 60, 300},
+			"schedule",
+		),
+		runs: registry.NewCounter(
+			"cron_job_runs_total",
+			"Total number of cron job runs.",
+			"schedule",
+		),
+	})
 }
 
 /*
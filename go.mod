@@ -11,6 +11,7 @@ require (
 	github.com/aws/aws-sdk-go-v2/service/s3 v1.89.0
 	github.com/golang-jwt/jwt/v5 v5.2.3
 	github.com/gorilla/sessions v1.2.1
+	github.com/lib/pq v1.10.5
 	github.com/mailgun/mailgun-go/v5 v5.5.0
 	github.com/pterm/pterm v0.12.80
 	github.com/resend/resend-go/v2 v2.28.0
@@ -65,7 +66,6 @@ require (
 	github.com/lestrrat-go/iter v1.0.2 // indirect
 	github.com/lestrrat-go/jwx v1.2.29 // indirect
 	github.com/lestrrat-go/option v1.0.1 // indirect
-	github.com/lib/pq v1.10.5 // indirect
 	github.com/lithammer/fuzzysearch v1.1.8 // indirect
 	github.com/mailgun/errors v0.4.0 // indirect
 	github.com/mattn/go-runewidth v0.0.16 // indirect
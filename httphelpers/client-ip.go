@@ -0,0 +1,244 @@
+package httphelpers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type clientIPContextKey struct{}
+
+/*
+ForwardedRequest is the original client request as described by the
+forwarding headers of trusted proxies. Proto and Host are empty when the
+proxies didn't send them.
+*/
+type ForwardedRequest struct {
+	ClientIP string
+	Host     string
+	Proto    string
+}
+
+/*
+ClientIP returns the IP address of the client that made the request. If
+the request passed through a real IP middleware (such as the one in mux2),
+the resolved address is returned. Otherwise it is the host part of the
+connection's remote address.
+*/
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(clientIPContextKey{}).(string); ok && ip != "" {
+		return ip
+	}
+
+	return RemoteAddrIP(r.RemoteAddr)
+}
+
+/*
+ContextWithClientIP stores a resolved client IP address in a context, for
+ClientIP to return.
+*/
+func ContextWithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, clientIPContextKey{}, ip)
+}
+
+/*
+ParseTrustedProxies parses CIDR ranges (such as "10.0.0.0/8") and single
+addresses (such as "192.0.2.10") for use with ResolveForwardedRequest.
+*/
+func ParseTrustedProxies(proxies ...string) ([]netip.Prefix, error) {
+	result := []netip.Prefix{}
+
+	for _, proxy := range proxies {
+		if prefix, err := netip.ParsePrefix(proxy); err == nil {
+			result = append(result, prefix.Masked())
+			continue
+		}
+
+		if addr, err := netip.ParseAddr(proxy); err == nil {
+			result = append(result, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		return nil, fmt.Errorf("invalid trusted proxy '%s'", proxy)
+	}
+
+	return result, nil
+}
+
+/*
+ResolveForwardedRequest works out the client IP, and the scheme and host
+the client used, from forwarding headers. Headers are only honored when
+the direct peer is a trusted proxy. The Forwarded header (RFC 7239) is
+preferred, then X-Forwarded-For, then X-Real-IP.
+
+Forwarded and X-Forwarded-For are read right to left, skipping trusted
+proxies, and the first untrusted hop is the client. This means clients
+can't spoof their address by sending these headers themselves.
+*/
+func ResolveForwardedRequest(r *http.Request, trusted []netip.Prefix) ForwardedRequest {
+	remote := RemoteAddrIP(r.RemoteAddr)
+	result := ForwardedRequest{ClientIP: remote}
+
+	if !isTrustedProxy(remote, trusted) {
+		return result
+	}
+
+	if forwarded := r.Header.Values("Forwarded"); len(forwarded) > 0 {
+		elements := parseForwarded(strings.Join(forwarded, ","))
+
+		for i := len(elements) - 1; i >= 0; i-- {
+			ip := elements[i]["for"]
+
+			if isTrustedProxy(ip, trusted) {
+				continue
+			}
+
+			if isValidIP(ip) {
+				result.ClientIP = ip
+				result.Host = elements[i]["host"]
+				result.Proto = strings.ToLower(elements[i]["proto"])
+			}
+
+			break
+		}
+
+		return result
+	}
+
+	if forwardedFor := r.Header.Values("X-Forwarded-For"); len(forwardedFor) > 0 {
+		hops := splitHeaderList(strings.Join(forwardedFor, ","))
+
+		for i := len(hops) - 1; i >= 0; i-- {
+			if isTrustedProxy(hops[i], trusted) {
+				continue
+			}
+
+			if isValidIP(hops[i]) {
+				result.ClientIP = hops[i]
+			}
+
+			break
+		}
+	} else if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); isValidIP(realIP) {
+		result.ClientIP = realIP
+	}
+
+	result.Host = lastHeaderListValue(r.Header.Values("X-Forwarded-Host"))
+	result.Proto = strings.ToLower(lastHeaderListValue(r.Header.Values("X-Forwarded-Proto")))
+
+	return result
+}
+
+/*
+RemoteAddrIP returns the host part of an address in "host:port" form,
+such as http.Request.RemoteAddr.
+*/
+func RemoteAddrIP(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+
+	if err != nil {
+		return remoteAddr
+	}
+
+	return host
+}
+
+/*
+parseForwarded parses a Forwarded header into one map of lower-cased
+parameter names to values per element. Quotes are removed, and ports
+are stripped from "for" values.
+*/
+func parseForwarded(header string) []map[string]string {
+	result := []map[string]string{}
+
+	for _, element := range splitHeaderList(header) {
+		params := map[string]string{}
+
+		for pair := range strings.SplitSeq(element, ";") {
+			key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+
+			if !ok {
+				continue
+			}
+
+			params[strings.ToLower(strings.TrimSpace(key))] = strings.Trim(strings.TrimSpace(value), `"`)
+		}
+
+		if ip, ok := params["for"]; ok {
+			params["for"] = stripPort(ip)
+		}
+
+		result = append(result, params)
+	}
+
+	return result
+}
+
+/*
+stripPort removes the port from "192.0.2.1:80" and "[2001:db8::1]:80", and
+the brackets from "[2001:db8::1]". Bare IPv6 addresses are returned as is.
+*/
+func stripPort(value string) string {
+	if strings.HasPrefix(value, "[") {
+		if end := strings.Index(value, "]"); end > 0 {
+			return value[1:end]
+		}
+
+		return value
+	}
+
+	if strings.Count(value, ":") == 1 {
+		host, _, _ := strings.Cut(value, ":")
+		return host
+	}
+
+	return value
+}
+
+func splitHeaderList(header string) []string {
+	result := []string{}
+
+	for value := range strings.SplitSeq(header, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			result = append(result, value)
+		}
+	}
+
+	return result
+}
+
+func lastHeaderListValue(values []string) string {
+	list := splitHeaderList(strings.Join(values, ","))
+
+	if len(list) == 0 {
+		return ""
+	}
+
+	return list[len(list)-1]
+}
+
+func isValidIP(ip string) bool {
+	_, err := netip.ParseAddr(ip)
+	return err == nil
+}
+
+func isTrustedProxy(ip string, trusted []netip.Prefix) bool {
+	addr, err := netip.ParseAddr(ip)
+
+	if err != nil {
+		return false
+	}
+
+	addr = addr.Unmap()
+
+	for _, prefix := range trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,105 @@
+package httphelpers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveForwardedRequest(t *testing.T) {
+	trusted, err := httphelpers.ParseTrustedProxies("10.0.0.0/8", "192.0.2.10", "2001:db8:ffff::/48")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       httphelpers.ForwardedRequest
+	}{
+		{
+			name:       "direct connection",
+			remoteAddr: "203.0.113.5:1000",
+			want:       httphelpers.ForwardedRequest{ClientIP: "203.0.113.5"},
+		},
+		{
+			name:       "untrusted peer cannot spoof",
+			remoteAddr: "203.0.113.5:1000",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1", "X-Forwarded-Proto": "https"},
+			want:       httphelpers.ForwardedRequest{ClientIP: "203.0.113.5"},
+		},
+		{
+			name:       "trusted proxy",
+			remoteAddr: "10.1.1.1:1000",
+			headers:    map[string]string{"X-Forwarded-For": "198.51.100.1", "X-Forwarded-Proto": "HTTPS", "X-Forwarded-Host": "example.com"},
+			want:       httphelpers.ForwardedRequest{ClientIP: "198.51.100.1", Host: "example.com", Proto: "https"},
+		},
+		{
+			name:       "rightmost untrusted hop",
+			remoteAddr: "10.1.1.1:1000",
+			headers:    map[string]string{"X-Forwarded-For": "1.1.1.1, 198.51.100.1, 192.0.2.10"},
+			want:       httphelpers.ForwardedRequest{ClientIP: "198.51.100.1"},
+		},
+		{
+			name:       "invalid hop falls back to proxy",
+			remoteAddr: "10.1.1.1:1000",
+			headers:    map[string]string{"X-Forwarded-For": "not-an-ip"},
+			want:       httphelpers.ForwardedRequest{ClientIP: "10.1.1.1"},
+		},
+		{
+			name:       "X-Real-IP",
+			remoteAddr: "192.0.2.10:1000",
+			headers:    map[string]string{"X-Real-IP": "198.51.100.7"},
+			want:       httphelpers.ForwardedRequest{ClientIP: "198.51.100.7"},
+		},
+		{
+			name:       "Forwarded",
+			remoteAddr: "10.1.1.1:1000",
+			headers:    map[string]string{"Forwarded": `for=1.1.1.1, for="198.51.100.1:4711";proto=https;host=example.com, for=10.2.2.2`},
+			want:       httphelpers.ForwardedRequest{ClientIP: "198.51.100.1", Host: "example.com", Proto: "https"},
+		},
+		{
+			name:       "Forwarded IPv6",
+			remoteAddr: "[2001:db8:ffff::1]:1000",
+			headers:    map[string]string{"Forwarded": `For="[2001:db8:cafe::17]:4711";Proto=http`},
+			want:       httphelpers.ForwardedRequest{ClientIP: "2001:db8:cafe::17", Proto: "http"},
+		},
+		{
+			name:       "Forwarded takes precedence",
+			remoteAddr: "10.1.1.1:1000",
+			headers:    map[string]string{"Forwarded": "for=198.51.100.1", "X-Forwarded-For": "198.51.100.2"},
+			want:       httphelpers.ForwardedRequest{ClientIP: "198.51.100.1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+
+			for key, value := range tt.headers {
+				r.Header.Set(key, value)
+			}
+
+			assert.Equal(t, tt.want, httphelpers.ResolveForwardedRequest(r, trusted))
+		})
+	}
+}
+
+func TestParseTrustedProxies_Invalid(t *testing.T) {
+	_, err := httphelpers.ParseTrustedProxies("10.0.0.0/8", "nope")
+	assert.Error(t, err)
+}
+
+func TestClientIP(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "203.0.113.5:1000"
+
+	assert.Equal(t, "203.0.113.5", httphelpers.ClientIP(r))
+
+	r = r.WithContext(httphelpers.ContextWithClientIP(r.Context(), "198.51.100.1"))
+	assert.Equal(t, "198.51.100.1", httphelpers.ClientIP(r))
+}
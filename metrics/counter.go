@@ -0,0 +1,46 @@
+package metrics
+
+import (
+	"bufio"
+)
+
+/*
+A Counter is a cumulative metric that only increases, such as the
+number of requests served.
+*/
+type Counter struct {
+	*vec
+}
+
+/*
+Inc increments the counter for the given label values by 1.
+*/
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+/*
+Add increases the counter for the given label values. Negative values
+are ignored, as counters cannot decrease.
+*/
+func (c *Counter) Add(value float64, labelValues ...string) {
+	if value < 0 {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.get(labelValues).value += value
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.writeHeader(w, "counter")
+
+	for _, s := range c.sortedSeries() {
+		c.writeSample(w, "", s.labelValues, "", "", s.value)
+	}
+}
@@ -0,0 +1,69 @@
+package metrics
+
+import (
+	"bufio"
+)
+
+/*
+A Gauge is a metric that can go up and down, such as the number of
+requests currently in flight.
+*/
+type Gauge struct {
+	*vec
+}
+
+/*
+Set sets the gauge for the given label values.
+*/
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.get(labelValues).value = value
+}
+
+/*
+Add adds to the gauge for the given label values. Use a negative
+value to subtract.
+*/
+func (g *Gauge) Add(value float64, labelValues ...string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.get(labelValues).value += value
+}
+
+/*
+Inc increments the gauge for the given label values by 1.
+*/
+func (g *Gauge) Inc(labelValues ...string) {
+	g.Add(1, labelValues...)
+}
+
+/*
+Dec decrements the gauge for the given label values by 1.
+*/
+func (g *Gauge) Dec(labelValues ...string) {
+	g.Add(-1, labelValues...)
+}
+
+func (g *Gauge) write(w *bufio.Writer) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.writeHeader(w, "gauge")
+
+	for _, s := range g.sortedSeries() {
+		g.writeSample(w, "", s.labelValues, "", "", s.value)
+	}
+}
+
+type gaugeFunc struct {
+	*vec
+	fn func() float64
+}
+
+func (g *gaugeFunc) write(w *bufio.Writer) {
+	g.writeHeader(w, "gauge")
+	g.writeSample(w, "", nil, "", "", g.fn())
+}
@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"bufio"
+	"math"
+	"time"
+)
+
+/*
+DefaultBuckets are the default histogram buckets, in seconds. They are
+tailored to measure the latency of network requests.
+*/
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+/*
+A Histogram samples observations, such as request durations, and counts
+them in configurable buckets. It also tracks the sum and count of all
+observations.
+*/
+type Histogram struct {
+	*vec
+	buckets []float64
+}
+
+/*
+Observe records a single observation for the given label values.
+*/
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	s := h.get(labelValues)
+
+	if s.bucketCounts == nil {
+		s.bucketCounts = make([]uint64, len(h.buckets))
+	}
+
+	for i, upperBound := range h.buckets {
+		if value <= upperBound {
+			s.bucketCounts[i]++
+		}
+	}
+
+	s.count++
+	s.sum += value
+}
+
+/*
+ObserveDuration records the time elapsed since start, in seconds.
+*/
+func (h *Histogram) ObserveDuration(start time.Time, labelValues ...string) {
+	h.Observe(time.Since(start).Seconds(), labelValues...)
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.writeHeader(w, "histogram")
+
+	for _, s := range h.sortedSeries() {
+		for i, upperBound := range h.buckets {
+			h.writeSample(w, "_bucket", s.labelValues, "le", formatFloat(upperBound), float64(s.bucketCounts[i]))
+		}
+
+		h.writeSample(w, "_bucket", s.labelValues, "le", formatFloat(math.Inf(1)), float64(s.count))
+		h.writeSample(w, "_sum", s.labelValues, "", "", s.sum)
+		h.writeSample(w, "_count", s.labelValues, "", "", float64(s.count))
+	}
+}
@@ -0,0 +1,168 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+var (
+	metricNameRegex = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+	labelNameRegex  = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+/*
+ContentType is the content type of the Prometheus text exposition format.
+*/
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+type collector interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+/*
+A Registry holds a set of metrics and writes them in the Prometheus
+text exposition format. Registry implements http.Handler, so it can be
+served directly as a scrape endpoint.
+
+	registry := metrics.NewRegistry()
+	jobs := registry.NewCounter("jobs_processed_total", "Number of jobs processed.", "queue")
+
+	jobs.Inc("emails")
+	http.Handle("GET /metrics", registry)
+*/
+type Registry struct {
+	collectors []collector
+	lock       *sync.RWMutex
+	names      map[string]struct{}
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		collectors: []collector{},
+		lock:       &sync.RWMutex{},
+		names:      map[string]struct{}{},
+	}
+}
+
+/*
+NewCounter registers and returns a counter. Counters only go up.
+This panics if the name is invalid or already registered.
+*/
+func (r *Registry) NewCounter(name, help string, labelNames ...string) *Counter {
+	result := &Counter{
+		vec: newVec(name, help, labelNames),
+	}
+
+	r.register(result)
+	return result
+}
+
+/*
+NewGauge registers and returns a gauge. Gauges may go up and down.
+This panics if the name is invalid or already registered.
+*/
+func (r *Registry) NewGauge(name, help string, labelNames ...string) *Gauge {
+	result := &Gauge{
+		vec: newVec(name, help, labelNames),
+	}
+
+	r.register(result)
+	return result
+}
+
+/*
+NewGaugeFunc registers a gauge whose value is read by calling fn each
+time metrics are collected. This is useful for exposing values that
+are already tracked elsewhere, such as the number of connected clients.
+This panics if the name is invalid or already registered.
+*/
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	result := &gaugeFunc{
+		fn:  fn,
+		vec: newVec(name, help, nil),
+	}
+
+	r.register(result)
+}
+
+/*
+NewHistogram registers and returns a histogram with the provided bucket
+upper bounds. If buckets is empty, DefaultBuckets are used. This panics
+if the name is invalid or already registered.
+*/
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labelNames ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+
+	sortedBuckets := make([]float64, len(buckets))
+	copy(sortedBuckets, buckets)
+	sort.Float64s(sortedBuckets)
+
+	result := &Histogram{
+		buckets: sortedBuckets,
+		vec:     newVec(name, help, labelNames),
+	}
+
+	r.register(result)
+	return result
+}
+
+/*
+WriteTo writes all registered metrics to w in the Prometheus text
+exposition format.
+*/
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.lock.RLock()
+	collectors := make([]collector, len(r.collectors))
+	copy(collectors, r.collectors)
+	r.lock.RUnlock()
+
+	sort.Slice(collectors, func(i, j int) bool {
+		return collectors[i].name() < collectors[j].name()
+	})
+
+	cw := &countingWriter{w: w}
+	buffered := bufio.NewWriter(cw)
+
+	for _, c := range collectors {
+		c.write(buffered)
+	}
+
+	err := buffered.Flush()
+	return cw.n, err
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	_, _ = r.WriteTo(w)
+}
+
+func (r *Registry) register(c collector) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, exists := r.names[c.name()]; exists {
+		panic(fmt.Sprintf("metric '%s' is already registered", c.name()))
+	}
+
+	r.names[c.name()] = struct{}{}
+	r.collectors = append(r.collectors, c)
+}
+
+type countingWriter struct {
+	n int64
+	w io.Writer
+}
+
+func (cw *countingWriter) Write(b []byte) (int, error) {
+	n, err := cw.w.Write(b)
+	cw.n += int64(n)
+	return n, err
+}
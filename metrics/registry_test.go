@@ -0,0 +1,85 @@
+package metrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/adampresley/adamgokit/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	registry := metrics.NewRegistry()
+
+	requests := registry.NewCounter("requests_total", "Total requests.", "route", "status")
+	inFlight := registry.NewGauge("requests_in_flight", "Requests in flight.")
+	latency := registry.NewHistogram("request_duration_seconds", "Request latency.", []float64{0.5, 0.1}, "route")
+	registry.NewGaugeFunc("connected_clients", "Connected clients.", func() float64 { return 3 })
+
+	requests.Inc("GET /users/{id}", "200")
+	requests.Add(2, "GET /", "500")
+	inFlight.Inc()
+	inFlight.Inc()
+	inFlight.Dec()
+	latency.Observe(0.05, "GET /")
+	latency.Observe(0.3, "GET /")
+	latency.Observe(1, "GET /")
+
+	var b strings.Builder
+	_, err := registry.WriteTo(&b)
+	assert.NoError(t, err)
+
+	want := `# HELP connected_clients Connected clients.
+# TYPE connected_clients gauge
+connected_clients 3
+# HELP request_duration_seconds Request latency.
+# TYPE request_duration_seconds histogram
+request_duration_seconds_bucket{route="GET /",le="0.1"} 1
+request_duration_seconds_bucket{route="GET /",le="0.5"} 2
+request_duration_seconds_bucket{route="GET /",le="+Inf"} 3
+request_duration_seconds_sum{route="GET /"} 1.35
+request_duration_seconds_count{route="GET /"} 3
+# HELP requests_in_flight Requests in flight.
+# TYPE requests_in_flight gauge
+requests_in_flight 1
+# HELP requests_total Total requests.
+# TYPE requests_total counter
+requests_total{route="GET /",status="500"} 2
+requests_total{route="GET /users/{id}",status="200"} 1
+`
+
+	assert.Equal(t, want, b.String())
+}
+
+func TestRegistry_EscapesLabelValues(t *testing.T) {
+	registry := metrics.NewRegistry()
+	counter := registry.NewCounter("escaped_total", "", "value")
+	counter.Inc("a \"quoted\"\nline\\")
+
+	var b strings.Builder
+	_, _ = registry.WriteTo(&b)
+
+	assert.Contains(t, b.String(), `escaped_total{value="a \"quoted\"\nline\\"} 1`)
+}
+
+func TestRegistry_Panics(t *testing.T) {
+	registry := metrics.NewRegistry()
+	registry.NewCounter("duplicate_total", "")
+
+	assert.Panics(t, func() { registry.NewCounter("duplicate_total", "") }, "duplicate names")
+	assert.Panics(t, func() { registry.NewGauge("bad-name", "") }, "invalid names")
+	assert.Panics(t, func() { registry.NewCounter("labels_total", "", "a").Inc() }, "missing label values")
+}
+
+func TestRegistry_ServeHTTP(t *testing.T) {
+	registry := metrics.NewRegistry()
+	registry.NewCounter("served_total", "").Inc()
+
+	w := httptest.NewRecorder()
+	registry.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, metrics.ContentType, w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "served_total 1\n")
+}
@@ -0,0 +1,163 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+vec holds the series of a metric, keyed by label values.
+*/
+type vec struct {
+	help       string
+	labelNames []string
+	lock       *sync.Mutex
+	metricName string
+	series     map[string]*series
+}
+
+type series struct {
+	labelValues []string
+
+	value float64
+
+	bucketCounts []uint64
+	count        uint64
+	sum          float64
+}
+
+func newVec(name, help string, labelNames []string) *vec {
+	if !metricNameRegex.MatchString(name) {
+		panic(fmt.Sprintf("invalid metric name '%s'", name))
+	}
+
+	for _, labelName := range labelNames {
+		if !labelNameRegex.MatchString(labelName) || labelName == "le" {
+			panic(fmt.Sprintf("invalid label name '%s' for metric '%s'", labelName, name))
+		}
+	}
+
+	return &vec{
+		help:       help,
+		labelNames: labelNames,
+		lock:       &sync.Mutex{},
+		metricName: name,
+		series:     map[string]*series{},
+	}
+}
+
+func (v *vec) name() string {
+	return v.metricName
+}
+
+/*
+get returns the series for a set of label values, creating it if needed.
+Callers must hold the lock.
+*/
+func (v *vec) get(labelValues []string) *series {
+	if len(labelValues) != len(v.labelNames) {
+		panic(fmt.Sprintf("metric '%s' expects %d label values, got %d", v.metricName, len(v.labelNames), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	s, ok := v.series[key]
+
+	if !ok {
+		values := make([]string, len(labelValues))
+		copy(values, labelValues)
+
+		s = &series{labelValues: values}
+		v.series[key] = s
+	}
+
+	return s
+}
+
+/*
+sortedSeries returns a snapshot of all series ordered by label values.
+Callers must hold the lock.
+*/
+func (v *vec) sortedSeries() []*series {
+	result := make([]*series, 0, len(v.series))
+
+	for _, s := range v.series {
+		result = append(result, s)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return slices.Compare(result[i].labelValues, result[j].labelValues) < 0
+	})
+
+	return result
+}
+
+func (v *vec) writeHeader(w *bufio.Writer, metricType string) {
+	if v.help != "" {
+		fmt.Fprintf(w, "# HELP %s %s\n", v.metricName, escapeHelp(v.help))
+	}
+
+	fmt.Fprintf(w, "# TYPE %s %s\n", v.metricName, metricType)
+}
+
+func (v *vec) writeSample(w *bufio.Writer, suffix string, labelValues []string, extraName, extraValue string, value float64) {
+	w.WriteString(v.metricName)
+	w.WriteString(suffix)
+
+	if len(labelValues) > 0 || extraName != "" {
+		w.WriteByte('{')
+
+		for i, labelValue := range labelValues {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+
+			fmt.Fprintf(w, `%s="%s"`, v.labelNames[i], escapeLabelValue(labelValue))
+		}
+
+		if extraName != "" {
+			if len(labelValues) > 0 {
+				w.WriteByte(',')
+			}
+
+			fmt.Fprintf(w, `%s="%s"`, extraName, escapeLabelValue(extraValue))
+		}
+
+		w.WriteByte('}')
+	}
+
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+func escapeHelp(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return strings.ReplaceAll(s, "\n", `\n`)
+}
+
+func escapeLabelValue(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return strings.ReplaceAll(s, "\n", `\n`)
+}
+
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+Inf"
+
+	case math.IsInf(f, -1):
+		return "-Inf"
+
+	case math.IsNaN(f):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
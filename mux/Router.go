@@ -59,6 +59,12 @@ type LetsEncryptConfig struct {
 	Domain   string
 }
 
+/*
+RouterConfig configures SetupRouter and SetupServer.
+
+Deprecated: Use mux2.Setup with router options. Existing configurations
+can run on mux2 with SetupMux2.
+*/
 type RouterConfig struct {
 	Address              string
 	AuthConfig           *auth.AuthMiddlewareConfig
@@ -75,12 +81,20 @@ type RouterConfig struct {
 	UseGzipForStaticFS   bool
 }
 
+/*
+SetupRouter creates a ServeMux with the configured routes, middlewares,
+and static content.
+
+Deprecated: Use SetupMux2, or mux2.Setup.
+*/
 func SetupRouter(config RouterConfig, routes []Route) *http.ServeMux {
 	var (
 		staticFS      http.Handler
 		excludedPaths []string
 	)
 
+	slog.Warn("mux.SetupRouter is deprecated. use mux.SetupMux2 or mux2.Setup instead")
+
 	/*
 	 * Ensure some sane defaults. Also panic on some things not being configured.
 	 */
@@ -183,6 +197,12 @@ func SetupRouter(config RouterConfig, routes []Route) *http.ServeMux {
 	return m
 }
 
+/*
+SetupServer starts an HTTP server in the background, and returns it with
+a channel that receives interrupt and terminate signals.
+
+Deprecated: Use SetupMux2, or mux2.Setup, and Router.Start.
+*/
 func SetupServer(config RouterConfig, mux http.Handler) (*http.Server, chan os.Signal) {
 	var (
 		tlsConfig   *tls.Config
@@ -190,6 +210,8 @@ func SetupServer(config RouterConfig, mux http.Handler) (*http.Server, chan os.S
 		server      *http.Server
 	)
 
+	slog.Warn("mux.SetupServer is deprecated. use mux.SetupMux2 or mux2.Setup instead")
+
 	if config.LetsEncryptConfig != nil {
 		certManager = autocert.Manager{
 			Prompt:     autocert.AcceptTOS,
@@ -259,6 +281,13 @@ func SetupServer(config RouterConfig, mux http.Handler) (*http.Server, chan os.S
 	return server, quit
 }
 
+/*
+Shutdown gracefully stops an HTTP server, waiting up to 15 seconds for
+requests to finish.
+
+Deprecated: mux2.Router shuts down on its own when its context is
+cancelled. See Router.Shutdown.
+*/
 func Shutdown(httpServer *http.Server) {
 	httpContext, httpCancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer httpCancel()
@@ -1,62 +1,27 @@
 package mux
 
 import (
-	"compress/gzip"
-	"io"
 	"net/http"
-	"strings"
-)
-
-type GzipMiddlewareConfig struct {
-	excludedPaths []string
-}
-
-type GzipMiddlewareConfigOption func(*GzipMiddlewareConfig)
-
-func NewGzipMiddleware(options ...GzipMiddlewareConfigOption) func(next http.Handler) http.Handler {
-	opts := &GzipMiddlewareConfig{
-		excludedPaths: []string{},
-	}
 
-	for _, opt := range options {
-		opt(opts)
-	}
-
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
-				next.ServeHTTP(w, r)
-				return
-			}
-
-			for _, excludedPath := range opts.excludedPaths {
-				if strings.HasPrefix(r.URL.Path, excludedPath) {
-					next.ServeHTTP(w, r)
-					return
-				}
-			}
+	"github.com/adampresley/adamgokit/mux2"
+)
 
-			w.Header().Set("Content-Encoding", "gzip")
-			gz := gzip.NewWriter(w)
-			defer gz.Close()
+type GzipMiddlewareConfig = mux2.CompressionConfig
 
-			gzw := &gzipResponseWriter{Writer: gz, ResponseWriter: w}
-			next.ServeHTTP(gzw, r)
-		})
-	}
-}
+type GzipMiddlewareConfigOption = mux2.CompressionOption
 
-type gzipResponseWriter struct {
-	io.Writer
-	http.ResponseWriter
-}
+/*
+NewGzipMiddleware returns a middleware that compresses responses with gzip.
+This delegates to the mux2 compression middleware, which negotiates the
+coding, skips small and already-compressed responses, and supports
+flushing.
 
-func (w *gzipResponseWriter) Write(b []byte) (int, error) {
-	return w.Writer.Write(b)
+Deprecated: Use mux2.NewCompressionMiddleware.
+*/
+func NewGzipMiddleware(options ...GzipMiddlewareConfigOption) func(next http.Handler) http.Handler {
+	return mux2.NewGzipMiddleware(options...)
 }
 
 func WithExcludedPaths(paths ...string) GzipMiddlewareConfigOption {
-	return func(config *GzipMiddlewareConfig) {
-		config.excludedPaths = append(config.excludedPaths, paths...)
-	}
+	return mux2.WithExcludedPaths(paths...)
 }
@@ -0,0 +1,162 @@
+package mux
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/adampresley/adamgokit/mux2"
+)
+
+/*
+SetupMux2 runs a legacy RouterConfig and routes on mux2, so existing apps
+get graceful shutdown, error pages, and every other mux2 feature without
+rewriting their setup. Additional mux2 options are applied after the
+translated ones, so they can add to or override them.
+
+	router := mux.SetupMux2(routerConfig, routes, shutdownCtx, stopApp, mux2.WithAccessLog())
+
+	if err := router.Start(); err != nil {
+	  slog.Error("error running HTTP server", "error", err)
+	}
+
+Start replaces the SetupServer, wait, and Shutdown steps. Unlike
+SetupServer, listener errors are returned instead of exiting the process.
+A deprecation warning is logged for each legacy setting in use, naming
+the mux2 option to use instead.
+*/
+func SetupMux2(config RouterConfig, routes []Route, shutdownCtx context.Context, stopApp context.CancelFunc, options ...mux2.RouterOption) *mux2.Router {
+	if config.Address == "" {
+		panic("router address cannot be blank.")
+	}
+
+	logDeprecations(config)
+
+	options = append(Mux2Options(config), options...)
+	return mux2.Setup(mux2.Config{Host: config.Address}, Mux2Routes(routes), shutdownCtx, stopApp, options...)
+}
+
+/*
+Mux2Options translates a RouterConfig into mux2 router options. The
+legacy defaults are kept: a 120 second idle, read, and write timeout, and
+static content served from "app" at "/static/".
+*/
+func Mux2Options(config RouterConfig) []mux2.RouterOption {
+	result := []mux2.RouterOption{
+		mux2.WithDebug(config.Debug),
+		mux2.WithIdleTimeout(legacyTimeout(config.HttpIdleTimeout)),
+		mux2.WithReadTimeout(legacyTimeout(config.HttpReadTimeout)),
+		mux2.WithWriteTimeout(legacyTimeout(config.HttpWriteTimeout)),
+	}
+
+	if config.AuthConfig != nil {
+		result = append(result, mux2.WithAuth(config.AuthConfig))
+	}
+
+	if len(config.Middlewares) > 0 {
+		middlewares := make([]mux2.MiddlewareFunc, 0, len(config.Middlewares))
+
+		for _, mw := range config.Middlewares {
+			middlewares = append(middlewares, mux2.MiddlewareFunc(mw))
+		}
+
+		result = append(result, mux2.WithMiddlewares(middlewares...))
+	}
+
+	if config.LetsEncryptConfig != nil {
+		result = append(result, mux2.WithLetsEncrypt(&mux2.LetsEncryptConfig{
+			CertPath: config.LetsEncryptConfig.CertPath,
+			Domain:   config.LetsEncryptConfig.Domain,
+		}))
+	}
+
+	if config.ServeStaticContent {
+		rootDir := config.StaticContentRootDir
+
+		if rootDir == "" {
+			rootDir = "app"
+		}
+
+		prefix := config.StaticContentPrefix
+
+		if prefix == "" {
+			prefix = "/static/"
+		}
+
+		result = append(result, mux2.WithStaticContent(rootDir, normalizeStaticContentPrefix(prefix), config.StaticFS))
+
+		if config.UseGzipForStaticFS {
+			result = append(result, mux2.UseGzipForStaticFiles())
+		}
+	}
+
+	return result
+}
+
+/*
+Mux2Routes converts legacy routes to mux2 routes.
+*/
+func Mux2Routes(routes []Route) []mux2.Route {
+	result := make([]mux2.Route, 0, len(routes))
+
+	for _, route := range routes {
+		middlewares := make([]mux2.MiddlewareFunc, 0, len(route.Middlewares))
+
+		for _, mw := range route.Middlewares {
+			middlewares = append(middlewares, mux2.MiddlewareFunc(mw))
+		}
+
+		result = append(result, mux2.Route{
+			Path:        route.Path,
+			Handler:     route.Handler,
+			HandlerFunc: route.HandlerFunc,
+			Middlewares: middlewares,
+		})
+	}
+
+	return result
+}
+
+func legacyTimeout(seconds int) time.Duration {
+	if seconds == 0 {
+		seconds = 120
+	}
+
+	return time.Duration(seconds) * time.Second
+}
+
+func logDeprecations(config RouterConfig) {
+	warn := func(setting, replacement string) {
+		slog.Warn("mux is deprecated. use mux2 instead", slog.String("setting", setting), slog.String("replacement", replacement))
+	}
+
+	warn("mux.RouterConfig", "mux2.Setup")
+
+	if config.AuthConfig != nil {
+		warn("AuthConfig", "mux2.WithAuth")
+	}
+
+	if config.Debug {
+		warn("Debug", "mux2.WithDebug")
+	}
+
+	if config.HttpIdleTimeout != 0 || config.HttpReadTimeout != 0 || config.HttpWriteTimeout != 0 {
+		warn("HttpIdleTimeout, HttpReadTimeout, HttpWriteTimeout", "mux2.WithIdleTimeout, mux2.WithReadTimeout, mux2.WithWriteTimeout")
+	}
+
+	if config.LetsEncryptConfig != nil {
+		warn("LetsEncryptConfig", "mux2.WithLetsEncrypt")
+	}
+
+	if len(config.Middlewares) > 0 {
+		warn("Middlewares", "mux2.WithMiddlewares")
+	}
+
+	if config.ServeStaticContent {
+		warn("ServeStaticContent", "mux2.WithStaticContent")
+	}
+
+	if config.UseGzipForStaticFS {
+		warn("UseGzipForStaticFS", "mux2.UseGzipForStaticFiles")
+	}
+}
@@ -0,0 +1,61 @@
+package mux
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetupMux2(t *testing.T) {
+	tagged := func(tag string) MiddlewareFunc {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Add("X-Tag", tag)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	routes := []Route{
+		{Path: "GET /hello", HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, "hello")
+		}, Middlewares: []MiddlewareFunc{tagged("route")}},
+	}
+
+	router := SetupMux2(
+		RouterConfig{
+			Address:             "127.0.0.1:0",
+			HttpReadTimeout:     30,
+			Middlewares:         []MiddlewareFunc{tagged("router")},
+			ServeStaticContent:  true,
+			StaticContentPrefix: "assets",
+			StaticFS: fstest.MapFS{
+				"app/assets/site.css": {Data: []byte("body {}")},
+			},
+		},
+		routes,
+		nil,
+		nil,
+	)
+
+	assert.Equal(t, 30*time.Second, router.Server.ReadTimeout)
+	assert.Equal(t, 120*time.Second, router.Server.WriteTimeout, "legacy defaults are kept")
+
+	w := httptest.NewRecorder()
+	router.Server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/hello", nil))
+
+	assert.Equal(t, "hello", w.Body.String())
+	assert.Equal(t, []string{"route", "router"}, w.Header().Values("X-Tag"), "route middlewares wrap router middlewares")
+
+	w = httptest.NewRecorder()
+	router.Server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/assets/site.css", nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "body {}", w.Body.String())
+}
@@ -0,0 +1,58 @@
+package mux2
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+)
+
+/*
+NewAccessLogMiddleware returns a middleware that writes a structured log
+entry for every request once it completes. Entries include the method,
+path, status, bytes written, latency, and client IP, plus the request ID when the
+request ID middleware is in use. Server errors are logged at error level,
+client errors at warn level, and everything else at info level. If logger
+is nil, slog.Default() is used.
+*/
+func NewAccessLogMiddleware(logger *slog.Logger) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rw := newResponseWriter(w)
+
+			next.ServeHTTP(rw, r)
+
+			l := logger
+
+			if l == nil {
+				l = slog.Default()
+			}
+
+			level := slog.LevelInfo
+
+			if rw.Status() >= 500 {
+				level = slog.LevelError
+			} else if rw.Status() >= 400 {
+				level = slog.LevelWarn
+			}
+
+			attrs := []slog.Attr{
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", rw.Status()),
+				slog.Int64("bytes", rw.BytesWritten()),
+				slog.Duration("latency", time.Since(start)),
+				slog.String("clientIP", httphelpers.ClientIP(r)),
+				slog.String("userAgent", r.UserAgent()),
+			}
+
+			if id := RequestIDFromContext(r.Context()); id != "" {
+				attrs = append(attrs, slog.String("requestID", id))
+			}
+
+			l.LogAttrs(r.Context(), level, "http request", attrs...)
+		})
+	}
+}
@@ -0,0 +1,407 @@
+package mux2
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+type CacheConfig struct {
+	CacheControl string
+	Cache        *ResponseCache
+	MaxBodySize  int
+	TagFunc      func(r *http.Request) []string
+	Tags         []string
+	TTL          time.Duration
+}
+
+type CacheOption func(c *CacheConfig)
+
+type cacheStateContextKey struct{}
+
+/*
+cacheState lets middlewares inside the cache middleware mark a response
+as unique to the request, such as one with a CSRF token, so it isn't
+stored.
+*/
+type cacheState struct {
+	personalized atomic.Bool
+}
+
+/*
+NewCacheMiddleware buffers GET and HEAD responses, gives successful
+responses an ETag (unless the handler set one), and answers If-None-Match
+and If-Modified-Since requests with a 304 Not Modified. This saves
+bandwidth even when the handler still runs.
+
+With WithResponseCache, successful responses are also stored, and later
+requests are served from the cache without calling the handler until the
+TTL expires. Responses are keyed by host and URL, plus the values of any
+request headers named in the response's Vary header. Responses are never
+stored when the request has an Authorization header, a CSRF token, or a
+Content-Security-Policy nonce, or the response sets a cookie, has
+Cache-Control no-store or private, or varies on "*". Other personalized
+responses must set Vary, such as "Vary: Cookie".
+
+Responses larger than the maximum body size (1MB by default), and
+responses that are flushed, are passed through as they are, as are
+websocket and other upgrade requests.
+*/
+func NewCacheMiddleware(options ...CacheOption) MiddlewareFunc {
+	config := &CacheConfig{
+		MaxBodySize: 1 << 20,
+		TTL:         time.Minute,
+	}
+
+	for _, opt := range options {
+		opt(config)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if (r.Method != http.MethodGet && r.Method != http.MethodHead) || isUpgradeRequest(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			primaryKey := "GET " + r.Host + r.URL.RequestURI()
+			useCache := config.Cache != nil && r.Header.Get("Authorization") == "" && CSRFToken(r) == "" && CSPNonce(r) == ""
+			state := &cacheState{}
+
+			if useCache {
+				r = r.WithContext(context.WithValue(r.Context(), cacheStateContextKey{}, state))
+			}
+
+			if useCache && !strings.Contains(r.Header.Get("Cache-Control"), "no-cache") {
+				if entry, ok := config.Cache.get(primaryKey, r); ok {
+					writeCachedResponse(w, r, entry, config.Cache.now())
+					return
+				}
+			}
+
+			before := w.Header().Clone()
+			rw := &cacheResponseWriter{ResponseWriter: w, maxBodySize: config.MaxBodySize}
+
+			next.ServeHTTP(rw, r)
+
+			if rw.passThrough {
+				return
+			}
+
+			status := rw.status
+
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			h := w.Header()
+
+			if status != http.StatusOK {
+				w.WriteHeader(status)
+				_, _ = w.Write(rw.body.Bytes())
+				return
+			}
+
+			if h.Get("ETag") == "" {
+				sum := sha256.Sum256(rw.body.Bytes())
+				h.Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+			}
+
+			if config.CacheControl != "" && h.Get("Cache-Control") == "" {
+				h.Set("Cache-Control", config.CacheControl)
+			}
+
+			if useCache && r.Method == http.MethodGet && !state.personalized.Load() && isStorableResponse(h) {
+				now := config.Cache.now()
+				lastModified, err := http.ParseTime(h.Get("Last-Modified"))
+
+				if err != nil {
+					lastModified = now.Truncate(time.Second)
+					h.Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+				}
+
+				tags := slices.Clone(config.Tags)
+
+				if config.TagFunc != nil {
+					tags = append(tags, config.TagFunc(r)...)
+				}
+
+				config.Cache.set(primaryKey, varyHeaderNames(h), r, &cachedResponse{
+					body:         bytes.Clone(rw.body.Bytes()),
+					etag:         h.Get("ETag"),
+					expires:      now.Add(config.TTL),
+					header:       changedHeaders(before, h),
+					lastModified: lastModified,
+					status:       status,
+					storedAt:     now,
+					tags:         tags,
+				})
+
+				h.Set("X-Cache", "MISS")
+			}
+
+			lastModified, _ := http.ParseTime(h.Get("Last-Modified"))
+
+			if isNotModified(r, h.Get("ETag"), lastModified) {
+				writeNotModified(w)
+				return
+			}
+
+			h.Set("Content-Length", strconv.Itoa(rw.body.Len()))
+			w.WriteHeader(status)
+
+			if r.Method != http.MethodHead {
+				_, _ = w.Write(rw.body.Bytes())
+			}
+		})
+	}
+}
+
+/*
+WithCacheControl sets the Cache-Control header on responses that don't
+already have one. For example, "no-cache" tells browsers to revalidate
+with the ETag on every request.
+*/
+func WithCacheControl(value string) CacheOption {
+	return func(c *CacheConfig) {
+		c.CacheControl = value
+	}
+}
+
+/*
+WithCacheMaxBodySize sets the largest response that will be buffered.
+Larger responses are sent without an ETag, and are not cached.
+*/
+func WithCacheMaxBodySize(size int) CacheOption {
+	return func(c *CacheConfig) {
+		c.MaxBodySize = size
+	}
+}
+
+/*
+WithCacheTags tags stored responses, so they can be removed with
+ResponseCache.InvalidateTags. tagFunc may be nil. Otherwise it is called
+for every stored response to add tags from the request, such as an ID
+from the path.
+*/
+func WithCacheTags(tagFunc func(r *http.Request) []string, tags ...string) CacheOption {
+	return func(c *CacheConfig) {
+		c.TagFunc = tagFunc
+		c.Tags = tags
+	}
+}
+
+/*
+WithResponseCache stores responses in cache for ttl. Without this, the
+middleware only adds ETags and answers conditional requests.
+*/
+func WithResponseCache(cache *ResponseCache, ttl time.Duration) CacheOption {
+	return func(c *CacheConfig) {
+		c.Cache = cache
+		c.TTL = ttl
+	}
+}
+
+func writeCachedResponse(w http.ResponseWriter, r *http.Request, entry *cachedResponse, now time.Time) {
+	h := w.Header()
+
+	for name, values := range entry.header {
+		h[name] = slices.Clone(values)
+	}
+
+	h.Set("Age", strconv.Itoa(max(int(now.Sub(entry.storedAt).Seconds()), 0)))
+	h.Set("X-Cache", "HIT")
+
+	if isNotModified(r, entry.etag, entry.lastModified) {
+		writeNotModified(w)
+		return
+	}
+
+	h.Set("Content-Length", strconv.Itoa(len(entry.body)))
+	w.WriteHeader(entry.status)
+
+	if r.Method != http.MethodHead {
+		_, _ = w.Write(entry.body)
+	}
+}
+
+/*
+isNotModified evaluates the conditional request headers. If-None-Match
+takes precedence over If-Modified-Since, and uses weak comparison.
+*/
+func isNotModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		if etag == "" {
+			return false
+		}
+
+		for candidate := range strings.SplitSeq(ifNoneMatch, ",") {
+			candidate = strings.TrimSpace(candidate)
+
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if lastModified.IsZero() {
+		return false
+	}
+
+	ifModifiedSince, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+
+	if err != nil {
+		return false
+	}
+
+	return !lastModified.Truncate(time.Second).After(ifModifiedSince)
+}
+
+func writeNotModified(w http.ResponseWriter) {
+	h := w.Header()
+
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	h.Del("Content-Encoding")
+
+	w.WriteHeader(http.StatusNotModified)
+}
+
+/*
+markPersonalized stops the cache middleware from storing the response to
+the request with ctx.
+*/
+func markPersonalized(ctx context.Context) {
+	if state, ok := ctx.Value(cacheStateContextKey{}).(*cacheState); ok {
+		state.personalized.Store(true)
+	}
+}
+
+func isStorableResponse(h http.Header) bool {
+	if len(h.Values("Set-Cookie")) > 0 {
+		return false
+	}
+
+	cacheControl := strings.ToLower(h.Get("Cache-Control"))
+
+	if strings.Contains(cacheControl, "no-store") || strings.Contains(cacheControl, "private") {
+		return false
+	}
+
+	return !slices.Contains(varyHeaderNames(h), "*")
+}
+
+func varyHeaderNames(h http.Header) []string {
+	result := []string{}
+
+	for _, value := range h.Values("Vary") {
+		for name := range strings.SplitSeq(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				result = append(result, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+
+	slices.Sort(result)
+	return slices.Compact(result)
+}
+
+/*
+changedHeaders returns the headers set by the handler, leaving out those
+set by outer middlewares before it ran, such as the request ID.
+*/
+func changedHeaders(before, after http.Header) http.Header {
+	result := http.Header{}
+
+	for name, values := range after {
+		if !slices.Equal(before[name], values) {
+			result[name] = slices.Clone(values)
+		}
+	}
+
+	return result
+}
+
+/*
+cacheResponseWriter buffers the response so an ETag can be computed. If
+the handler flushes, or writes more than the maximum body size, the
+buffer is written out and the rest of the response passes through.
+*/
+type cacheResponseWriter struct {
+	http.ResponseWriter
+
+	body        bytes.Buffer
+	maxBodySize int
+	passThrough bool
+	status      int
+}
+
+func (rw *cacheResponseWriter) WriteHeader(status int) {
+	if rw.passThrough {
+		rw.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	if status >= 100 && status < 200 {
+		rw.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	if rw.status == 0 {
+		rw.status = status
+	}
+}
+
+func (rw *cacheResponseWriter) Write(b []byte) (int, error) {
+	if rw.passThrough {
+		return rw.ResponseWriter.Write(b)
+	}
+
+	if rw.body.Len()+len(b) > rw.maxBodySize {
+		if err := rw.startPassThrough(); err != nil {
+			return 0, err
+		}
+
+		return rw.ResponseWriter.Write(b)
+	}
+
+	return rw.body.Write(b)
+}
+
+func (rw *cacheResponseWriter) Flush() {
+	if !rw.passThrough {
+		if err := rw.startPassThrough(); err != nil {
+			return
+		}
+	}
+
+	_ = http.NewResponseController(rw.ResponseWriter).Flush()
+}
+
+func (rw *cacheResponseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+func (rw *cacheResponseWriter) startPassThrough() error {
+	rw.passThrough = true
+
+	status := rw.status
+
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	rw.ResponseWriter.WriteHeader(status)
+	_, err := rw.ResponseWriter.Write(rw.body.Bytes())
+	rw.body = bytes.Buffer{}
+	return err
+}
@@ -0,0 +1,272 @@
+package mux2
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCacheMiddleware_ETagAndConditionalRequests(t *testing.T) {
+	handler := NewCacheMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		_, _ = io.WriteString(w, "<h1>Hello</h1>")
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "<h1>Hello</h1>", w.Body.String())
+	assert.Empty(t, w.Header().Get("X-Cache"), "nothing is stored without a response cache")
+
+	tests := []struct {
+		name       string
+		header     string
+		value      string
+		wantStatus int
+	}{
+		{"matching ETag", "If-None-Match", etag, http.StatusNotModified},
+		{"weak matching ETag", "If-None-Match", `"other", W/` + etag, http.StatusNotModified},
+		{"different ETag", "If-None-Match", `"other"`, http.StatusOK},
+		{"not modified since", "If-Modified-Since", "Mon, 02 Jan 2006 15:04:05 GMT", http.StatusNotModified},
+		{"modified since", "If-Modified-Since", "Sun, 01 Jan 2006 15:04:05 GMT", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.Header.Set(tt.header, tt.value)
+
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+
+			if tt.wantStatus == http.StatusNotModified {
+				assert.Empty(t, w.Body.String())
+				assert.Empty(t, w.Header().Get("Content-Type"))
+				assert.Equal(t, etag, w.Header().Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestCacheMiddleware_SkipsErrorsAndUnsafeMethods(t *testing.T) {
+	handler := NewCacheMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+
+		_, _ = io.WriteString(w, "ok")
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/missing", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, w.Header().Get("ETag"))
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("ETag"))
+}
+
+func TestCacheMiddleware_ResponseCache(t *testing.T) {
+	cache := NewResponseCache(0)
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	cache.now = func() time.Time { return now }
+
+	calls := 0
+
+	handler := NewCacheMiddleware(
+		WithResponseCache(cache, time.Minute),
+		WithCacheTags(func(r *http.Request) []string { return []string{"page:" + r.URL.Path} }, "pages"),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Vary", "Accept-Language")
+		_, _ = io.WriteString(w, r.URL.Path+" "+r.Header.Get("Accept-Language"))
+	}))
+
+	send := func(path, language string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		w.Header().Set("X-Request-ID", "outer-"+path+language)
+
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+		r.Header.Set("Accept-Language", language)
+
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	w := send("/a", "en")
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	assert.Equal(t, "/a en", w.Body.String())
+
+	now = now.Add(10 * time.Second)
+	w = send("/a", "en")
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+	assert.Equal(t, "10", w.Header().Get("Age"))
+	assert.Equal(t, "/a en", w.Body.String())
+	assert.Equal(t, "outer-/aen", w.Header().Get("X-Request-ID"), "headers from outer middlewares are not replayed")
+	assert.Equal(t, 1, calls)
+
+	w = send("/a", "fr")
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"), "responses vary by Accept-Language")
+	assert.Equal(t, "/a fr", w.Body.String())
+	assert.Equal(t, 2, calls)
+
+	send("/b", "en")
+	assert.Equal(t, 3, cache.Len())
+
+	assert.Equal(t, 2, cache.InvalidateTags("page:/a"))
+	assert.Equal(t, "MISS", send("/a", "en").Header().Get("X-Cache"))
+	assert.Equal(t, "HIT", send("/b", "en").Header().Get("X-Cache"))
+
+	now = now.Add(2 * time.Minute)
+	assert.Equal(t, "MISS", send("/b", "en").Header().Get("X-Cache"), "expired responses are not served")
+
+	assert.Equal(t, 2, cache.InvalidateTags("pages"))
+	assert.Equal(t, 0, cache.Len())
+	assert.Equal(t, int64(0), cache.Size())
+}
+
+func TestCacheMiddleware_NotStored(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		value   string
+		request func(r *http.Request)
+	}{
+		{name: "sets a cookie", header: "Set-Cookie", value: "session=abc"},
+		{name: "private", header: "Cache-Control", value: "private, max-age=60"},
+		{name: "no-store", header: "Cache-Control", value: "no-store"},
+		{name: "vary star", header: "Vary", value: "*"},
+		{name: "authorization", request: func(r *http.Request) { r.Header.Set("Authorization", "Bearer token") }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewResponseCache(0)
+
+			handler := NewCacheMiddleware(WithResponseCache(cache, time.Minute))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.header != "" {
+					w.Header().Set(tt.header, tt.value)
+				}
+
+				_, _ = io.WriteString(w, "secret")
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+			if tt.request != nil {
+				tt.request(r)
+			}
+
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+			assert.Equal(t, 0, cache.Len())
+		})
+	}
+}
+
+func TestResponseCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewResponseCache(500)
+
+	handler := NewCacheMiddleware(WithResponseCache(cache, time.Minute))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, strings.Repeat("x", 100))
+	}))
+
+	get := func(path string) string {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Header().Get("X-Cache")
+	}
+
+	get("/a")
+	get("/b")
+	assert.Equal(t, "HIT", get("/a"))
+
+	get("/c")
+	assert.LessOrEqual(t, cache.Size(), int64(500))
+	assert.Equal(t, "HIT", get("/a"), "recently used responses are kept")
+	assert.Equal(t, "MISS", get("/b"), "the least recently used response is evicted")
+}
+
+func TestCacheMiddleware_FlushPassesThrough(t *testing.T) {
+	handler := NewCacheMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "data: 1\n\n")
+		w.(http.Flusher).Flush()
+		_, _ = io.WriteString(w, "data: 2\n\n")
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/events", nil))
+
+	assert.True(t, w.Flushed)
+	assert.Empty(t, w.Header().Get("ETag"))
+	assert.Equal(t, "data: 1\n\ndata: 2\n\n", w.Body.String())
+}
+
+func TestCacheMiddleware_NotStoredWithCSRFOrNonce(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []RouterOption
+		render  func(r *http.Request) string
+	}{
+		{
+			name:    "csrf",
+			options: []RouterOption{WithCSRF()},
+			render:  CSRFToken,
+		},
+		{
+			name:    "csp nonce",
+			options: []RouterOption{WithSecurityHeaders(WithContentSecurityPolicy(DefaultContentSecurityPolicy()))},
+			render:  CSPNonce,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := NewResponseCache(0)
+			calls := 0
+
+			router := Setup(
+				Config{Host: "127.0.0.1:0"},
+				[]Route{
+					{
+						Path: "GET /form",
+						HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+							calls++
+							_, _ = io.WriteString(w, tt.render(r))
+						},
+						Middlewares: []MiddlewareFunc{NewCacheMiddleware(WithResponseCache(cache, time.Minute))},
+					},
+				},
+				nil,
+				nil,
+				tt.options...,
+			)
+
+			first := httptest.NewRecorder()
+			router.Server.Handler.ServeHTTP(first, httptest.NewRequest(http.MethodGet, "/form", nil))
+
+			second := httptest.NewRecorder()
+			router.Server.Handler.ServeHTTP(second, httptest.NewRequest(http.MethodGet, "/form", nil))
+
+			require.NotEmpty(t, first.Body.String())
+			assert.NotEqual(t, first.Body.String(), second.Body.String(), "each visitor should get their own token")
+			assert.Empty(t, second.Header().Get("X-Cache"))
+			assert.Equal(t, 2, calls)
+			assert.Equal(t, 0, cache.Len())
+		})
+	}
+}
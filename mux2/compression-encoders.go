@@ -0,0 +1,118 @@
+package mux2
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"sync"
+)
+
+/*
+An Encoder provides a content coding for the compression middleware.
+Implement this interface to add codings such as zstd. Writers are
+pooled, so Get should reuse writers returned through Put when possible.
+If a writer has a Flush() error method, it is called when the handler
+flushes the response.
+*/
+type Encoder interface {
+	/*
+	   Encoding returns the content coding name used in the Accept-Encoding
+	   and Content-Encoding headers, such as "gzip".
+	*/
+	Encoding() string
+
+	/*
+	   Get returns a writer that compresses into w.
+	*/
+	Get(w io.Writer) io.WriteCloser
+
+	/*
+	   Put returns a closed writer to the pool.
+	*/
+	Put(writer io.WriteCloser)
+}
+
+type GzipEncoder struct {
+	level int
+	pool  *sync.Pool
+}
+
+/*
+NewGzipEncoder creates a gzip encoder with the provided compression level.
+Use gzip.DefaultCompression if unsure.
+*/
+func NewGzipEncoder(level int) *GzipEncoder {
+	return &GzipEncoder{
+		level: level,
+		pool:  &sync.Pool{},
+	}
+}
+
+func (e *GzipEncoder) Encoding() string {
+	return "gzip"
+}
+
+func (e *GzipEncoder) Get(w io.Writer) io.WriteCloser {
+	if writer, ok := e.pool.Get().(*gzip.Writer); ok {
+		writer.Reset(w)
+		return writer
+	}
+
+	writer, err := gzip.NewWriterLevel(w, e.level)
+
+	if err != nil {
+		writer = gzip.NewWriter(w)
+	}
+
+	return writer
+}
+
+func (e *GzipEncoder) Put(writer io.WriteCloser) {
+	if gz, ok := writer.(*gzip.Writer); ok {
+		gz.Reset(io.Discard)
+		e.pool.Put(gz)
+	}
+}
+
+type DeflateEncoder struct {
+	level int
+	pool  *sync.Pool
+}
+
+/*
+NewDeflateEncoder creates a deflate encoder with the provided compression
+level. Use zlib.DefaultCompression if unsure. As required by the HTTP
+"deflate" coding, output is wrapped in the zlib format.
+*/
+func NewDeflateEncoder(level int) *DeflateEncoder {
+	return &DeflateEncoder{
+		level: level,
+		pool:  &sync.Pool{},
+	}
+}
+
+func (e *DeflateEncoder) Encoding() string {
+	return "deflate"
+}
+
+func (e *DeflateEncoder) Get(w io.Writer) io.WriteCloser {
+	if writer, ok := e.pool.Get().(*zlib.Writer); ok {
+		writer.Reset(w)
+		return writer
+	}
+
+	writer, err := zlib.NewWriterLevel(w, e.level)
+
+	if err != nil {
+		writer = zlib.NewWriter(w)
+	}
+
+	return writer
+}
+
+func (e *DeflateEncoder) Put(writer io.WriteCloser) {
+	if zw, ok := writer.(*zlib.Writer); ok {
+		zw.Reset(io.Discard)
+		e.pool.Put(zw)
+	}
+}
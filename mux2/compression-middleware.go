@@ -0,0 +1,466 @@
+package mux2
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const defaultCompressionMinSize = 1024
+
+/*
+defaultExcludedContentTypes are content types that are already compressed,
+so compressing them again wastes CPU for little or no gain. Entries ending
+in "/" match a whole family of types.
+*/
+var defaultExcludedContentTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"font/woff",
+	"font/woff2",
+	"application/gzip",
+	"application/x-gzip",
+	"application/zip",
+	"application/zstd",
+	"application/x-7z-compressed",
+	"application/x-bzip2",
+	"application/x-rar-compressed",
+	"application/octet-stream",
+	"application/pdf",
+}
+
+/*
+compressibleImageTypes are image types that are text based, and therefore
+benefit from compression.
+*/
+var compressibleImageTypes = []string{
+	"image/svg+xml",
+	"image/x-icon",
+	"image/vnd.microsoft.icon",
+	"image/bmp",
+}
+
+type CompressionConfig struct {
+	encoders             []Encoder
+	excludedContentTypes []string
+	excludedPaths        []string
+	minSize              int
+}
+
+type CompressionOption func(*CompressionConfig)
+
+/*
+GzipMiddlewareConfig is the configuration of the gzip middleware.
+
+Deprecated: Use CompressionConfig.
+*/
+type GzipMiddlewareConfig = CompressionConfig
+
+/*
+GzipMiddlewareConfigOption configures the gzip middleware.
+
+Deprecated: Use CompressionOption.
+*/
+type GzipMiddlewareConfigOption = CompressionOption
+
+/*
+NewCompressionMiddleware returns a middleware that compresses responses
+using the best coding the client accepts, as negotiated through the q-values
+in the Accept-Encoding header. By default gzip and deflate are offered, in
+that order of preference.
+
+Responses are left uncompressed when:
+
+  - The client does not accept any configured coding
+  - The path is excluded with WithExcludedPaths
+  - The content type is already compressed (images, video, archives, etc.)
+  - The body is smaller than the minimum size (1KB by default)
+  - The handler already set a Content-Encoding
+  - The request is a Range request or a protocol upgrade, such as WebSockets
+
+Compressed responses have Content-Length removed, "Vary: Accept-Encoding"
+added, and a strong ETag made weak. Flushing is supported, so streaming
+handlers such as SSE work. A flush before the minimum size is reached
+sends the response uncompressed.
+*/
+func NewCompressionMiddleware(options ...CompressionOption) MiddlewareFunc {
+	config := &CompressionConfig{
+		encoders:             nil,
+		excludedContentTypes: defaultExcludedContentTypes,
+		excludedPaths:        []string{},
+		minSize:              defaultCompressionMinSize,
+	}
+
+	for _, opt := range options {
+		opt(config)
+	}
+
+	if len(config.encoders) == 0 {
+		config.encoders = []Encoder{
+			NewGzipEncoder(gzip.DefaultCompression),
+			NewDeflateEncoder(zlib.DefaultCompression),
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for _, excludedPath := range config.excludedPaths {
+				if strings.HasPrefix(r.URL.Path, excludedPath) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			if isUpgradeRequest(r) || r.Header.Get("Range") != "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Accept-Encoding")
+			encoder := negotiateEncoder(r.Header.Get("Accept-Encoding"), config.encoders)
+
+			if encoder == nil || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			cw := &compressResponseWriter{
+				ResponseWriter: w,
+				config:         config,
+				encoder:        encoder,
+				status:         http.StatusOK,
+			}
+
+			defer cw.close()
+			next.ServeHTTP(cw, r)
+		})
+	}
+}
+
+/*
+NewGzipMiddleware returns a compression middleware that only offers gzip.
+
+Deprecated: Use NewCompressionMiddleware, which also negotiates deflate.
+*/
+func NewGzipMiddleware(options ...CompressionOption) MiddlewareFunc {
+	gzipOnly := []CompressionOption{WithEncoders(NewGzipEncoder(gzip.DefaultCompression))}
+	return NewCompressionMiddleware(append(gzipOnly, options...)...)
+}
+
+/*
+WithEncoders sets the codings offered to clients, in order of preference.
+*/
+func WithEncoders(encoders ...Encoder) CompressionOption {
+	return func(config *CompressionConfig) {
+		config.encoders = encoders
+	}
+}
+
+/*
+WithExcludedContentTypes adds content types that should never be compressed.
+Types ending in "/" (such as "image/") match the whole family.
+*/
+func WithExcludedContentTypes(contentTypes ...string) CompressionOption {
+	return func(config *CompressionConfig) {
+		config.excludedContentTypes = append(append([]string{}, config.excludedContentTypes...), contentTypes...)
+	}
+}
+
+/*
+WithExcludedPaths adds path prefixes that should never be compressed.
+*/
+func WithExcludedPaths(paths ...string) CompressionOption {
+	return func(config *CompressionConfig) {
+		config.excludedPaths = append(config.excludedPaths, paths...)
+	}
+}
+
+/*
+WithMinimumSize sets the smallest body, in bytes, worth compressing.
+*/
+func WithMinimumSize(size int) CompressionOption {
+	return func(config *CompressionConfig) {
+		config.minSize = size
+	}
+}
+
+/*
+negotiateEncoder picks the encoder with the highest q-value in the
+Accept-Encoding header. Ties go to the server's order of preference.
+Codings with a q-value of 0 are never used.
+*/
+func negotiateEncoder(acceptEncoding string, encoders []Encoder) Encoder {
+	var (
+		best      Encoder
+		bestValue float64
+	)
+
+	if acceptEncoding == "" {
+		return nil
+	}
+
+	values := parseAcceptEncoding(acceptEncoding)
+
+	for _, encoder := range encoders {
+		q, ok := values[encoder.Encoding()]
+
+		if !ok {
+			q, ok = values["*"]
+		}
+
+		if ok && q > bestValue {
+			best = encoder
+			bestValue = q
+		}
+	}
+
+	return best
+}
+
+/*
+parseAcceptEncoding returns the q-value of each coding in an Accept-Encoding
+header. Codings without a q-value have a value of 1.
+*/
+func parseAcceptEncoding(acceptEncoding string) map[string]float64 {
+	values := map[string]float64{}
+
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		coding = strings.ToLower(strings.TrimSpace(coding))
+
+		if coding == "" {
+			continue
+		}
+
+		q := 1.0
+
+		for _, param := range strings.Split(params, ";") {
+			name, value, found := strings.Cut(strings.TrimSpace(param), "=")
+
+			if found && strings.EqualFold(strings.TrimSpace(name), "q") {
+				if parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+
+		values[coding] = q
+	}
+
+	return values
+}
+
+func isUpgradeRequest(r *http.Request) bool {
+	for _, value := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func isCompressibleContentType(contentType string, excluded []string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+
+	if err != nil {
+		mediaType = strings.ToLower(strings.TrimSpace(contentType))
+	}
+
+	for _, compressible := range compressibleImageTypes {
+		if mediaType == compressible {
+			return true
+		}
+	}
+
+	for _, excludedType := range excluded {
+		if strings.HasSuffix(excludedType, "/") && strings.HasPrefix(mediaType, excludedType) {
+			return false
+		}
+
+		if mediaType == excludedType {
+			return false
+		}
+	}
+
+	return true
+}
+
+/*
+compressResponseWriter buffers the start of a response until it knows
+whether the response is worth compressing, then either streams through
+the encoder or writes directly to the client.
+*/
+type compressResponseWriter struct {
+	http.ResponseWriter
+
+	buf         []byte
+	compressing bool
+	config      *CompressionConfig
+	decided     bool
+	encoder     Encoder
+	hijacked    bool
+	status      int
+	wroteHeader bool
+	writer      io.WriteCloser
+}
+
+func (w *compressResponseWriter) WriteHeader(status int) {
+	if w.wroteHeader || w.decided {
+		return
+	}
+
+	if status >= 100 && status < 200 && status != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	w.status = status
+	w.wroteHeader = true
+
+	/*
+	 * Responses without a body can be sent straight away.
+	 */
+	if status == http.StatusNoContent || status == http.StatusNotModified || status == http.StatusSwitchingProtocols {
+		w.decide(false)
+	}
+}
+
+func (w *compressResponseWriter) Write(b []byte) (int, error) {
+	if !w.decided {
+		w.buf = append(w.buf, b...)
+
+		if len(w.buf) < w.config.minSize {
+			return len(b), nil
+		}
+
+		if err := w.commit(true); err != nil {
+			return 0, err
+		}
+
+		return len(b), nil
+	}
+
+	if w.compressing {
+		return w.writer.Write(b)
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *compressResponseWriter) Flush() {
+	if !w.decided {
+		_ = w.commit(len(w.buf) >= w.config.minSize)
+	}
+
+	if w.compressing {
+		if flusher, ok := w.writer.(interface{ Flush() error }); ok {
+			_ = flusher.Flush()
+		}
+	}
+
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *compressResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+
+	w.decided = true
+	w.hijacked = true
+	return hijacker.Hijack()
+}
+
+func (w *compressResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+/*
+commit decides whether to compress, sends the headers, and writes any
+buffered bytes.
+*/
+func (w *compressResponseWriter) commit(largeEnough bool) error {
+	w.decide(largeEnough)
+
+	if len(w.buf) == 0 {
+		return nil
+	}
+
+	buf := w.buf
+	w.buf = nil
+
+	var err error
+
+	if w.compressing {
+		_, err = w.writer.Write(buf)
+	} else {
+		_, err = w.ResponseWriter.Write(buf)
+	}
+
+	return err
+}
+
+func (w *compressResponseWriter) decide(largeEnough bool) {
+	if w.decided {
+		return
+	}
+
+	w.decided = true
+	header := w.ResponseWriter.Header()
+
+	if header.Get("Content-Type") == "" && len(w.buf) > 0 {
+		header.Set("Content-Type", http.DetectContentType(w.buf))
+	}
+
+	w.compressing = largeEnough &&
+		header.Get("Content-Encoding") == "" &&
+		w.status != http.StatusNoContent &&
+		w.status != http.StatusNotModified &&
+		w.status != http.StatusPartialContent &&
+		isCompressibleContentType(header.Get("Content-Type"), w.config.excludedContentTypes)
+
+	if w.compressing {
+		/*
+		 * The compressed bytes differ from the uncompressed ones, so they
+		 * can't share a strong validator. A weak one still matches in
+		 * If-None-Match.
+		 */
+		if etag := header.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			header.Set("ETag", "W/"+etag)
+		}
+
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", w.encoder.Encoding())
+		w.writer = w.encoder.Get(w.ResponseWriter)
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+func (w *compressResponseWriter) close() {
+	if w.hijacked {
+		return
+	}
+
+	if !w.decided {
+		_ = w.commit(len(w.buf) >= w.config.minSize)
+	}
+
+	if w.compressing {
+		_ = w.writer.Close()
+		w.encoder.Put(w.writer)
+	}
+}
@@ -0,0 +1,173 @@
+package mux2
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateEncoder(t *testing.T) {
+	encoders := []Encoder{NewGzipEncoder(gzip.DefaultCompression), NewDeflateEncoder(zlib.DefaultCompression)}
+
+	testCases := []struct {
+		acceptEncoding string
+		expected       string
+	}{
+		{acceptEncoding: "", expected: ""},
+		{acceptEncoding: "gzip, deflate, br", expected: "gzip"},
+		{acceptEncoding: "deflate", expected: "deflate"},
+		{acceptEncoding: "gzip;q=0.5, deflate;q=0.8", expected: "deflate"},
+		{acceptEncoding: "gzip;q=0, deflate;q=0", expected: ""},
+		{acceptEncoding: "*", expected: "gzip"},
+		{acceptEncoding: "gzip;q=0, *;q=0.1", expected: "deflate"},
+		{acceptEncoding: "br, identity", expected: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.acceptEncoding, func(t *testing.T) {
+			got := ""
+
+			if encoder := negotiateEncoder(tc.acceptEncoding, encoders); encoder != nil {
+				got = encoder.Encoding()
+			}
+
+			assert.Equal(t, tc.expected, got)
+		})
+	}
+}
+
+func TestNewCompressionMiddleware(t *testing.T) {
+	largeBody := strings.Repeat("hello world ", 200)
+
+	serve := func(handler http.HandlerFunc, acceptEncoding string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", acceptEncoding)
+
+		NewCompressionMiddleware()(handler).ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("Compresses large text responses", func(t *testing.T) {
+		w := serve(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/html")
+			w.Header().Set("Content-Length", "2400")
+			_, _ = io.WriteString(w, largeBody)
+		}, "gzip")
+
+		assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+		assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+		assert.Empty(t, w.Header().Get("Content-Length"))
+
+		reader, err := gzip.NewReader(w.Body)
+		require.NoError(t, err)
+		body, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		assert.Equal(t, largeBody, string(body))
+	})
+
+	t.Run("Compresses with deflate", func(t *testing.T) {
+		w := serve(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, largeBody)
+		}, "deflate")
+
+		assert.Equal(t, "deflate", w.Header().Get("Content-Encoding"))
+
+		reader, err := zlib.NewReader(w.Body)
+		require.NoError(t, err)
+		body, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		assert.Equal(t, largeBody, string(body))
+	})
+
+	t.Run("Skips small responses", func(t *testing.T) {
+		w := serve(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+			_, _ = io.WriteString(w, "small")
+		}, "gzip")
+
+		assert.Empty(t, w.Header().Get("Content-Encoding"))
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, "small", w.Body.String())
+	})
+
+	t.Run("Skips compressed content types", func(t *testing.T) {
+		w := serve(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = io.WriteString(w, largeBody)
+		}, "gzip")
+
+		assert.Empty(t, w.Header().Get("Content-Encoding"))
+		assert.Equal(t, largeBody, w.Body.String())
+	})
+
+	t.Run("Flushing preserves streaming", func(t *testing.T) {
+		w := serve(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = io.WriteString(w, "data: hello\n\n")
+
+			flusher, ok := w.(http.Flusher)
+			require.True(t, ok)
+			flusher.Flush()
+
+			_, _ = io.WriteString(w, "data: world\n\n")
+		}, "gzip")
+
+		assert.True(t, w.Flushed)
+		assert.Empty(t, w.Header().Get("Content-Encoding"))
+		assert.Equal(t, "data: hello\n\ndata: world\n\n", w.Body.String())
+	})
+
+	t.Run("Skips excluded paths", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/sse", nil)
+		r.Header.Set("Accept-Encoding", "gzip")
+
+		handler := NewCompressionMiddleware(WithExcludedPaths("/sse"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, largeBody)
+		}))
+
+		handler.ServeHTTP(w, r)
+		assert.Empty(t, w.Header().Get("Content-Encoding"))
+	})
+}
+
+func TestNewCompressionMiddleware_WeakensETag(t *testing.T) {
+	body := strings.Repeat("hello world ", 200)
+
+	handler := NewCompressionMiddleware()(NewCacheMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = io.WriteString(w, body)
+	})))
+
+	send := func(acceptEncoding, ifNoneMatch string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept-Encoding", acceptEncoding)
+
+		if ifNoneMatch != "" {
+			r.Header.Set("If-None-Match", ifNoneMatch)
+		}
+
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	compressed := send("gzip", "")
+	assert.Equal(t, "gzip", compressed.Header().Get("Content-Encoding"))
+	assert.Equal(t, `W/"v1"`, compressed.Header().Get("ETag"), "compressed responses must not share a strong ETag")
+
+	identity := send("identity", "")
+	assert.Empty(t, identity.Header().Get("Content-Encoding"))
+	assert.Equal(t, `"v1"`, identity.Header().Get("ETag"))
+
+	assert.Equal(t, http.StatusNotModified, send("gzip", `W/"v1"`).Code, "the weak ETag still matches")
+}
@@ -0,0 +1,364 @@
+package mux2
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	gorillasessions "github.com/gorilla/sessions"
+)
+
+const (
+	CSRFCookieName = "csrf_token"
+	CSRFFieldName  = "csrf_token"
+	CSRFHeaderName = "X-CSRF-Token"
+)
+
+const (
+	csrfHostCookiePrefix = "__Host-"
+	csrfSessionKey       = "csrfToken"
+	csrfSessionName      = "csrf"
+	csrfTokenLength      = 32
+
+	// csrfMaxFormMemory matches the default used by http.Request.FormValue
+	csrfMaxFormMemory = 32 << 20
+)
+
+var (
+	ErrCSRFTokenMissing = fmt.Errorf("CSRF token missing")
+	ErrCSRFTokenInvalid = fmt.Errorf("CSRF token invalid")
+)
+
+type CSRFConfig struct {
+	CookieName    string
+	CookieDomain  string
+	CookiePath    string
+	ExcludedPaths []string
+	FieldName     string
+	HeaderName    string
+	SessionName   string
+	SessionStore  gorillasessions.Store
+}
+
+type CSRFOption func(c *CSRFConfig)
+
+type csrfContextKey struct{}
+
+type csrfContext struct {
+	fieldName string
+	token     []byte
+}
+
+/*
+NewCSRFMiddleware protects unsafe requests (anything other than GET, HEAD,
+OPTIONS, and TRACE) from cross-site request forgery. Each visitor is issued
+a random token. Unsafe requests must send it back in the X-CSRF-Token header
+or the csrf_token form field, otherwise they are rejected with a 403.
+
+By default the token is stored in a cookie and compared with the submitted
+value (the double-submit cookie pattern). Over HTTPS, including behind a
+trusted proxy (see WithTrustedProxies), the cookie is Secure and its name
+gets the "__Host-" prefix, so sibling subdomains can't set it. Use
+WithCSRFSessionStore to store it in a session instead. Handlers get the token for the current request
+with CSRFToken. The token is masked with a fresh random value on every
+request, so it is safe to render into compressed HTML.
+*/
+func NewCSRFMiddleware(options ...CSRFOption) MiddlewareFunc {
+	config := &CSRFConfig{
+		CookieName:    CSRFCookieName,
+		CookiePath:    "/",
+		ExcludedPaths: []string{},
+		FieldName:     CSRFFieldName,
+		HeaderName:    CSRFHeaderName,
+		SessionName:   csrfSessionName,
+	}
+
+	for _, opt := range options {
+		opt(config)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			token, isNew, err := config.getOrCreateToken(w, r)
+
+			if err != nil {
+				slog.Error("error getting CSRF token", slog.Any("error", err), slog.String("path", r.URL.Path))
+				WriteError(w, r, http.StatusInternalServerError, err)
+				return
+			}
+
+			if !isSafeMethod(r.Method) && !config.isExcluded(r.URL.Path) {
+				if isNew {
+					err = ErrCSRFTokenMissing
+				} else {
+					err = config.validate(r, token)
+				}
+
+				var maxBytesErr *http.MaxBytesError
+
+				if errors.As(err, &maxBytesErr) {
+					writeRequestEntityTooLarge(w, r)
+					return
+				}
+
+				if err != nil {
+					slog.Warn("rejected request", slog.Any("error", err), slog.String("method", r.Method), slog.String("path", r.URL.Path))
+					WriteError(w, r, http.StatusForbidden, err)
+					return
+				}
+			}
+
+			/*
+			 * Every response may render the masked token, so none of them
+			 * can be shared with other visitors.
+			 */
+			markPersonalized(r.Context())
+
+			ctx := context.WithValue(r.Context(), csrfContextKey{}, &csrfContext{fieldName: config.FieldName, token: token})
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+/*
+WithCSRFCookie sets the name, path, and domain of the cookie used in
+double-submit cookie mode. The defaults are "csrf_token", "/", and
+the request host. The "__Host-" prefix is only added with a path of "/"
+and no domain, so setting either lets subdomains overwrite the cookie.
+*/
+func WithCSRFCookie(name, path, domain string) CSRFOption {
+	return func(c *CSRFConfig) {
+		c.CookieName = name
+		c.CookiePath = path
+		c.CookieDomain = domain
+	}
+}
+
+/*
+WithCSRFExcludedPaths skips token validation for any paths starting
+with one of paths, such as webhook endpoints.
+*/
+func WithCSRFExcludedPaths(paths ...string) CSRFOption {
+	return func(c *CSRFConfig) {
+		c.ExcludedPaths = append(c.ExcludedPaths, paths...)
+	}
+}
+
+/*
+WithCSRFFieldName sets the form field the token is read from.
+The default is "csrf_token".
+*/
+func WithCSRFFieldName(name string) CSRFOption {
+	return func(c *CSRFConfig) {
+		c.FieldName = name
+	}
+}
+
+/*
+WithCSRFHeaderName sets the header the token is read from.
+The default is "X-CSRF-Token".
+*/
+func WithCSRFHeaderName(name string) CSRFOption {
+	return func(c *CSRFConfig) {
+		c.HeaderName = name
+	}
+}
+
+/*
+WithCSRFSessionStore stores the token in a gorilla session named
+sessionName instead of a cookie. This can share the store used for
+your application's sessions.
+*/
+func WithCSRFSessionStore(store gorillasessions.Store, sessionName string) CSRFOption {
+	return func(c *CSRFConfig) {
+		c.SessionStore = store
+		c.SessionName = sessionName
+	}
+}
+
+/*
+CSRFToken returns the masked CSRF token for the current request. Render
+it into forms, or into an htmx hx-headers attribute. This returns an empty
+string if the CSRF middleware did not run for this request.
+*/
+func CSRFToken(r *http.Request) string {
+	state, ok := r.Context().Value(csrfContextKey{}).(*csrfContext)
+
+	if !ok {
+		return ""
+	}
+
+	return maskCSRFToken(state.token)
+}
+
+/*
+CSRFTokenFieldName returns the form field the CSRF middleware reads the
+token from, as set with WithCSRFFieldName. Put it in your view model next
+to the token, so rendered forms use the same name. This returns
+"csrf_token" if the CSRF middleware did not run for this request.
+*/
+func CSRFTokenFieldName(r *http.Request) string {
+	state, ok := r.Context().Value(csrfContextKey{}).(*csrfContext)
+
+	if !ok {
+		return CSRFFieldName
+	}
+
+	return state.fieldName
+}
+
+/*
+CSRFTemplateField returns a hidden form input containing the CSRF token
+for the current request, using the configured field name.
+*/
+func CSRFTemplateField(r *http.Request) template.HTML {
+	return template.HTML(fmt.Sprintf(`<input type="hidden" name="%s" value="%s" />`, template.HTMLEscapeString(CSRFTokenFieldName(r)), template.HTMLEscapeString(CSRFToken(r))))
+}
+
+func (c *CSRFConfig) getOrCreateToken(w http.ResponseWriter, r *http.Request) ([]byte, bool, error) {
+	if c.SessionStore != nil {
+		return c.getOrCreateSessionToken(w, r)
+	}
+
+	secure := r.TLS != nil || r.URL.Scheme == "https"
+	name := c.cookieName(secure)
+
+	if cookie, err := r.Cookie(name); err == nil {
+		if token, err := base64.RawURLEncoding.DecodeString(cookie.Value); err == nil && len(token) == csrfTokenLength {
+			return token, false, nil
+		}
+	}
+
+	token := newCSRFToken()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    base64.RawURLEncoding.EncodeToString(token),
+		Path:     c.CookiePath,
+		Domain:   c.CookieDomain,
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return token, true, nil
+}
+
+/*
+cookieName returns the name of the token cookie. Browsers only accept
+"__Host-" cookies that are Secure, have a path of "/", and no domain,
+which stops sibling subdomains from planting a token they know.
+*/
+func (c *CSRFConfig) cookieName(secure bool) string {
+	if secure && c.CookiePath == "/" && c.CookieDomain == "" {
+		return csrfHostCookiePrefix + c.CookieName
+	}
+
+	return c.CookieName
+}
+
+func (c *CSRFConfig) getOrCreateSessionToken(w http.ResponseWriter, r *http.Request) ([]byte, bool, error) {
+	session, err := c.SessionStore.Get(r, c.SessionName)
+
+	if err != nil && session == nil {
+		return nil, false, fmt.Errorf("error getting CSRF session: %w", err)
+	}
+
+	if token, ok := session.Values[csrfSessionKey].([]byte); ok && len(token) == csrfTokenLength {
+		return token, false, nil
+	}
+
+	token := newCSRFToken()
+	session.Values[csrfSessionKey] = token
+
+	if err = session.Save(r, w); err != nil {
+		return nil, false, fmt.Errorf("error saving CSRF session: %w", err)
+	}
+
+	return token, true, nil
+}
+
+func (c *CSRFConfig) isExcluded(path string) bool {
+	for _, excluded := range c.ExcludedPaths {
+		if strings.HasPrefix(path, excluded) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *CSRFConfig) validate(r *http.Request, token []byte) error {
+	submitted := r.Header.Get(c.HeaderName)
+
+	if submitted == "" {
+		var maxBytesErr *http.MaxBytesError
+
+		if err := r.ParseMultipartForm(csrfMaxFormMemory); errors.As(err, &maxBytesErr) {
+			return err
+		}
+
+		submitted = r.PostFormValue(c.FieldName)
+	}
+
+	if submitted == "" {
+		return ErrCSRFTokenMissing
+	}
+
+	unmasked, ok := unmaskCSRFToken(submitted)
+
+	if !ok || subtle.ConstantTimeCompare(unmasked, token) != 1 {
+		return ErrCSRFTokenInvalid
+	}
+
+	return nil
+}
+
+func newCSRFToken() []byte {
+	token := make([]byte, csrfTokenLength)
+	_, _ = rand.Read(token)
+	return token
+}
+
+/*
+maskCSRFToken XORs the token with a one-time pad and prepends the pad.
+This prevents BREACH style attacks against compressed responses, as the
+rendered value changes on every request.
+*/
+func maskCSRFToken(token []byte) string {
+	pad := newCSRFToken()
+	masked := make([]byte, csrfTokenLength*2)
+
+	copy(masked, pad)
+	subtle.XORBytes(masked[csrfTokenLength:], token, pad)
+
+	return base64.RawURLEncoding.EncodeToString(masked)
+}
+
+func unmaskCSRFToken(value string) ([]byte, bool) {
+	masked, err := base64.RawURLEncoding.DecodeString(value)
+
+	if err != nil || len(masked) != csrfTokenLength*2 {
+		return nil, false
+	}
+
+	token := make([]byte, csrfTokenLength)
+	subtle.XORBytes(token, masked[csrfTokenLength:], masked[:csrfTokenLength])
+	return token, true
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,210 @@
+package mux2
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	gorillasessions "github.com/gorilla/sessions"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newCSRFTestHandler(options ...CSRFOption) http.Handler {
+	return NewCSRFMiddleware(options...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, CSRFToken(r))
+	}))
+}
+
+/*
+getCSRFToken makes a GET request and returns the rendered token
+along with the cookies set by the response.
+*/
+func getCSRFToken(t *testing.T, handler http.Handler, cookies ...*http.Cookie) (string, []*http.Cookie) {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/form", nil)
+
+	for _, cookie := range cookies {
+		r.AddCookie(cookie)
+	}
+
+	handler.ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	return w.Body.String(), w.Result().Cookies()
+}
+
+func TestCSRFMiddleware_DoubleSubmitCookie(t *testing.T) {
+	handler := newCSRFTestHandler()
+	token, cookies := getCSRFToken(t, handler)
+
+	require.NotEmpty(t, token)
+	require.Len(t, cookies, 1)
+	assert.Equal(t, CSRFCookieName, cookies[0].Name)
+	assert.True(t, cookies[0].HttpOnly)
+
+	secondToken, _ := getCSRFToken(t, handler, cookies...)
+	assert.NotEqual(t, token, secondToken, "tokens should be masked differently on every request")
+
+	tests := []struct {
+		name       string
+		header     string
+		form       string
+		cookies    []*http.Cookie
+		wantStatus int
+	}{
+		{"header", token, "", cookies, http.StatusOK},
+		{"form field", "", token, cookies, http.StatusOK},
+		{"second masked token", secondToken, "", cookies, http.StatusOK},
+		{"missing token", "", "", cookies, http.StatusForbidden},
+		{"wrong token", maskCSRFToken(newCSRFToken()), "", cookies, http.StatusForbidden},
+		{"garbage token", "not-a-token", "", cookies, http.StatusForbidden},
+		{"missing cookie", token, "", nil, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{}
+
+			if tt.form != "" {
+				form.Set(CSRFFieldName, tt.form)
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/form", strings.NewReader(form.Encode()))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+			if tt.header != "" {
+				r.Header.Set(CSRFHeaderName, tt.header)
+			}
+
+			for _, cookie := range tt.cookies {
+				r.AddCookie(cookie)
+			}
+
+			handler.ServeHTTP(w, r)
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
+
+func TestCSRFMiddleware_SessionStore(t *testing.T) {
+	store := gorillasessions.NewCookieStore([]byte("0123456789abcdef0123456789abcdef"))
+	handler := newCSRFTestHandler(WithCSRFSessionStore(store, "app-session"))
+
+	token, cookies := getCSRFToken(t, handler)
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "app-session", cookies[0].Name)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodDelete, "/things/1", nil)
+	r.Header.Set(CSRFHeaderName, token)
+	r.AddCookie(cookies[0])
+
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestCSRFMiddleware_ExcludedPaths(t *testing.T) {
+	handler := newCSRFTestHandler(WithCSRFExcludedPaths("/webhooks"))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/webhooks/stripe", nil)
+
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestCSRFMiddleware_JsonRejection(t *testing.T) {
+	handler := newCSRFTestHandler()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/api/things", strings.NewReader("{}"))
+	r.Header.Set("Content-Type", "application/json")
+
+	handler.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "json")
+}
+
+func TestCSRFMiddleware_SecureCookie(t *testing.T) {
+	handler := newCSRFTestHandler()
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://example.com/form", nil))
+
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, "__Host-"+CSRFCookieName, cookies[0].Name)
+	assert.True(t, cookies[0].Secure)
+	assert.Empty(t, cookies[0].Domain)
+
+	t.Run("A cookie without the prefix is ignored over HTTPS", func(t *testing.T) {
+		token := newCSRFToken()
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "https://example.com/form", nil)
+		r.Header.Set(CSRFHeaderName, maskCSRFToken(token))
+		r.AddCookie(&http.Cookie{Name: CSRFCookieName, Value: base64.RawURLEncoding.EncodeToString(token)})
+
+		handler.ServeHTTP(w, r)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("The scheme from a trusted proxy is honored", func(t *testing.T) {
+		router := Setup(
+			Config{Host: "127.0.0.1:0"},
+			[]Route{{Path: "GET /form", HandlerFunc: func(w http.ResponseWriter, r *http.Request) {}}},
+			context.Background(),
+			func() {},
+
+			WithCSRF(),
+			WithTrustedProxies("192.0.2.0/24"),
+		)
+
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/form", nil)
+		r.Header.Set("X-Forwarded-Proto", "https")
+
+		router.Server.Handler.ServeHTTP(w, r)
+
+		cookies := w.Result().Cookies()
+		require.Len(t, cookies, 1)
+		assert.Equal(t, "__Host-"+CSRFCookieName, cookies[0].Name)
+		assert.True(t, cookies[0].Secure)
+	})
+}
+
+func TestCSRFMiddleware_CustomFieldName(t *testing.T) {
+	handler := NewCSRFMiddleware(WithCSRFFieldName("authenticity_token"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, string(CSRFTemplateField(r)))
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/form", nil))
+
+	field := w.Body.String()
+	assert.Contains(t, field, `name="authenticity_token"`)
+
+	token := field[strings.Index(field, `value="`)+len(`value="`) : strings.LastIndex(field, `"`)]
+
+	form := url.Values{}
+	form.Set("authenticity_token", token)
+
+	w2 := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/form", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.AddCookie(w.Result().Cookies()[0])
+
+	handler.ServeHTTP(w2, r)
+	assert.Equal(t, http.StatusOK, w2.Code)
+
+	assert.Equal(t, CSRFFieldName, CSRFTokenFieldName(httptest.NewRequest(http.MethodGet, "/", nil)))
+}
@@ -0,0 +1,253 @@
+package mux2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/adampresley/adamgokit/rendering"
+)
+
+/*
+An ErrorHandler writes an error response. err may be nil. Errors for
+statuses below 500 are meant for the client, and their message may be
+shown. Messages of server errors should not be shown.
+*/
+type ErrorHandler func(w http.ResponseWriter, r *http.Request, status int, err error)
+
+/*
+ProblemDetails is an RFC 9457 problem details response body, sent to API
+clients as application/problem+json.
+*/
+type ProblemDetails struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Instance  string `json:"instance,omitempty"`
+	RequestID string `json:"requestId,omitempty"`
+}
+
+/*
+ErrorViewModel is the data passed to the error page template by
+NewTemplateErrorHandler.
+*/
+type ErrorViewModel struct {
+	rendering.BaseViewModel
+
+	Detail    string
+	Path      string
+	RequestID string
+	Status    int
+	Title     string
+}
+
+type errorHandlerContextKey struct{}
+
+/*
+WriteError writes an error response using the router's error handler
+(see WithErrorHandler), or DefaultErrorHandler if there isn't one.
+*/
+func WriteError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	if handler, ok := r.Context().Value(errorHandlerContextKey{}).(ErrorHandler); ok {
+		handler(w, r, status, err)
+		return
+	}
+
+	DefaultErrorHandler(w, r, status, err)
+}
+
+/*
+DefaultErrorHandler sends a small HTML page to browsers and htmx requests,
+and problem details JSON to everything else.
+*/
+func DefaultErrorHandler(w http.ResponseWriter, r *http.Request, status int, err error) {
+	if wantsHtml(r) {
+		title := template.HTMLEscapeString(http.StatusText(status))
+		detail := template.HTMLEscapeString(errorDetail(status, err))
+
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.WriteHeader(status)
+
+		if detail == "" {
+			_, _ = fmt.Fprintf(w, "<h1>%s</h1>", title)
+			return
+		}
+
+		_, _ = fmt.Fprintf(w, "<h1>%s</h1><p>%s</p>", title, detail)
+		return
+	}
+
+	WriteProblemDetails(w, r, status, err)
+}
+
+/*
+WriteProblemDetails writes an RFC 9457 problem details response.
+*/
+func WriteProblemDetails(w http.ResponseWriter, r *http.Request, status int, err error) {
+	problem := ProblemDetails{
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    errorDetail(status, err),
+		Instance:  r.URL.Path,
+		RequestID: RequestIDFromContext(r.Context()),
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(problem)
+}
+
+/*
+NewTemplateErrorHandler renders error pages for browsers and htmx requests
+with templateName (such as "pages/error"), passing an ErrorViewModel.
+API clients get problem details JSON. If the template fails to render,
+DefaultErrorHandler is used.
+*/
+func NewTemplateErrorHandler(renderer rendering.TemplateRenderer, templateName string) ErrorHandler {
+	return func(w http.ResponseWriter, r *http.Request, status int, err error) {
+		if !wantsHtml(r) {
+			WriteProblemDetails(w, r, status, err)
+			return
+		}
+
+		viewModel := ErrorViewModel{
+			BaseViewModel: rendering.BaseViewModel{
+				CSPNonce:      CSPNonce(r),
+				CSRFFieldName: CSRFTokenFieldName(r),
+				CSRFToken:     CSRFToken(r),
+				IsError:       true,
+			},
+			Detail:    errorDetail(status, err),
+			Path:      r.URL.Path,
+			RequestID: RequestIDFromContext(r.Context()),
+			Status:    status,
+			Title:     http.StatusText(status),
+		}
+
+		buffer := &bytes.Buffer{}
+
+		if renderErr := renderer.Render(templateName, viewModel, buffer); renderErr != nil {
+			RequestLogger(r).Error("error rendering error page", slog.String("template", templateName), slog.Any("error", renderErr))
+			DefaultErrorHandler(w, r, status, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(status)
+		_, _ = w.Write(buffer.Bytes())
+	}
+}
+
+/*
+errorDetail returns the message to show the client. Server error
+messages may contain internal details, so they are never shown.
+*/
+func errorDetail(status int, err error) string {
+	if err == nil || status >= 500 {
+		return ""
+	}
+
+	return err.Error()
+}
+
+func newErrorHandlerMiddleware(handler ErrorHandler) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), errorHandlerContextKey{}, handler)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+/*
+errorPagesHandler sends requests that don't match a route to the not
+found and method not allowed handlers, instead of the ServeMux defaults.
+*/
+type errorPagesHandler struct {
+	methodNotAllowed http.Handler
+	mux              *http.ServeMux
+	notFound         http.Handler
+}
+
+func newErrorPagesHandler(opts *routerConfig, m *http.ServeMux) http.Handler {
+	result := &errorPagesHandler{
+		methodNotAllowed: opts.methodNotAllowed,
+		mux:              m,
+		notFound:         opts.notFound,
+	}
+
+	if result.methodNotAllowed == nil {
+		result.methodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			WriteError(w, r, http.StatusMethodNotAllowed, nil)
+		})
+	}
+
+	if result.notFound == nil {
+		result.notFound = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			WriteError(w, r, http.StatusNotFound, nil)
+		})
+	}
+
+	return result
+}
+
+var probeMethods = []string{
+	http.MethodGet,
+	http.MethodHead,
+	http.MethodPost,
+	http.MethodPut,
+	http.MethodPatch,
+	http.MethodDelete,
+	http.MethodOptions,
+	http.MethodConnect,
+	http.MethodTrace,
+}
+
+func (h *errorPagesHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if _, pattern := h.mux.Handler(r); pattern != "" {
+		h.mux.ServeHTTP(w, r)
+		return
+	}
+
+	if allowed := h.allowedMethods(r); len(allowed) > 0 {
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		h.methodNotAllowed.ServeHTTP(w, r)
+		return
+	}
+
+	h.notFound.ServeHTTP(w, r)
+}
+
+/*
+allowedMethods returns the methods that have a route for the request
+path. ServeMux only reports a pattern when the method matches, so each
+method is tried in turn. Unmatched requests are often scanners, so the
+probe is a shallow copy that shares the request's URL and headers.
+*/
+func (h *errorPagesHandler) allowedMethods(r *http.Request) []string {
+	result := []string{}
+	probe := *r
+
+	for _, method := range probeMethods {
+		if method == r.Method {
+			continue
+		}
+
+		probe.Method = method
+
+		if _, pattern := h.mux.Handler(&probe); pattern != "" {
+			result = append(result, method)
+		}
+	}
+
+	return result
+}
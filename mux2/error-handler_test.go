@@ -0,0 +1,153 @@
+package mux2
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/adampresley/adamgokit/rendering"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newErrorTestRouter(options ...RouterOption) http.Handler {
+	routes := []Route{
+		{Path: "GET /things/{id}", HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+			if r.PathValue("id") == "missing" {
+				WriteError(w, r, http.StatusNotFound, fmt.Errorf("thing %s does not exist", r.PathValue("id")))
+				return
+			}
+
+			_, _ = io.WriteString(w, "thing "+r.PathValue("id"))
+		}},
+		{Path: "DELETE /things/{id}", HandlerFunc: func(w http.ResponseWriter, r *http.Request) {}},
+	}
+
+	return Setup(Config{Host: "127.0.0.1:0"}, routes, nil, nil, options...).Server.Handler
+}
+
+func TestRouter_NotFoundAndMethodNotAllowed(t *testing.T) {
+	handler := newErrorTestRouter(WithRequestID())
+
+	t.Run("matched routes still work", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/things/1", nil))
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "thing 1", w.Body.String())
+	})
+
+	t.Run("not found as problem details", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/nope", nil)
+		r.Header.Set("Accept", "application/json")
+
+		handler.ServeHTTP(w, r)
+
+		problem := ProblemDetails{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+		assert.Equal(t, "Not Found", problem.Title)
+		assert.Equal(t, "/nope", problem.Instance)
+		assert.Equal(t, w.Header().Get(RequestIDHeader), problem.RequestID)
+	})
+
+	t.Run("not found as HTML", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/nope", nil)
+		r.Header.Set("Accept", "text/html")
+
+		handler.ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "<h1>Not Found</h1>", w.Body.String())
+	})
+
+	t.Run("method not allowed", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/things/1", nil))
+
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+		assert.Equal(t, "GET, HEAD, DELETE", w.Header().Get("Allow"))
+	})
+
+	t.Run("client error details are shown", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/things/missing", nil))
+
+		problem := ProblemDetails{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+		assert.Equal(t, "thing missing does not exist", problem.Detail)
+	})
+}
+
+func TestRouter_CustomNotFoundHandler(t *testing.T) {
+	handler := newErrorTestRouter(
+		WithNotFoundHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		})),
+		WithMethodNotAllowedHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusConflict)
+		})),
+	)
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/nope", nil))
+	assert.Equal(t, http.StatusTeapot, w.Code)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/things/1", nil))
+	assert.Equal(t, http.StatusConflict, w.Code)
+}
+
+func TestTemplateErrorHandler(t *testing.T) {
+	templateFS := fstest.MapFS{
+		"app/pages/error.html": {Data: []byte(`{{define "pages/error"}}<h1>{{.Status}} {{.Title}}</h1><p>{{.Detail}}</p>{{end}}`)},
+	}
+
+	renderer, err := rendering.NewGoTemplateRenderer(templateFS)
+	require.NoError(t, err)
+
+	handler := newErrorTestRouter(
+		WithErrorHandler(NewTemplateErrorHandler(renderer, "pages/error")),
+		WithRecovery(),
+	)
+
+	t.Run("HTML requests render the template", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/things/missing", nil)
+		r.Header.Set("Accept", "text/html")
+
+		handler.ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+		assert.Equal(t, "<h1>404 Not Found</h1><p>thing missing does not exist</p>", w.Body.String())
+	})
+
+	t.Run("API requests get problem details", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/nope", nil))
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+		assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+	})
+}
+
+func TestWriteError_HidesServerErrorDetails(t *testing.T) {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+	WriteError(w, r, http.StatusInternalServerError, fmt.Errorf("connection to db-internal:5432 refused"))
+
+	problem := ProblemDetails{}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &problem))
+	assert.Empty(t, problem.Detail)
+	assert.Equal(t, "Internal Server Error", problem.Title)
+}
@@ -0,0 +1,240 @@
+package mux2
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+)
+
+const defaultHealthCheckTimeout = 5 * time.Second
+
+/*
+A HealthCheck is a named dependency check used to decide if the application
+is ready to receive traffic. Check should return an error if the dependency
+is unavailable. Each check runs with its own Timeout (5 seconds if not set).
+If CacheFor is set, results are reused for that long so frequent probes
+don't overwhelm the dependency.
+
+For example, to check that an S3 bucket exists:
+
+	mux2.HealthCheck{
+	  Name:     "s3",
+	  CacheFor: 30 * time.Second,
+	  Check: func(ctx context.Context) error {
+	    exists, err := s3Client.BucketExists("uploads")
+
+	    if err == nil && !exists {
+	      err = fmt.Errorf("bucket 'uploads' does not exist")
+	    }
+
+	    return err
+	  },
+	}
+*/
+type HealthCheck struct {
+	Name     string
+	Check    func(ctx context.Context) error
+	Timeout  time.Duration
+	CacheFor time.Duration
+}
+
+/*
+PingHealthCheck creates a health check that pings a database. *sql.DB
+satisfies the pinger interface.
+*/
+func PingHealthCheck(name string, pinger interface {
+	PingContext(ctx context.Context) error
+}) HealthCheck {
+	return HealthCheck{
+		Name:  name,
+		Check: pinger.PingContext,
+	}
+}
+
+/*
+DialHealthCheck creates a health check that opens, then immediately closes,
+a network connection. This is useful for dependencies such as SMTP servers.
+*/
+func DialHealthCheck(name, network, address string) HealthCheck {
+	return HealthCheck{
+		Name: name,
+		Check: func(ctx context.Context) error {
+			dialer := &net.Dialer{}
+			conn, err := dialer.DialContext(ctx, network, address)
+
+			if err != nil {
+				return err
+			}
+
+			return conn.Close()
+		},
+	}
+}
+
+/*
+HealthCheckResult is the outcome of a single check as reported by the
+readiness endpoint.
+*/
+type HealthCheckResult struct {
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+	DurationMS int64  `json:"durationMs"`
+	CheckedAt  string `json:"checkedAt"`
+}
+
+/*
+HealthResponse is the JSON body returned by the health endpoints.
+*/
+type HealthResponse struct {
+	Status string                       `json:"status"`
+	Checks map[string]HealthCheckResult `json:"checks,omitempty"`
+}
+
+type healthChecker struct {
+	checks       []*cachedHealthCheck
+	shuttingDown atomic.Bool
+}
+
+type cachedHealthCheck struct {
+	HealthCheck
+
+	checkedAt time.Time
+	err       error
+	duration  time.Duration
+	lock      *sync.Mutex
+}
+
+func newHealthChecker(checks []HealthCheck) *healthChecker {
+	result := &healthChecker{
+		checks: make([]*cachedHealthCheck, 0, len(checks)),
+	}
+
+	for _, check := range checks {
+		if check.Timeout <= 0 {
+			check.Timeout = defaultHealthCheckTimeout
+		}
+
+		result.checks = append(result.checks, &cachedHealthCheck{
+			HealthCheck: check,
+			lock:        &sync.Mutex{},
+		})
+	}
+
+	return result
+}
+
+/*
+liveness reports that the process is up and able to serve requests.
+*/
+func (h *healthChecker) liveness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	httphelpers.JsonOK(w, HealthResponse{Status: "ok"})
+}
+
+/*
+readiness runs every check concurrently and reports 200 if they all pass,
+or 503 if any fail. Once graceful shutdown begins readiness always fails,
+so load balancers stop sending new traffic.
+*/
+func (h *healthChecker) readiness(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	if h.shuttingDown.Load() {
+		httphelpers.WriteJson(w, http.StatusServiceUnavailable, HealthResponse{Status: "shutting down"})
+		return
+	}
+
+	results := make([]HealthCheckResult, len(h.checks))
+	wg := &sync.WaitGroup{}
+
+	for i, check := range h.checks {
+		wg.Go(func() {
+			results[i] = check.run(r.Context())
+		})
+	}
+
+	wg.Wait()
+
+	response := HealthResponse{
+		Status: "ready",
+		Checks: map[string]HealthCheckResult{},
+	}
+
+	status := http.StatusOK
+
+	for i, check := range h.checks {
+		response.Checks[check.Name] = results[i]
+
+		if results[i].Status != "ok" {
+			response.Status = "not ready"
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	httphelpers.WriteJson(w, status, response)
+}
+
+func (c *cachedHealthCheck) run(ctx context.Context) HealthCheckResult {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.checkedAt.IsZero() || time.Since(c.checkedAt) >= c.CacheFor {
+		/*
+		 * The result is shared with other probes, so the check must not
+		 * fail just because this probe disconnected.
+		 */
+		checkCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.Timeout)
+		defer cancel()
+
+		start := time.Now()
+		err := runHealthCheck(checkCtx, c.Check)
+
+		c.err = err
+		c.duration = time.Since(start)
+		c.checkedAt = time.Now()
+	}
+
+	result := HealthCheckResult{
+		Status:     "ok",
+		DurationMS: c.duration.Milliseconds(),
+		CheckedAt:  c.checkedAt.UTC().Format(time.RFC3339),
+	}
+
+	if c.err != nil {
+		result.Status = "error"
+		result.Error = c.err.Error()
+	}
+
+	return result
+}
+
+/*
+runHealthCheck enforces the timeout even if the check ignores its context.
+*/
+func runHealthCheck(ctx context.Context, check func(ctx context.Context) error) error {
+	done := make(chan error, 1)
+
+	go func() {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				done <- fmt.Errorf("health check panicked: %v", recovered)
+			}
+		}()
+
+		done <- check(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+
+	case <-ctx.Done():
+		return fmt.Errorf("health check timed out: %w", ctx.Err())
+	}
+}
@@ -0,0 +1,113 @@
+package mux2
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithHealthChecks(t *testing.T) {
+	var dbCalls atomic.Int32
+
+	dbCheck := HealthCheck{
+		Name:     "db",
+		CacheFor: time.Minute,
+		Check: func(ctx context.Context) error {
+			dbCalls.Add(1)
+			return nil
+		},
+	}
+
+	slowCheck := HealthCheck{
+		Name:    "slow",
+		Timeout: 20 * time.Millisecond,
+		Check: func(ctx context.Context) error {
+			time.Sleep(time.Second)
+			return nil
+		},
+	}
+
+	get := func(router *Router, path string) (int, HealthResponse) {
+		w := httptest.NewRecorder()
+		router.Mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+
+		response := HealthResponse{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response
+	}
+
+	t.Run("Ready when all checks pass", func(t *testing.T) {
+		router := Setup(Config{Host: "127.0.0.1:0"}, []Route{}, context.Background(), func() {}, WithHealthChecks(dbCheck))
+
+		status, response := get(router, "/readyz")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "ready", response.Status)
+		assert.Equal(t, "ok", response.Checks["db"].Status)
+
+		_, _ = get(router, "/readyz")
+		assert.Equal(t, int32(1), dbCalls.Load(), "results are cached")
+
+		status, response = get(router, "/healthz")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "ok", response.Status)
+	})
+
+	t.Run("Not ready when a check times out", func(t *testing.T) {
+		router := Setup(Config{Host: "127.0.0.1:0"}, []Route{}, context.Background(), func() {}, WithHealthChecks(slowCheck))
+
+		status, response := get(router, "/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, status)
+		assert.Equal(t, "not ready", response.Status)
+		assert.Contains(t, response.Checks["slow"].Error, "timed out")
+	})
+
+	t.Run("Not ready once shutdown begins", func(t *testing.T) {
+		router := Setup(Config{Host: "127.0.0.1:0"}, []Route{}, context.Background(), func() {}, WithHealthChecks())
+		require.NoError(t, router.Shutdown())
+
+		status, response := get(router, "/readyz")
+		assert.Equal(t, http.StatusServiceUnavailable, status)
+		assert.Equal(t, "shutting down", response.Status)
+
+		status, _ = get(router, "/healthz")
+		assert.Equal(t, http.StatusOK, status)
+	})
+
+	t.Run("A disconnected probe doesn't fail the check", func(t *testing.T) {
+		var calls atomic.Int32
+
+		check := HealthCheck{
+			Name:     "db",
+			CacheFor: time.Minute,
+			Check: func(ctx context.Context) error {
+				calls.Add(1)
+
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(10 * time.Millisecond):
+					return nil
+				}
+			},
+		}
+
+		router := Setup(Config{Host: "127.0.0.1:0"}, []Route{}, context.Background(), func() {}, WithHealthChecks(check))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		router.Mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequestWithContext(ctx, http.MethodGet, "/readyz", nil))
+
+		status, response := get(router, "/readyz")
+		assert.Equal(t, http.StatusOK, status)
+		assert.Equal(t, "ok", response.Checks["db"].Status)
+		assert.Equal(t, int32(1), calls.Load(), "the result of the first probe is cached")
+	})
+}
@@ -2,49 +2,122 @@ package mux2
 
 import (
 	"crypto/tls"
-	"fmt"
+	"net"
 	"net/http"
+	"slices"
+	"time"
 
 	"golang.org/x/crypto/acme/autocert"
 )
 
 /*
-Provide a path to store certificates, and the domain they apply to
+Provide a path to store certificates, and the domains they apply to
 for Let's Encrypt certificate generation.
+
+ChallengeAddress is the address of the plain HTTP listener used to answer
+HTTP-01 challenges, and defaults to ":80". When RedirectToHTTPS is true,
+every other request to that listener is permanently redirected to HTTPS.
+Otherwise autocert's default behavior applies, which is a temporary
+redirect for GET and HEAD requests.
 */
 type LetsEncryptConfig struct {
-	CertPath string
-	Domain   string
+	CertPath         string
+	ChallengeAddress string
+	Domain           string
+	Domains          []string
+	RedirectToHTTPS  bool
+}
+
+/*
+The challenge server faces the internet and only answers challenges and
+redirects, so it uses short timeouts to shed slow clients.
+*/
+const (
+	challengeIdleTimeout       = 30 * time.Second
+	challengeReadHeaderTimeout = 5 * time.Second
+	challengeReadTimeout       = 10 * time.Second
+	challengeWriteTimeout      = 10 * time.Second
+)
+
+func (c LetsEncryptConfig) domains() []string {
+	result := slices.Clone(c.Domains)
+
+	if c.Domain != "" && !slices.Contains(result, c.Domain) {
+		result = append(result, c.Domain)
+	}
+
+	return result
 }
 
-func startCertManager(config LetsEncryptConfig) *tls.Config {
+/*
+startCertManager creates the TLS configuration for Let's Encrypt, and the
+HTTP server used to answer challenges. The challenge server is started and
+stopped along with the router.
+*/
+func startCertManager(config LetsEncryptConfig, tlsAddress string) (*tls.Config, *http.Server) {
 	var (
 		tlsConfig   *tls.Config
-		certManager autocert.Manager
+		certManager *autocert.Manager
+		fallback    http.Handler
 	)
 
-	certManager = autocert.Manager{
+	certManager = &autocert.Manager{
 		Prompt:     autocert.AcceptTOS,
 		Cache:      autocert.DirCache(config.CertPath),
-		HostPolicy: autocert.HostWhitelist(config.Domain),
+		HostPolicy: autocert.HostWhitelist(config.domains()...),
 	}
 
 	// Create a TLS config using the autocert manager
-	tlsConfig = &tls.Config{
-		GetCertificate: certManager.GetCertificate,
-		NextProtos:     []string{"h2", "http/1.1"},
+	tlsConfig = certManager.TLSConfig()
+	tlsConfig.NextProtos = append([]string{"h2", "http/1.1"}, tlsConfig.NextProtos...)
+	tlsConfig.NextProtos = slices.Compact(tlsConfig.NextProtos)
+
+	if config.RedirectToHTTPS {
+		fallback = newHTTPSRedirectHandler(tlsAddress)
+	}
+
+	challengeAddress := config.ChallengeAddress
+
+	if challengeAddress == "" {
+		challengeAddress = ":80"
 	}
 
 	httpServer := &http.Server{
-		Addr:    ":80",
-		Handler: certManager.HTTPHandler(nil),
+		Addr:              challengeAddress,
+		Handler:           certManager.HTTPHandler(fallback),
+		IdleTimeout:       challengeIdleTimeout,
+		ReadHeaderTimeout: challengeReadHeaderTimeout,
+		ReadTimeout:       challengeReadTimeout,
+		WriteTimeout:      challengeWriteTimeout,
 	}
 
-	go func() {
-		if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			panic(fmt.Sprintf("error starting HTTP server on port 80 for Let's Encrypt: %v", err))
+	return tlsConfig, httpServer
+}
+
+/*
+newHTTPSRedirectHandler redirects requests to the same host and path
+on the HTTPS listener. The port is omitted if it is 443.
+*/
+func newHTTPSRedirectHandler(tlsAddress string) http.Handler {
+	_, tlsPort, _ := net.SplitHostPort(tlsAddress)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+
+		if tlsPort != "" && tlsPort != "443" {
+			host = net.JoinHostPort(host, tlsPort)
+		}
+
+		status := http.StatusMovedPermanently
+
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			status = http.StatusPermanentRedirect
 		}
-	}()
 
-	return tlsConfig
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), status)
+	})
 }
@@ -0,0 +1,30 @@
+package mux2
+
+import (
+	"fmt"
+	"net/http"
+)
+
+/*
+NewMaxBodyBytesMiddleware limits request bodies to maxBytes. Reading past
+the limit returns an *http.MaxBytesError, and the server closes the
+connection after the response. Requests that declare a larger
+Content-Length are rejected with a 413 before the handler runs.
+*/
+func NewMaxBodyBytesMiddleware(maxBytes int64) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > maxBytes {
+				writeRequestEntityTooLarge(w, r)
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func writeRequestEntityTooLarge(w http.ResponseWriter, r *http.Request) {
+	WriteError(w, r, http.StatusRequestEntityTooLarge, fmt.Errorf("request body too large"))
+}
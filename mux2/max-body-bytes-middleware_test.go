@@ -0,0 +1,114 @@
+package mux2
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouter_MaxBodyBytes(t *testing.T) {
+	readBody := func(w http.ResponseWriter, r *http.Request) {
+		_, err := io.ReadAll(r.Body)
+
+		var maxBytesErr *http.MaxBytesError
+
+		if errors.As(err, &maxBytesErr) {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+
+	router := Setup(
+		Config{Host: "127.0.0.1:0"},
+		[]Route{
+			{Path: "POST /default", HandlerFunc: readBody},
+			{Path: "POST /upload", HandlerFunc: readBody, MaxBodyBytes: 20},
+			{Path: "POST /unlimited", HandlerFunc: readBody, MaxBodyBytes: -1},
+		},
+		nil,
+		nil,
+
+		WithMaxBodyBytes(10),
+	)
+
+	tests := []struct {
+		name          string
+		path          string
+		body          string
+		unknownLength bool
+		wantStatus    int
+	}{
+		{"under router limit", "/default", "0123456789", false, http.StatusNoContent},
+		{"over router limit", "/default", "0123456789a", false, http.StatusRequestEntityTooLarge},
+		{"over router limit without content length", "/default", "0123456789a", true, http.StatusRequestEntityTooLarge},
+		{"route override", "/upload", "0123456789abcdef", false, http.StatusNoContent},
+		{"unlimited route", "/unlimited", strings.Repeat("x", 1000), false, http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+
+			if tt.unknownLength {
+				r.ContentLength = -1
+			}
+
+			router.Server.Handler.ServeHTTP(w, r)
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
+
+func TestRouter_MaxBodyBytesWithCSRF(t *testing.T) {
+	calls := 0
+
+	router := Setup(
+		Config{Host: "127.0.0.1:0"},
+		[]Route{
+			{Path: "POST /upload", HandlerFunc: func(w http.ResponseWriter, r *http.Request) { calls++ }, MaxBodyBytes: 1024},
+		},
+		nil,
+		nil,
+
+		WithCSRF(),
+	)
+
+	token := base64.RawURLEncoding.EncodeToString(bytes.Repeat([]byte{1}, csrfTokenLength))
+
+	for _, unknownLength := range []bool{false, true} {
+		t.Run(fmt.Sprintf("unknown length %v", unknownLength), func(t *testing.T) {
+			body := &bytes.Buffer{}
+			form := multipart.NewWriter(body)
+
+			file, _ := form.CreateFormFile("file", "big.bin")
+			_, _ = file.Write(bytes.Repeat([]byte("x"), 64*1024))
+			_ = form.Close()
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/upload", body)
+			r.Header.Set("Content-Type", form.FormDataContentType())
+			r.AddCookie(&http.Cookie{Name: CSRFCookieName, Value: token})
+
+			if unknownLength {
+				r.ContentLength = -1
+			}
+
+			router.Server.Handler.ServeHTTP(w, r)
+			assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+		})
+	}
+
+	assert.Equal(t, 0, calls)
+}
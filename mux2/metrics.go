@@ -0,0 +1,94 @@
+package mux2
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/adampresley/adamgokit/metrics"
+)
+
+/*
+routeMetrics holds the instruments used to measure every route. Series
+are labelled by the route pattern (such as "GET /users/{id}") rather than
+the request URL, so the number of series stays bounded.
+*/
+type routeMetrics struct {
+	duration *metrics.Histogram
+	inFlight *metrics.Gauge
+	requests *metrics.Counter
+}
+
+func newRouteMetrics(registry *metrics.Registry) *routeMetrics {
+	return &routeMetrics{
+		duration: registry.NewHistogram(
+			"http_request_duration_seconds",
+			"Latency of HTTP requests in seconds.",
+			metrics.DefaultBuckets,
+			"method", "route",
+		),
+		inFlight: registry.NewGauge(
+			"http_requests_in_flight",
+			"Number of HTTP requests currently being served.",
+			"route",
+		),
+		requests: registry.NewCounter(
+			"http_requests_total",
+			"Total number of HTTP requests served.",
+			"method", "route", "status",
+		),
+	}
+}
+
+/*
+instruments returns the route metrics for the router's registry. Routers
+set up by the same Server share them, because a registry can only
+register each metric once.
+*/
+func (c *routerConfig) instruments() *routeMetrics {
+	if c.sharedRouteMetrics == nil {
+		return newRouteMetrics(c.metricsRegistry)
+	}
+
+	result, ok := c.sharedRouteMetrics[c.metricsRegistry]
+
+	if !ok {
+		result = newRouteMetrics(c.metricsRegistry)
+		c.sharedRouteMetrics[c.metricsRegistry] = result
+	}
+
+	return result
+}
+
+func (m *routeMetrics) instrument(pattern string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		method := normalizeMethod(r.Method)
+		rw := newResponseWriter(w)
+
+		m.inFlight.Inc(pattern)
+
+		defer func() {
+			m.inFlight.Dec(pattern)
+			m.requests.Inc(method, pattern, strconv.Itoa(rw.Status()))
+			m.duration.ObserveDuration(start, method, pattern)
+		}()
+
+		next.ServeHTTP(rw, r)
+	})
+}
+
+/*
+normalizeMethod collapses non-standard methods into a single label value.
+Patterns without a method accept any method, and we don't want clients
+to create unbounded series.
+*/
+func normalizeMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+
+	return "OTHER"
+}
@@ -0,0 +1,80 @@
+package mux2
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adampresley/adamgokit/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithMetrics(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+
+	router := Setup(
+		Config{Host: "127.0.0.1:0"},
+		[]Route{{Path: "GET /users/{id}", HandlerFunc: handler}},
+		context.Background(),
+		func() {},
+
+		WithMetrics("/metrics"),
+	)
+
+	require.NotNil(t, router.Metrics)
+
+	for _, path := range []string{"/users/1", "/users/2"} {
+		router.Mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	router.Mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := w.Body.String()
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, body, `http_requests_total{method="GET",route="GET /users/{id}",status="204"} 2`)
+	assert.Contains(t, body, `http_requests_in_flight{route="GET /users/{id}"} 0`)
+	assert.Contains(t, body, `http_request_duration_seconds_count{method="GET",route="GET /users/{id}"} 2`)
+	assert.NotContains(t, body, "/users/1")
+}
+
+func TestWithMetrics_SharedRegistryAcrossListeners(t *testing.T) {
+	shutdownCtx, stopApp := context.WithCancel(context.Background())
+	defer stopApp()
+
+	registry := metrics.NewRegistry()
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+
+	options := []RouterOption{WithMetricsRegistry(registry), WithMetrics("/metrics")}
+
+	var server *Server
+
+	require.NotPanics(t, func() {
+		server = NewServer(
+			shutdownCtx,
+			stopApp,
+
+			Listener{Name: "public", Address: "127.0.0.1:0", Routes: []Route{{Path: "GET /public", HandlerFunc: handler}}, Options: options},
+			Listener{Name: "admin", Address: "127.0.0.1:0", Routes: []Route{{Path: "GET /admin", HandlerFunc: handler}}, Options: options},
+		)
+	})
+
+	server.Router("public").Mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/public", nil))
+	server.Router("admin").Mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/admin", nil))
+
+	w := httptest.NewRecorder()
+	server.Router("admin").Mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body := w.Body.String()
+
+	assert.Contains(t, body, `http_requests_total{method="GET",route="GET /public",status="204"} 1`)
+	assert.Contains(t, body, `http_requests_total{method="GET",route="GET /admin",status="204"} 1`)
+}
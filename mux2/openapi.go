@@ -0,0 +1,330 @@
+package mux2
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+OpenAPIInfo is the info section of the OpenAPI document served by
+WithOpenAPI.
+*/
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+var (
+	componentNameRegex = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+	pathParameterRegex = regexp.MustCompile(`\{([^}]+)\}`)
+	timeType           = reflect.TypeFor[time.Time]()
+)
+
+/*
+NewOpenAPIDocument builds an OpenAPI 3.1 document from a set of routes.
+Routes without a method and internal routes are left out. Path parameters
+come from the route pattern. Request and response schemas are generated
+from the Go types in each route's RouteDoc, using their JSON field names.
+Named struct types are added to components/schemas and referenced.
+*/
+func NewOpenAPIDocument(info OpenAPIInfo, routes []RouteInfo) map[string]any {
+	schemas := newSchemaGenerator()
+	paths := map[string]any{}
+
+	for _, route := range routes {
+		if route.Method == "" || route.Internal {
+			continue
+		}
+
+		path, parameters := openAPIPath(route.Path)
+		operation := map[string]any{}
+
+		if len(parameters) > 0 {
+			operation["parameters"] = parameters
+		}
+
+		responses := map[string]any{}
+
+		if doc := route.Doc; doc != nil {
+			setIfNotEmpty(operation, "summary", doc.Summary)
+			setIfNotEmpty(operation, "description", doc.Description)
+			setIfNotEmpty(operation, "operationId", doc.OperationID)
+
+			if len(doc.Tags) > 0 {
+				operation["tags"] = doc.Tags
+			}
+
+			if doc.Deprecated {
+				operation["deprecated"] = true
+			}
+
+			if doc.Request != nil {
+				operation["requestBody"] = map[string]any{
+					"required": true,
+					"content": map[string]any{
+						"application/json": map[string]any{"schema": schemas.schema(reflect.TypeOf(doc.Request))},
+					},
+				}
+			}
+
+			for status, body := range doc.Responses {
+				response := map[string]any{"description": http.StatusText(status)}
+
+				if body != nil {
+					contentType := "application/json"
+
+					if _, ok := body.(ProblemDetails); ok {
+						contentType = "application/problem+json"
+					}
+
+					response["content"] = map[string]any{
+						contentType: map[string]any{"schema": schemas.schema(reflect.TypeOf(body))},
+					}
+				}
+
+				responses[strconv.Itoa(status)] = response
+			}
+		}
+
+		if len(responses) == 0 {
+			responses["200"] = map[string]any{"description": http.StatusText(http.StatusOK)}
+		}
+
+		operation["responses"] = responses
+
+		pathItem, ok := paths[path].(map[string]any)
+
+		if !ok {
+			pathItem = map[string]any{}
+			paths[path] = pathItem
+		}
+
+		pathItem[strings.ToLower(route.Method)] = operation
+	}
+
+	document := map[string]any{
+		"openapi": "3.1.0",
+		"info":    info,
+		"paths":   paths,
+	}
+
+	if len(schemas.components) > 0 {
+		document["components"] = map[string]any{"schemas": schemas.components}
+	}
+
+	return document
+}
+
+/*
+newOpenAPIHandler serves the OpenAPI document as JSON. The document is
+built once, when the router is set up.
+*/
+func newOpenAPIHandler(info OpenAPIInfo, routes []RouteInfo) http.HandlerFunc {
+	body, err := json.MarshalIndent(NewOpenAPIDocument(info, routes), "", "  ")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err != nil {
+			WriteError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	}
+}
+
+/*
+openAPIPath converts a ServeMux path to an OpenAPI path, and returns its
+path parameters. Wildcards such as "{path...}" become "{path}", and the
+"{$}" end anchor is removed.
+*/
+func openAPIPath(path string) (string, []map[string]any) {
+	parameters := []map[string]any{}
+
+	path = strings.ReplaceAll(path, "{$}", "")
+
+	path = pathParameterRegex.ReplaceAllStringFunc(path, func(match string) string {
+		name := strings.TrimSuffix(match[1:len(match)-1], "...")
+
+		parameters = append(parameters, map[string]any{
+			"name":     name,
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]any{"type": "string"},
+		})
+
+		return "{" + name + "}"
+	})
+
+	return path, parameters
+}
+
+func setIfNotEmpty(m map[string]any, key, value string) {
+	if value != "" {
+		m[key] = value
+	}
+}
+
+/*
+schemaGenerator converts Go types to JSON schemas. Named struct types are
+stored once in components and referenced, which also handles recursive
+types. Types are named by their Go name. If two types share a name, the
+later ones are qualified with their package path.
+*/
+type schemaGenerator struct {
+	components map[string]any
+	names      map[reflect.Type]string
+}
+
+func newSchemaGenerator() *schemaGenerator {
+	return &schemaGenerator{
+		components: map[string]any{},
+		names:      map[reflect.Type]string{},
+	}
+}
+
+func (g *schemaGenerator) schema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+
+	case reflect.String:
+		return map[string]any{"type": "string"}
+
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "contentEncoding": "base64"}
+		}
+
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+
+		name, ok := g.names[t]
+
+		if !ok {
+			// Reserve the name first, in case the type refers to itself
+			name = g.componentName(t)
+			g.names[t] = name
+			g.components[name] = map[string]any{}
+			g.components[name] = g.structSchema(t)
+		}
+
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+
+	return map[string]any{}
+}
+
+/*
+componentName returns an unused component name for t. Types from
+different packages are told apart by their package path, and types with
+the same path, such as ones declared inside functions, by a number.
+*/
+func (g *schemaGenerator) componentName(t reflect.Type) string {
+	name := t.Name()
+
+	if _, taken := g.components[name]; !taken {
+		return name
+	}
+
+	name = componentNameRegex.ReplaceAllString(strings.ReplaceAll(t.PkgPath(), "/", ".")+"."+t.Name(), "_")
+	result := name
+
+	for i := 2; ; i++ {
+		if _, taken := g.components[result]; !taken {
+			return result
+		}
+
+		result = name + "_" + strconv.Itoa(i)
+	}
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	required := []string{}
+
+	g.addStructFields(t, properties, &required)
+
+	result := map[string]any{
+		"type":       "object",
+		"properties": properties,
+	}
+
+	if len(required) > 0 {
+		result["required"] = required
+	}
+
+	return result
+}
+
+/*
+addStructFields adds the exported fields of t, following the rules of
+encoding/json. Embedded structs without a JSON name are flattened.
+*/
+func (g *schemaGenerator) addStructFields(t reflect.Type, properties map[string]any, required *[]string) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+
+		if tag == "-" {
+			continue
+		}
+
+		name, options, _ := strings.Cut(tag, ",")
+
+		if field.Anonymous && name == "" {
+			fieldType := field.Type
+
+			if fieldType.Kind() == reflect.Pointer {
+				fieldType = fieldType.Elem()
+			}
+
+			if fieldType.Kind() == reflect.Struct {
+				g.addStructFields(fieldType, properties, required)
+				continue
+			}
+		}
+
+		if !field.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+
+		properties[name] = g.schema(field.Type)
+
+		if !strings.Contains(options, "omitempty") && !strings.Contains(options, "omitzero") && field.Type.Kind() != reflect.Pointer {
+			*required = append(*required, name)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package mux2
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/adamgokit/jwt"
+	"github.com/adampresley/adamgokit/sessions"
+	gojwt "github.com/golang-jwt/jwt/v5"
+)
+
+/*
+A RateLimitKeyFunc identifies the client making a request. Requests with
+the same key share a token bucket. If the function returns an error, the
+client's IP address is used instead.
+*/
+type RateLimitKeyFunc func(r *http.Request) (string, error)
+
+/*
+RateLimitByIP keys requests by client IP address, as returned by
+httphelpers.ClientIP. This honors WithTrustedProxies. Trusted proxies
+(given as CIDR ranges or single addresses, such as "10.0.0.0/8") may also
+be passed here directly, in which case the client address is resolved
+from the forwarding headers of those proxies.
+*/
+func RateLimitByIP(trustedProxies ...string) RateLimitKeyFunc {
+	if len(trustedProxies) == 0 {
+		return func(r *http.Request) (string, error) {
+			return "ip:" + httphelpers.ClientIP(r), nil
+		}
+	}
+
+	trusted := mustParseTrustedProxies(trustedProxies)
+
+	return func(r *http.Request) (string, error) {
+		return "ip:" + httphelpers.ResolveForwardedRequest(r, trusted).ClientIP, nil
+	}
+}
+
+/*
+RateLimitBySession keys requests by a value stored in the session, such
+as a user ID.
+*/
+func RateLimitBySession[T any](session sessions.Session[T]) RateLimitKeyFunc {
+	return func(r *http.Request) (string, error) {
+		value, err := session.Get(r)
+
+		if err != nil {
+			return "", fmt.Errorf("could not get rate limit key from session: %w", err)
+		}
+
+		return fmt.Sprintf("session:%v", value), nil
+	}
+}
+
+/*
+RateLimitByJWTSubject keys requests by the subject ("sub") claim of the
+bearer token in the Authorization header. The token is verified with
+the provided service.
+*/
+func RateLimitByJWTSubject[T gojwt.Claims](service jwt.JwtSymmetricService[T]) RateLimitKeyFunc {
+	return func(r *http.Request) (string, error) {
+		token, err := httphelpers.GetAuthorizationBearer(r)
+
+		if err != nil {
+			return "", err
+		}
+
+		claims, err := service.Verify(token)
+
+		if err != nil {
+			return "", fmt.Errorf("could not verify bearer token for rate limit key: %w", err)
+		}
+
+		subject, err := claims.GetSubject()
+
+		if err != nil || subject == "" {
+			return "", fmt.Errorf("bearer token has no subject")
+		}
+
+		return "jwt:" + subject, nil
+	}
+}
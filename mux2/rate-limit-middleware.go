@@ -0,0 +1,137 @@
+package mux2
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+)
+
+var (
+	ErrTooManyRequests = fmt.Errorf("too many requests. please try again later")
+)
+
+/*
+RateLimit describes a token bucket. Clients may make Requests requests per
+Period, with bursts of up to Burst requests. If Burst is zero, it defaults
+to Requests.
+
+For example, to allow 5 login attempts per minute:
+
+	mux2.RateLimit{Requests: 5, Period: time.Minute}
+*/
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+	Burst    int
+}
+
+func (l RateLimit) burst() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+
+	return l.Requests
+}
+
+func (l RateLimit) ratePerSecond() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+type RateLimitConfig struct {
+	keyFunc RateLimitKeyFunc
+	store   RateLimitStore
+}
+
+type RateLimitOption func(*RateLimitConfig)
+
+/*
+WithRateLimitKey sets how clients are identified. Defaults to
+RateLimitByIP with no trusted proxies.
+*/
+func WithRateLimitKey(keyFunc RateLimitKeyFunc) RateLimitOption {
+	return func(config *RateLimitConfig) {
+		config.keyFunc = keyFunc
+	}
+}
+
+/*
+WithRateLimitStore sets where token buckets are kept. Defaults to a new
+MemoryRateLimitStore. Share a store between middlewares only if they use
+different keys.
+*/
+func WithRateLimitStore(store RateLimitStore) RateLimitOption {
+	return func(config *RateLimitConfig) {
+		config.store = store
+	}
+}
+
+/*
+NewRateLimitMiddleware returns a token bucket rate limiting middleware.
+It can be attached to a single route through Route.Middlewares, or to
+every route with the WithRateLimit router option. Every response includes
+RateLimit-Limit, RateLimit-Remaining, and RateLimit-Reset headers. When a
+client runs out of tokens it receives a 429 with a Retry-After header.
+
+If the store returns an error, the request is allowed through.
+*/
+func NewRateLimitMiddleware(limit RateLimit, options ...RateLimitOption) MiddlewareFunc {
+	if limit.Requests <= 0 || limit.Period <= 0 {
+		panic("rate limit requests and period must be greater than zero")
+	}
+
+	config := &RateLimitConfig{
+		keyFunc: RateLimitByIP(),
+		store:   nil,
+	}
+
+	for _, opt := range options {
+		opt(config)
+	}
+
+	if config.store == nil {
+		config.store = NewMemoryRateLimitStore(0)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, err := config.keyFunc(r)
+
+			if err != nil || key == "" {
+				key = "ip:" + httphelpers.ClientIP(r)
+			}
+
+			result, err := config.store.Take(r.Context(), key, limit)
+
+			if err != nil {
+				RequestLogger(r).Error("error checking rate limit. allowing request", slog.Any("error", err))
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(limit.burst()))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.ResetAfter)))
+
+			if !result.Allowed {
+				w.Header().Set("Retry-After", strconv.Itoa(max(1, ceilSeconds(result.RetryAfter))))
+				writeTooManyRequests(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func writeTooManyRequests(w http.ResponseWriter, r *http.Request) {
+	WriteError(w, r, http.StatusTooManyRequests, ErrTooManyRequests)
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,110 @@
+package mux2
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRateLimitMiddleware(t *testing.T) {
+	handler := NewRateLimitMiddleware(RateLimit{Requests: 2, Period: time.Minute})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	send := func(remoteAddr string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/login", nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("Accept", "application/json")
+
+		handler.ServeHTTP(w, r)
+		return w
+	}
+
+	first := send("192.0.2.1:1234")
+	assert.Equal(t, http.StatusNoContent, first.Code)
+	assert.Equal(t, "2", first.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "1", first.Header().Get("RateLimit-Remaining"))
+
+	assert.Equal(t, http.StatusNoContent, send("192.0.2.1:1234").Code)
+
+	limited := send("192.0.2.1:5678")
+	assert.Equal(t, http.StatusTooManyRequests, limited.Code)
+	assert.Equal(t, "30", limited.Header().Get("Retry-After"))
+	assert.Equal(t, "0", limited.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "application/problem+json", limited.Header().Get("Content-Type"))
+
+	assert.Equal(t, http.StatusNoContent, send("192.0.2.2:1234").Code, "other clients have their own bucket")
+}
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	now := time.Now()
+	limit := RateLimit{Requests: 1, Period: time.Second}
+
+	store := NewMemoryRateLimitStore(2)
+	store.now = func() time.Time { return now }
+
+	result, err := store.Take(context.Background(), "a", limit)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+
+	result, _ = store.Take(context.Background(), "a", limit)
+	assert.False(t, result.Allowed)
+	assert.Equal(t, time.Second, result.RetryAfter)
+
+	now = now.Add(500 * time.Millisecond)
+	_, _ = store.Take(context.Background(), "b", limit)
+	_, _ = store.Take(context.Background(), "c", limit)
+
+	assert.Len(t, store.buckets, 2, "the least recently seen key is evicted when full")
+	assert.NotContains(t, store.buckets, "a")
+
+	now = now.Add(2 * time.Minute)
+	_, _ = store.Take(context.Background(), "d", limit)
+
+	assert.Len(t, store.buckets, 1, "refilled buckets are swept")
+}
+
+func TestMemoryRateLimitStore_SweepUsesEachBucketsLimit(t *testing.T) {
+	now := time.Now()
+	loose := RateLimit{Requests: 100, Period: time.Hour}
+	strict := RateLimit{Requests: 1, Period: time.Second}
+
+	store := NewMemoryRateLimitStore(0)
+	store.now = func() time.Time { return now }
+
+	for range 50 {
+		_, _ = store.Take(context.Background(), "loose", loose)
+	}
+
+	now = now.Add(2 * time.Minute)
+	_, _ = store.Take(context.Background(), "strict", strict)
+
+	require.Contains(t, store.buckets, "loose", "a partly used bucket must not be swept by another limiter's limits")
+
+	result, _ := store.Take(context.Background(), "loose", loose)
+	assert.Equal(t, 52, result.Remaining)
+}
+
+func TestMemoryRateLimitStore_EvictsLeastRecentlySeen(t *testing.T) {
+	now := time.Now()
+	limit := RateLimit{Requests: 10, Period: time.Second}
+
+	store := NewMemoryRateLimitStore(2)
+	store.now = func() time.Time { return now }
+
+	for _, key := range []string{"a", "b", "a", "c"} {
+		now = now.Add(time.Millisecond)
+		_, _ = store.Take(context.Background(), key, limit)
+	}
+
+	assert.Contains(t, store.buckets, "a", "a was seen again after b")
+	assert.NotContains(t, store.buckets, "b")
+	assert.Contains(t, store.buckets, "c")
+	assert.Equal(t, len(store.buckets), store.recent.Len())
+}
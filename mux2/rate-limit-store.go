@@ -0,0 +1,165 @@
+package mux2
+
+import (
+	"container/list"
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+/*
+A RateLimitStore tracks token buckets by key. The in-memory store works
+for a single instance. To share limits across instances, implement this
+interface on top of a shared store such as Redis or Postgres.
+*/
+type RateLimitStore interface {
+	/*
+	   Take attempts to remove a token from the bucket identified by key.
+	   The bucket holds at most limit.Burst tokens and is refilled at
+	   limit.Requests tokens per limit.Period.
+	*/
+	Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error)
+}
+
+/*
+RateLimitResult describes the outcome of taking a token from a bucket.
+*/
+type RateLimitResult struct {
+	Allowed    bool
+	Remaining  int
+	ResetAfter time.Duration
+	RetryAfter time.Duration
+}
+
+/*
+tokenBucket keeps the capacity and rate it was created with, so buckets
+from limiters sharing a store are swept by their own limits.
+*/
+type tokenBucket struct {
+	capacity float64
+	key      string
+	lastSeen time.Time
+	rate     float64
+	tokens   float64
+}
+
+/*
+MemoryRateLimitStore is an in-memory RateLimitStore. Buckets that have been
+idle long enough to refill completely are evicted periodically, and the
+number of tracked keys is capped to bound memory use. Buckets are kept in
+least recently seen order, so making room for a new key is cheap.
+*/
+type MemoryRateLimitStore struct {
+	buckets   map[string]*list.Element
+	lastSweep time.Time
+	lock      *sync.Mutex
+	maxKeys   int
+	now       func() time.Time
+	recent    *list.List
+}
+
+const (
+	defaultRateLimitMaxKeys       = 100_000
+	defaultRateLimitSweepInterval = time.Minute
+)
+
+/*
+NewMemoryRateLimitStore creates an in-memory store that tracks up to
+maxKeys clients. If maxKeys is zero or less, a default of 100,000 is used.
+*/
+func NewMemoryRateLimitStore(maxKeys int) *MemoryRateLimitStore {
+	if maxKeys <= 0 {
+		maxKeys = defaultRateLimitMaxKeys
+	}
+
+	return &MemoryRateLimitStore{
+		buckets: map[string]*list.Element{},
+		lock:    &sync.Mutex{},
+		maxKeys: maxKeys,
+		now:     time.Now,
+		recent:  list.New(),
+	}
+}
+
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, limit RateLimit) (RateLimitResult, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := s.now()
+	capacity := float64(limit.burst())
+	rate := limit.ratePerSecond()
+
+	s.sweep(now)
+
+	var bucket *tokenBucket
+
+	if element, ok := s.buckets[key]; ok {
+		bucket = element.Value.(*tokenBucket)
+		s.recent.MoveToFront(element)
+	} else {
+		if len(s.buckets) >= s.maxKeys {
+			s.evictOne()
+		}
+
+		bucket = &tokenBucket{capacity: capacity, key: key, lastSeen: now, rate: rate, tokens: capacity}
+		s.buckets[key] = s.recent.PushFront(bucket)
+	}
+
+	elapsed := now.Sub(bucket.lastSeen).Seconds()
+	bucket.tokens = math.Min(capacity, bucket.tokens+elapsed*rate)
+	bucket.lastSeen = now
+
+	result := RateLimitResult{}
+
+	if bucket.tokens >= 1 {
+		bucket.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsToDuration((1 - bucket.tokens) / rate)
+	}
+
+	result.Remaining = int(math.Floor(bucket.tokens))
+	result.ResetAfter = secondsToDuration((capacity - bucket.tokens) / rate)
+
+	return result, nil
+}
+
+/*
+sweep removes buckets that would be full by now, as they are
+indistinguishable from new ones. Callers must hold the lock.
+*/
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < defaultRateLimitSweepInterval {
+		return
+	}
+
+	s.lastSweep = now
+
+	for key, element := range s.buckets {
+		bucket := element.Value.(*tokenBucket)
+
+		if bucket.tokens+now.Sub(bucket.lastSeen).Seconds()*bucket.rate >= bucket.capacity {
+			s.recent.Remove(element)
+			delete(s.buckets, key)
+		}
+	}
+}
+
+/*
+evictOne removes the least recently seen bucket. Callers must hold the lock.
+*/
+func (s *MemoryRateLimitStore) evictOne() {
+	oldest := s.recent.Back()
+
+	if oldest == nil {
+		return
+	}
+
+	s.recent.Remove(oldest)
+	delete(s.buckets, oldest.Value.(*tokenBucket).key)
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
@@ -0,0 +1,61 @@
+package mux2
+
+import (
+	"fmt"
+	"net/http"
+	"net/netip"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+)
+
+/*
+NewRealIPMiddleware resolves the real client IP address for requests that
+come through one of the trusted proxies, given as CIDR ranges or single
+addresses (such as "10.0.0.0/8"). The address is read from the Forwarded,
+X-Forwarded-For, or X-Real-IP headers, and is available to handlers from
+httphelpers.ClientIP.
+
+The scheme and host the client used (from Forwarded, X-Forwarded-Proto, and
+X-Forwarded-Host) are written to r.URL.Scheme, r.URL.Host, and r.Host, so
+absolute URLs and redirects point at the public address. Requests from
+untrusted peers are left as they are.
+
+This panics if a trusted proxy can't be parsed.
+*/
+func NewRealIPMiddleware(trustedProxies ...string) MiddlewareFunc {
+	trusted := mustParseTrustedProxies(trustedProxies)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			forwarded := httphelpers.ResolveForwardedRequest(r, trusted)
+
+			r = r.WithContext(httphelpers.ContextWithClientIP(r.Context(), forwarded.ClientIP))
+
+			if forwarded.Proto == "http" || forwarded.Proto == "https" || forwarded.Host != "" {
+				u := *r.URL
+				r.URL = &u
+
+				if forwarded.Proto == "http" || forwarded.Proto == "https" {
+					r.URL.Scheme = forwarded.Proto
+				}
+
+				if forwarded.Host != "" {
+					r.Host = forwarded.Host
+					r.URL.Host = forwarded.Host
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func mustParseTrustedProxies(proxies []string) []netip.Prefix {
+	trusted, err := httphelpers.ParseTrustedProxies(proxies...)
+
+	if err != nil {
+		panic(fmt.Sprintf("error configuring trusted proxies: %s", err.Error()))
+	}
+
+	return trusted
+}
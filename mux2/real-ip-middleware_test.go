@@ -0,0 +1,43 @@
+package mux2
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRealIPMiddleware(t *testing.T) {
+	var (
+		gotIP   string
+		gotHost string
+		gotURL  string
+	)
+
+	handler := NewRealIPMiddleware("10.0.0.0/8")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotIP = httphelpers.ClientIP(r)
+		gotHost = r.Host
+		gotURL = r.URL.String()
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/login?next=%2F", nil)
+	r.RemoteAddr = "10.1.1.1:1000"
+	r.Header.Set("X-Forwarded-For", "198.51.100.1")
+	r.Header.Set("X-Forwarded-Proto", "https")
+	r.Header.Set("X-Forwarded-Host", "app.example.com")
+
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	assert.Equal(t, "198.51.100.1", gotIP)
+	assert.Equal(t, "app.example.com", gotHost)
+	assert.Equal(t, "https://app.example.com/login?next=%2F", gotURL)
+	assert.Equal(t, "/login?next=%2F", r.URL.String(), "the original request should not be modified")
+}
+
+func TestRealIPMiddleware_InvalidProxyPanics(t *testing.T) {
+	assert.Panics(t, func() {
+		NewRealIPMiddleware("not-a-cidr")
+	})
+}
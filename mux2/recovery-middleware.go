@@ -0,0 +1,69 @@
+package mux2
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strings"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+)
+
+/*
+NewRecoveryMiddleware returns a middleware that recovers from panics in
+downstream handlers. The panic and stack trace are logged, and if nothing
+has been written to the client yet a 500 is written with WriteError, so
+the router's error handler is used.
+*/
+func NewRecoveryMiddleware() MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rw := newResponseWriter(w)
+
+			defer func() {
+				recovered := recover()
+
+				if recovered == nil {
+					return
+				}
+
+				/*
+				 * http.ErrAbortHandler is used to deliberately abort a
+				 * response. Let the server handle it.
+				 */
+				if recovered == http.ErrAbortHandler {
+					panic(recovered)
+				}
+
+				RequestLogger(r).Error(
+					"recovered from panic in HTTP handler",
+					slog.Any("panic", recovered),
+					slog.String("method", r.Method),
+					slog.String("path", r.URL.Path),
+					slog.String("stack", string(debug.Stack())),
+				)
+
+				if rw.HeaderWritten() {
+					return
+				}
+
+				WriteError(rw, r, http.StatusInternalServerError, fmt.Errorf("panic: %v", recovered))
+			}()
+
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+/*
+wantsHtml returns true for htmx requests and requests whose Accept header
+prefers HTML, such as regular browser navigation.
+*/
+func wantsHtml(r *http.Request) bool {
+	if httphelpers.IsHtmx(r) {
+		return true
+	}
+
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
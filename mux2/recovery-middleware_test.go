@@ -0,0 +1,67 @@
+package mux2
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRecoveryMiddleware(t *testing.T) {
+	panicky := NewRecoveryMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	testCases := []struct {
+		name        string
+		headers     map[string]string
+		contentType string
+	}{
+		{
+			name:        "JSON for API requests",
+			headers:     map[string]string{"Accept": "application/json"},
+			contentType: "application/problem+json",
+		},
+		{
+			name:        "HTML for browsers",
+			headers:     map[string]string{"Accept": "text/html,application/xhtml+xml"},
+			contentType: "text/html",
+		},
+		{
+			name:        "HTML for htmx",
+			headers:     map[string]string{"Hx-Request": "true"},
+			contentType: "text/html",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+			for k, v := range tc.headers {
+				r.Header.Set(k, v)
+			}
+
+			assert.NotPanics(t, func() {
+				panicky.ServeHTTP(w, r)
+			})
+
+			assert.Equal(t, http.StatusInternalServerError, w.Code)
+			assert.Equal(t, tc.contentType, w.Header().Get("Content-Type"))
+		})
+	}
+
+	t.Run("Does not overwrite a started response", func(t *testing.T) {
+		handler := NewRecoveryMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+			panic("boom")
+		}))
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		assert.Equal(t, http.StatusAccepted, w.Code)
+	})
+}
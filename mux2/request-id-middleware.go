@@ -0,0 +1,90 @@
+package mux2
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+)
+
+/*
+RequestIDHeader is the header used to receive and return request IDs.
+*/
+const RequestIDHeader = "X-Request-ID"
+
+const maxRequestIDLength = 128
+
+type requestIDContextKey struct{}
+
+/*
+NewRequestIDMiddleware returns a middleware that assigns every request an ID.
+If the incoming request already carries a valid X-Request-ID header (for
+example from a load balancer), that ID is used. Otherwise a new one is
+generated. The ID is stored in the request context and echoed back in
+the X-Request-ID response header.
+*/
+func NewRequestIDMiddleware() MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(RequestIDHeader)
+
+			if !isValidRequestID(id) {
+				id = newRequestID()
+			}
+
+			w.Header().Set(RequestIDHeader, id)
+
+			ctx := context.WithValue(r.Context(), requestIDContextKey{}, id)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+/*
+RequestIDFromContext returns the request ID stored by the request ID
+middleware, or an empty string if there isn't one.
+*/
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDContextKey{}).(string)
+	return id
+}
+
+/*
+RequestLogger returns the default slog logger with the request ID
+attached as the "requestID" attribute. If the request has no ID,
+the default logger is returned as-is.
+*/
+func RequestLogger(r *http.Request) *slog.Logger {
+	id := RequestIDFromContext(r.Context())
+
+	if id == "" {
+		return slog.Default()
+	}
+
+	return slog.Default().With(slog.String("requestID", id))
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+/*
+isValidRequestID only accepts reasonably short IDs made of visible ASCII
+characters, so clients cannot inject arbitrary content into logs.
+*/
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
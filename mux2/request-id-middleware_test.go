@@ -0,0 +1,47 @@
+package mux2
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRequestIDMiddleware(t *testing.T) {
+	var got string
+
+	handler := NewRequestIDMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = RequestIDFromContext(r.Context())
+	}))
+
+	t.Run("Generates an ID", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		assert.Len(t, got, 32)
+		assert.Equal(t, got, w.Header().Get(RequestIDHeader))
+	})
+
+	t.Run("Propagates an incoming ID", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(RequestIDHeader, "abc-123")
+
+		handler.ServeHTTP(w, r)
+
+		assert.Equal(t, "abc-123", got)
+		assert.Equal(t, "abc-123", w.Header().Get(RequestIDHeader))
+	})
+
+	t.Run("Replaces an invalid incoming ID", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(RequestIDHeader, "bad id\nwith newline")
+
+		handler.ServeHTTP(w, r)
+
+		assert.NotEqual(t, "bad id\nwith newline", got)
+		assert.Len(t, got, 32)
+	})
+}
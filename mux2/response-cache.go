@@ -0,0 +1,241 @@
+package mux2
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+)
+
+/*
+ResponseCache is an in-memory LRU cache of HTTP responses, used by the
+cache middleware. The total size of cached responses is bounded, and the
+least recently used responses are evicted first. Entries expire after
+their TTL, and can be removed early by tag with InvalidateTags.
+
+A single ResponseCache can be shared by many routes.
+*/
+type ResponseCache struct {
+	entries  map[string]*list.Element
+	lock     *sync.Mutex
+	lru      *list.List
+	maxBytes int64
+	now      func() time.Time
+	size     int64
+	tags     map[string]map[string]struct{}
+	vary     map[string]*varyHeaders
+}
+
+type varyHeaders struct {
+	names []string
+	refs  int
+}
+
+type cachedResponse struct {
+	body         []byte
+	etag         string
+	expires      time.Time
+	header       http.Header
+	key          string
+	lastModified time.Time
+	primaryKey   string
+	size         int64
+	status       int
+	storedAt     time.Time
+	tags         []string
+}
+
+/*
+NewResponseCache creates a cache holding at most maxBytes of responses,
+including headers. If maxBytes is zero or less, it defaults to 64MB.
+*/
+func NewResponseCache(maxBytes int64) *ResponseCache {
+	if maxBytes <= 0 {
+		maxBytes = 64 << 20
+	}
+
+	return &ResponseCache{
+		entries:  map[string]*list.Element{},
+		lock:     &sync.Mutex{},
+		lru:      list.New(),
+		maxBytes: maxBytes,
+		now:      time.Now,
+		tags:     map[string]map[string]struct{}{},
+		vary:     map[string]*varyHeaders{},
+	}
+}
+
+/*
+InvalidateTags removes every cached response with any of the given tags,
+and returns how many were removed.
+*/
+func (c *ResponseCache) InvalidateTags(tags ...string) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	removed := 0
+
+	for _, tag := range tags {
+		for key := range c.tags[tag] {
+			if element, ok := c.entries[key]; ok {
+				c.remove(element)
+				removed++
+			}
+		}
+	}
+
+	return removed
+}
+
+/*
+Len returns the number of cached responses.
+*/
+func (c *ResponseCache) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.lru.Len()
+}
+
+/*
+Purge removes every cached response.
+*/
+func (c *ResponseCache) Purge() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.entries = map[string]*list.Element{}
+	c.lru.Init()
+	c.size = 0
+	c.tags = map[string]map[string]struct{}{}
+	c.vary = map[string]*varyHeaders{}
+}
+
+/*
+Size returns the approximate number of bytes used by cached responses.
+*/
+func (c *ResponseCache) Size() int64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.size
+}
+
+/*
+get returns the cached response for a request. The primary key identifies
+the resource. The names of the headers the response varies on are
+remembered per primary key, and their values from r complete the key.
+*/
+func (c *ResponseCache) get(primaryKey string, r *http.Request) (*cachedResponse, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	vary, ok := c.vary[primaryKey]
+
+	if !ok {
+		return nil, false
+	}
+
+	element, ok := c.entries[varyKey(primaryKey, vary.names, r)]
+
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*cachedResponse)
+
+	if !c.now().Before(entry.expires) {
+		c.remove(element)
+		return nil, false
+	}
+
+	c.lru.MoveToFront(element)
+	return entry, true
+}
+
+func (c *ResponseCache) set(primaryKey string, varyNames []string, r *http.Request, entry *cachedResponse) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	entry.key = varyKey(primaryKey, varyNames, r)
+	entry.primaryKey = primaryKey
+	entry.size = int64(len(entry.key) + len(entry.body))
+
+	for name, values := range entry.header {
+		for _, value := range values {
+			entry.size += int64(len(name) + len(value))
+		}
+	}
+
+	if entry.size > c.maxBytes {
+		return
+	}
+
+	if element, ok := c.entries[entry.key]; ok {
+		c.remove(element)
+	}
+
+	/*
+	 * The most recent response decides which headers a resource varies
+	 * on. Entries stored under a different set of headers can no longer
+	 * be found, and age out of the LRU.
+	 */
+	vary, ok := c.vary[primaryKey]
+
+	if !ok {
+		vary = &varyHeaders{}
+		c.vary[primaryKey] = vary
+	}
+
+	vary.names = varyNames
+	vary.refs++
+
+	c.entries[entry.key] = c.lru.PushFront(entry)
+	c.size += entry.size
+
+	for _, tag := range entry.tags {
+		if c.tags[tag] == nil {
+			c.tags[tag] = map[string]struct{}{}
+		}
+
+		c.tags[tag][entry.key] = struct{}{}
+	}
+
+	for c.size > c.maxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *ResponseCache) remove(element *list.Element) {
+	entry := element.Value.(*cachedResponse)
+
+	c.lru.Remove(element)
+	delete(c.entries, entry.key)
+	c.size -= entry.size
+
+	if vary, ok := c.vary[entry.primaryKey]; ok {
+		vary.refs--
+
+		if vary.refs <= 0 {
+			delete(c.vary, entry.primaryKey)
+		}
+	}
+
+	for _, tag := range entry.tags {
+		delete(c.tags[tag], entry.key)
+
+		if len(c.tags[tag]) == 0 {
+			delete(c.tags, tag)
+		}
+	}
+}
+
+func varyKey(primaryKey string, varyNames []string, r *http.Request) string {
+	key := primaryKey
+
+	for _, name := range varyNames {
+		key += "\n" + name + ":" + r.Header.Get(name)
+	}
+
+	return key
+}
@@ -0,0 +1,107 @@
+package mux2
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+/*
+responseWriter wraps an http.ResponseWriter to record the status code and
+number of bytes written. It passes through http.Flusher and http.Hijacker,
+and supports http.ResponseController through Unwrap.
+*/
+type responseWriter struct {
+	http.ResponseWriter
+
+	bytesWritten int64
+	status       int
+	wroteHeader  bool
+}
+
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	if rw, ok := w.(*responseWriter); ok {
+		return rw
+	}
+
+	return &responseWriter{
+		ResponseWriter: w,
+		status:         http.StatusOK,
+	}
+}
+
+func (w *responseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+
+	/*
+	 * Informational responses (such as 103 Early Hints) may be
+	 * followed by a final status.
+	 */
+	if status >= 100 && status < 200 && status != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	w.status = status
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	n, err := w.ResponseWriter.Write(b)
+	w.bytesWritten += int64(n)
+	return n, err
+}
+
+func (w *responseWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	_ = http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+
+	w.status = http.StatusSwitchingProtocols
+	w.wroteHeader = true
+	return hijacker.Hijack()
+}
+
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+/*
+Status returns the status code written to the response. If nothing has
+been written yet, this is 200.
+*/
+func (w *responseWriter) Status() int {
+	return w.status
+}
+
+/*
+BytesWritten returns the number of body bytes written to the response.
+*/
+func (w *responseWriter) BytesWritten() int64 {
+	return w.bytesWritten
+}
+
+/*
+HeaderWritten returns true once the response status has been sent.
+*/
+func (w *responseWriter) HeaderWritten() bool {
+	return w.wroteHeader
+}
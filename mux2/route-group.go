@@ -0,0 +1,111 @@
+package mux2
+
+import (
+	"strings"
+)
+
+/*
+A RouteGroup shares a path prefix and a set of middlewares across a set of
+routes. Groups may be nested, in which case prefixes are joined and the
+middlewares of outer groups wrap those of inner groups.
+
+For example:
+
+	adminGroup := mux2.RouteGroup{
+	  Prefix:      "/admin",
+	  Middlewares: []mux2.MiddlewareFunc{requireAdmin},
+	  Routes: []mux2.Route{
+	    {Path: "GET /", HandlerFunc: adminDashboard},
+	    {Path: "GET /users/{id}", HandlerFunc: adminUser},
+	  },
+	}
+
+This registers "GET /admin/" and "GET /admin/users/{id}".
+*/
+type RouteGroup struct {
+	Prefix      string
+	Middlewares []MiddlewareFunc
+	Groups      []RouteGroup
+	Routes      []Route
+}
+
+/*
+flattenRouteGroups converts a set of route groups into plain routes. Each
+route's path has its group prefixes inserted after the method (if any),
+and its middlewares are extended with those of its groups, innermost
+group first. Because route middlewares are applied in order, this means
+the outermost group's middlewares run first.
+*/
+func flattenRouteGroups(groups []RouteGroup) []Route {
+	result := []Route{}
+
+	for _, group := range groups {
+		result = append(result, flattenRouteGroup(group, "", nil)...)
+	}
+
+	return result
+}
+
+func flattenRouteGroup(group RouteGroup, parentPrefix string, parentMiddlewares []MiddlewareFunc) []Route {
+	result := []Route{}
+	prefix := joinRoutePath(parentPrefix, group.Prefix)
+
+	middlewares := make([]MiddlewareFunc, 0, len(group.Middlewares)+len(parentMiddlewares))
+	middlewares = append(middlewares, group.Middlewares...)
+	middlewares = append(middlewares, parentMiddlewares...)
+
+	for _, route := range group.Routes {
+		method, path := splitRoutePattern(route.Path)
+
+		route.Path = joinRoutePath(prefix, path)
+
+		if method != "" {
+			route.Path = method + " " + route.Path
+		}
+
+		routeMiddlewares := make([]MiddlewareFunc, 0, len(route.Middlewares)+len(middlewares))
+		routeMiddlewares = append(routeMiddlewares, route.Middlewares...)
+		routeMiddlewares = append(routeMiddlewares, middlewares...)
+		route.Middlewares = routeMiddlewares
+
+		result = append(result, route)
+	}
+
+	for _, child := range group.Groups {
+		result = append(result, flattenRouteGroup(child, prefix, middlewares)...)
+	}
+
+	return result
+}
+
+/*
+splitRoutePattern separates an http.ServeMux pattern such as "GET /users/{id}"
+into its method and path. The method is empty if the pattern has none.
+*/
+func splitRoutePattern(pattern string) (string, string) {
+	pattern = strings.TrimSpace(pattern)
+
+	if method, path, found := strings.Cut(pattern, " "); found {
+		return method, strings.TrimSpace(path)
+	}
+
+	return "", pattern
+}
+
+func joinRoutePath(prefix, path string) string {
+	prefix = strings.TrimSuffix(prefix, "/")
+
+	if prefix != "" && !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+
+	if path == "" {
+		path = "/"
+	}
+
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	return prefix + path
+}
@@ -0,0 +1,142 @@
+package mux2
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adampresley/adamgokit/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlattenRouteGroups(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+
+	groups := []RouteGroup{
+		{
+			Prefix: "/admin/",
+			Routes: []Route{
+				{Path: "GET /", HandlerFunc: handler},
+				{Path: "GET /{id}", HandlerFunc: handler},
+				{Path: "/no-method", HandlerFunc: handler},
+			},
+			Groups: []RouteGroup{
+				{
+					Prefix: "users",
+					Routes: []Route{
+						{Path: "POST /{id}/disable", HandlerFunc: handler},
+					},
+				},
+			},
+		},
+	}
+
+	got := []string{}
+
+	for _, route := range flattenRouteGroups(groups) {
+		got = append(got, route.Path)
+	}
+
+	want := []string{
+		"GET /admin/",
+		"GET /admin/{id}",
+		"/admin/no-method",
+		"POST /admin/users/{id}/disable",
+	}
+
+	assert.Equal(t, want, got)
+}
+
+func TestRouteGroups_MiddlewareOrder(t *testing.T) {
+	order := []string{}
+
+	record := func(name string) MiddlewareFunc {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+	}
+
+	authConfig := &auth.AuthMiddlewareConfig{
+		Middleware: record("auth"),
+	}
+
+	router := Setup(
+		Config{Host: "127.0.0.1:0"},
+		[]Route{},
+		context.Background(),
+		func() {},
+
+		WithAuth(authConfig),
+		WithMiddlewares(record("router")),
+		WithRouteGroups(RouteGroup{
+			Prefix:      "/admin",
+			Middlewares: []MiddlewareFunc{record("outer")},
+			Groups: []RouteGroup{
+				{
+					Prefix:      "/users",
+					Middlewares: []MiddlewareFunc{record("inner")},
+					Routes: []Route{
+						{Path: "GET /{id}", HandlerFunc: handler, Middlewares: []MiddlewareFunc{record("route")}},
+					},
+				},
+			},
+		}),
+	)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/admin/users/10", nil)
+	router.Mux.ServeHTTP(w, r)
+
+	assert.Equal(t, []string{"outer", "inner", "route", "router", "auth", "handler"}, order)
+}
+
+func TestRouteGroups_ExcludedPaths(t *testing.T) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	authConfig := &auth.AuthMiddlewareConfig{
+		ExcludedPaths: []string{"/a", "/public"},
+		Middleware: func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusUnauthorized)
+			})
+		},
+	}
+
+	router := Setup(
+		Config{Host: "127.0.0.1:0"},
+		[]Route{{Path: "GET /admin", HandlerFunc: handler}},
+		context.Background(),
+		func() {},
+
+		WithAuth(authConfig),
+		WithRouteGroups(RouteGroup{
+			Prefix: "/public",
+			Routes: []Route{{Path: "GET /about", HandlerFunc: handler}},
+		}),
+	)
+
+	tests := []struct {
+		path string
+		want int
+	}{
+		{path: "/admin", want: http.StatusUnauthorized},
+		{path: "/public/about", want: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		router.Mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		assert.Equal(t, tt.want, w.Code, tt.path)
+	}
+}
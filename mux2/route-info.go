@@ -0,0 +1,141 @@
+package mux2
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"runtime"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+/*
+RouteInfo describes a registered route, as returned by Router.Routes.
+Middlewares lists the middlewares wrapping the handler, outermost first.
+Built-in middlewares have short names, such as "auth" and "csrf". Others
+are named after their function.
+*/
+type RouteInfo struct {
+	Authenticated bool
+	Doc           *RouteDoc
+	Internal      bool
+	Method        string
+	Middlewares   []string
+	Path          string
+	Pattern       string
+}
+
+/*
+RouteDoc documents a route for the OpenAPI document served by WithOpenAPI.
+Request is a value of the JSON request body type, and Responses maps
+status codes to values of the response body types. Use nil for responses
+without a body.
+
+	{
+	  Path:        "POST /things",
+	  HandlerFunc: createThing,
+	  Doc: &mux2.RouteDoc{
+	    Summary:   "Create a thing",
+	    Tags:      []string{"things"},
+	    Request:   CreateThingRequest{},
+	    Responses: map[int]any{201: Thing{}, 400: mux2.ProblemDetails{}},
+	  },
+	}
+*/
+type RouteDoc struct {
+	Deprecated  bool
+	Description string
+	OperationID string
+	Request     any
+	Responses   map[int]any
+	Summary     string
+	Tags        []string
+}
+
+/*
+Routes returns every route registered with the router, sorted by path and
+method. This includes internal routes, such as health checks and static
+assets, which have Internal set.
+*/
+func (r *Router) Routes() []RouteInfo {
+	return slices.Clone(r.opts.routeInfo)
+}
+
+func (opts *routerConfig) addRouteInfo(info RouteInfo) {
+	info.Method, info.Path = splitRoutePattern(info.Pattern)
+	opts.routeInfo = append(opts.routeInfo, info)
+}
+
+func sortRouteInfo(routes []RouteInfo) {
+	slices.SortStableFunc(routes, func(a, b RouteInfo) int {
+		if c := strings.Compare(a.Path, b.Path); c != 0 {
+			return c
+		}
+
+		return strings.Compare(a.Method, b.Method)
+	})
+}
+
+/*
+middlewareName returns the name of a middleware function, such as
+"myapp.requireAdmin", without the package path or closure suffixes.
+*/
+func middlewareName(mw MiddlewareFunc) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(mw).Pointer())
+
+	if fn == nil {
+		return "unknown"
+	}
+
+	name := fn.Name()
+
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+
+	for {
+		i := strings.LastIndex(name, ".func")
+
+		if i < 0 {
+			break
+		}
+
+		name = name[:i]
+	}
+
+	return name
+}
+
+/*
+writeRouteTable writes the routes as an aligned table.
+*/
+func writeRouteTable(w io.Writer, routes []RouteInfo) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+	_, _ = fmt.Fprintln(tw, "METHOD\tPATH\tAUTH\tMIDDLEWARES")
+
+	for _, route := range routes {
+		method := route.Method
+
+		if method == "" {
+			method = "*"
+		}
+
+		auth := ""
+
+		if route.Authenticated {
+			auth = "yes"
+		}
+
+		middlewares := strings.Join(route.Middlewares, ", ")
+
+		if route.Internal {
+			middlewares = "(internal)"
+		}
+
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", method, route.Path, auth, middlewares)
+	}
+
+	_ = tw.Flush()
+}
@@ -0,0 +1,145 @@
+package mux2
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/adampresley/adamgokit/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func requireJSON(next http.Handler) http.Handler {
+	return next
+}
+
+func TestRouter_Routes(t *testing.T) {
+	shutdownCtx, stopApp := context.WithCancel(context.Background())
+	defer stopApp()
+
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+
+	router := Setup(
+		Config{Host: "127.0.0.1:0"},
+		[]Route{
+			{Path: "POST /things", HandlerFunc: noop, Middlewares: []MiddlewareFunc{requireJSON}},
+			{Path: "GET /things/{id}", HandlerFunc: noop},
+		},
+		shutdownCtx,
+		stopApp,
+
+		WithCSRF(),
+		WithHealthChecks(),
+	)
+
+	routes := router.Routes()
+
+	assert.Equal(t, []string{"/healthz", "/readyz", "/things", "/things/{id}"}, []string{routes[0].Path, routes[1].Path, routes[2].Path, routes[3].Path})
+	assert.True(t, routes[0].Internal)
+
+	assert.Equal(t, "POST", routes[2].Method)
+	assert.Equal(t, []string{"mux2.requireJSON", "csrf"}, routes[2].Middlewares, "outermost first")
+	assert.False(t, routes[2].Authenticated)
+
+	table := &bytes.Buffer{}
+	writeRouteTable(table, routes)
+
+	assert.Contains(t, table.String(), "METHOD")
+	assert.Regexp(t, `POST\s+/things\s+mux2.requireJSON, csrf`, table.String())
+	assert.Regexp(t, `GET\s+/healthz\s+\(internal\)`, table.String())
+}
+
+type testThing struct {
+	ID    int      `json:"id"`
+	Name  string   `json:"name"`
+	Tags  []string `json:"tags,omitempty"`
+	Owner *testThing
+	note  string
+}
+
+func TestNewOpenAPIDocument(t *testing.T) {
+	routes := []RouteInfo{
+		{
+			Method: "POST",
+			Path:   "/things",
+			Doc: &RouteDoc{
+				Summary:   "Create a thing",
+				Request:   testThing{},
+				Responses: map[int]any{http.StatusCreated: testThing{}, http.StatusBadRequest: ProblemDetails{}},
+			},
+		},
+		{Method: "GET", Path: "/files/{path...}"},
+		{Path: "/anything"},
+		{Method: "GET", Path: "/healthz", Internal: true},
+	}
+
+	doc := NewOpenAPIDocument(OpenAPIInfo{Title: "Things", Version: "1.0.0"}, routes)
+	paths := doc["paths"].(map[string]any)
+
+	assert.Len(t, paths, 2, "routes without a method and internal routes are skipped")
+
+	files := paths["/files/{path}"].(map[string]any)["get"].(map[string]any)
+	assert.Equal(t, "path", files["parameters"].([]map[string]any)[0]["name"])
+	assert.Contains(t, files["responses"], "200")
+
+	create := paths["/things"].(map[string]any)["post"].(map[string]any)
+	assert.Equal(t, "Create a thing", create["summary"])
+
+	responses := create["responses"].(map[string]any)
+	assert.Contains(t, responses["400"].(map[string]any)["content"], "application/problem+json")
+
+	schemas := doc["components"].(map[string]any)["schemas"].(map[string]any)
+	thing := schemas["testThing"].(map[string]any)
+	properties := thing["properties"].(map[string]any)
+
+	assert.Equal(t, map[string]any{"type": "integer"}, properties["id"])
+	assert.Equal(t, map[string]any{"$ref": "#/components/schemas/testThing"}, properties["Owner"])
+	assert.NotContains(t, properties, "note")
+	assert.Equal(t, []string{"id", "name"}, thing["required"])
+}
+
+/*
+ProblemDetailsAlias lets a test refer to the package's ProblemDetails from
+a function that declares its own.
+*/
+type ProblemDetailsAlias = ProblemDetails
+
+func TestNewOpenAPIDocument_SchemaNameCollisions(t *testing.T) {
+	type ProblemDetails struct {
+		Code int `json:"code"`
+	}
+
+	type Histogram struct {
+		Name string `json:"name"`
+	}
+
+	routes := []RouteInfo{
+		{Method: "GET", Path: "/a", Doc: &RouteDoc{Responses: map[int]any{http.StatusOK: ProblemDetailsAlias{}}}},
+		{Method: "GET", Path: "/b", Doc: &RouteDoc{Responses: map[int]any{http.StatusOK: ProblemDetails{}}}},
+		{Method: "GET", Path: "/c", Doc: &RouteDoc{Responses: map[int]any{http.StatusOK: metrics.Histogram{}}}},
+		{Method: "GET", Path: "/d", Doc: &RouteDoc{Responses: map[int]any{http.StatusOK: Histogram{}}}},
+		{Method: "GET", Path: "/e", Doc: &RouteDoc{Responses: map[int]any{http.StatusOK: Histogram{}}}},
+	}
+
+	doc := NewOpenAPIDocument(OpenAPIInfo{Title: "Things", Version: "1.0.0"}, routes)
+	schemas := doc["components"].(map[string]any)["schemas"].(map[string]any)
+
+	ref := func(path string) any {
+		operation := doc["paths"].(map[string]any)[path].(map[string]any)["get"].(map[string]any)
+		response := operation["responses"].(map[string]any)["200"].(map[string]any)
+
+		for _, content := range response["content"].(map[string]any) {
+			return content.(map[string]any)["schema"].(map[string]any)["$ref"]
+		}
+
+		return nil
+	}
+
+	assert.Len(t, schemas, 4)
+	assert.Equal(t, "#/components/schemas/ProblemDetails", ref("/a"))
+	assert.Equal(t, "#/components/schemas/github.com.adampresley.adamgokit.mux2.ProblemDetails", ref("/b"))
+	assert.Equal(t, "#/components/schemas/Histogram", ref("/c"))
+	assert.Equal(t, "#/components/schemas/github.com.adampresley.adamgokit.mux2.Histogram", ref("/d"))
+	assert.Equal(t, ref("/d"), ref("/e"), "the same type keeps its name")
+}
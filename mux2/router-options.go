@@ -1,49 +1,128 @@
 package mux2
 
 import (
-	"context"
+	"crypto/x509"
 	"io/fs"
+	"log/slog"
+	"net"
+	"net/http"
 	"time"
 
 	"github.com/adampresley/adamgokit/auth"
+	"github.com/adampresley/adamgokit/metrics"
 	"github.com/rs/cors"
 )
 
 type routerConfig struct {
-	address              string
-	authConfig           *auth.AuthMiddlewareConfig
-	cors                 *cors.Cors
-	debug                bool
-	faviconPath          string
-	httpIdleTimeout      time.Duration
-	httpReadTimeout      time.Duration
-	httpWriteTimeout     time.Duration
-	letsEncryptConfig    *LetsEncryptConfig
-	middlewares          []MiddlewareFunc
-	serveStaticContent   bool
-	shutdownCtx          context.Context
-	staticContentRootDir string
-	staticContentPrefix  string
-	staticFS             fs.FS
-	useGzip              bool
-	gzipExcludedPaths    []string
-	useGzipForStaticFS   bool
+	accessLog             bool
+	accessLogger          *slog.Logger
+	address               string
+	authConfig            *auth.AuthMiddlewareConfig
+	certificates          *certificateReloader
+	challengeServer       *http.Server
+	clientCAs             *x509.CertPool
+	connStateHooks        []func(net.Conn, http.ConnState)
+	cors                  *cors.Cors
+	csrf                  bool
+	csrfOptions           []CSRFOption
+	debug                 bool
+	errorHandler          ErrorHandler
+	faviconPath           string
+	health                *healthChecker
+	healthChecks          []HealthCheck
+	healthChecksEnabled   bool
+	h2c                   bool
+	httpIdleTimeout       time.Duration
+	httpReadHeaderTimeout time.Duration
+	httpReadTimeout       time.Duration
+	httpWriteTimeout      time.Duration
+	letsEncryptConfig     *LetsEncryptConfig
+	maxBodyBytes          int64
+	maxHeaderBytes        int
+	methodNotAllowed      http.Handler
+	metricsPath           string
+	metricsRegistry       *metrics.Registry
+	middlewares           []MiddlewareFunc
+	notFound              http.Handler
+	openAPIInfo           OpenAPIInfo
+	openAPIPath           string
+	postShutdownHooks     []ShutdownHook
+	preShutdownHooks      []ShutdownHook
+	rateLimit             *RateLimit
+	rateLimitOptions      []RateLimitOption
+	recovery              bool
+	requestID             bool
+	requestTimeout        time.Duration
+	requestTimeoutOptions []TimeoutOption
+	routeGroups           []RouteGroup
+	routeInfo             []RouteInfo
+	securityHeaders       bool
+	securityHeadersOpts   []SecurityHeadersOption
+	sharedRouteMetrics    map[*metrics.Registry]*routeMetrics
+	serveStaticContent    bool
+	shutdownTimeout       time.Duration
+	staticAssets          *StaticAssets
+	staticContentRootDir  string
+	staticContentPrefix   string
+	staticFS              fs.FS
+	tlsCertFile           string
+	tlsKeyFile            string
+	trustedProxies        []string
+	compressionOptions    []CompressionOption
+	useCompression        bool
+	useCompressionForFS   bool
 }
 
 type RouterOption func(r *routerConfig)
 
+/*
+WithAccessLog writes a structured log entry for every request, including
+status, bytes written, and latency. An optional logger may be provided.
+Otherwise slog.Default() is used.
+*/
+func WithAccessLog(logger ...*slog.Logger) RouterOption {
+	return func(r *routerConfig) {
+		r.accessLog = true
+
+		if len(logger) > 0 {
+			r.accessLogger = logger[0]
+		}
+	}
+}
+
 func WithAuth(config *auth.AuthMiddlewareConfig) RouterOption {
 	return func(r *routerConfig) {
 		r.authConfig = config
 	}
 }
 
+/*
+WithConnStateHooks registers functions that are called when a client
+connection changes state. See http.Server.ConnState.
+*/
+func WithConnStateHooks(hooks ...func(conn net.Conn, state http.ConnState)) RouterOption {
+	return func(r *routerConfig) {
+		r.connStateHooks = append(r.connStateHooks, hooks...)
+	}
+}
+
 func WithCors(options cors.Options) RouterOption {
 	return func(r *routerConfig) {
 		r.cors = cors.New(options)
 	}
 }
 
+/*
+WithCSRF protects every route from cross-site request forgery. See
+NewCSRFMiddleware for details.
+*/
+func WithCSRF(options ...CSRFOption) RouterOption {
+	return func(r *routerConfig) {
+		r.csrf = true
+		r.csrfOptions = options
+	}
+}
+
 func WithDebug(enable bool) RouterOption {
 	return func(r *routerConfig) {
 		r.debug = enable
@@ -56,12 +135,58 @@ func FaviconPath(path string) RouterOption {
 	}
 }
 
+/*
+WithErrorHandler sets the handler used for error responses, including
+unmatched routes, panics, rate limiting, and CSRF failures. Handlers can
+use it too, with WriteError. Use NewTemplateErrorHandler to render error
+pages with a template.
+*/
+func WithErrorHandler(handler ErrorHandler) RouterOption {
+	return func(r *routerConfig) {
+		r.errorHandler = handler
+	}
+}
+
+/*
+WithH2C serves HTTP/2 over cleartext connections (h2c) alongside HTTP/1.1.
+Use this when a proxy in front of the server terminates TLS and speaks
+HTTP/2 to it, as gRPC and many cloud load balancers do.
+*/
+func WithH2C() RouterOption {
+	return func(r *routerConfig) {
+		r.h2c = true
+	}
+}
+
+/*
+WithHealthChecks registers a liveness endpoint at GET /healthz and a
+readiness endpoint at GET /readyz. Readiness runs the provided checks
+and returns 503 if any fail, or as soon as graceful shutdown begins.
+Both endpoints bypass authentication and return JSON.
+*/
+func WithHealthChecks(checks ...HealthCheck) RouterOption {
+	return func(r *routerConfig) {
+		r.healthChecksEnabled = true
+		r.healthChecks = append(r.healthChecks, checks...)
+	}
+}
+
 func WithIdleTimeout(timeout time.Duration) RouterOption {
 	return func(r *routerConfig) {
 		r.httpIdleTimeout = timeout
 	}
 }
 
+/*
+WithReadHeaderTimeout sets how long the server waits to read request
+headers. If zero, the read timeout is used.
+*/
+func WithReadHeaderTimeout(timeout time.Duration) RouterOption {
+	return func(r *routerConfig) {
+		r.httpReadHeaderTimeout = timeout
+	}
+}
+
 func WithReadTimeout(timeout time.Duration) RouterOption {
 	return func(r *routerConfig) {
 		r.httpReadTimeout = timeout
@@ -80,12 +205,221 @@ func WithLetsEncrypt(config *LetsEncryptConfig) RouterOption {
 	}
 }
 
+/*
+WithMaxBodyBytes limits the size of request bodies for every route. A
+route can override this with its MaxBodyBytes field. Requests that exceed
+the limit get a 413.
+*/
+func WithMaxBodyBytes(maxBytes int64) RouterOption {
+	return func(r *routerConfig) {
+		r.maxBodyBytes = maxBytes
+	}
+}
+
+/*
+WithMaxHeaderBytes limits the size of request headers, including the
+request line. The default is http.DefaultMaxHeaderBytes (1MB).
+*/
+func WithMaxHeaderBytes(maxBytes int) RouterOption {
+	return func(r *routerConfig) {
+		r.maxHeaderBytes = maxBytes
+	}
+}
+
+/*
+WithMethodNotAllowedHandler sets the handler for requests to a path that
+has routes, but not for the request method. The Allow header is set
+before it is called. By default a 405 is written with WriteError.
+*/
+func WithMethodNotAllowedHandler(handler http.Handler) RouterOption {
+	return func(r *routerConfig) {
+		r.methodNotAllowed = handler
+	}
+}
+
+/*
+WithMetrics instruments every route with request counters, in-flight
+gauges, and latency histograms, and serves them in the Prometheus text
+format at path (for example "/metrics"). The registry is available as
+Router.Metrics, so other metrics, such as SSE connections and cron job
+runs, can be registered alongside.
+*/
+func WithMetrics(path string) RouterOption {
+	return func(r *routerConfig) {
+		r.metricsPath = path
+	}
+}
+
+/*
+WithMetricsRegistry sets the registry that route metrics are registered
+in. Use this when metrics are registered before the router is set up.
+If not provided, WithMetrics creates a new registry.
+*/
+func WithMetricsRegistry(registry *metrics.Registry) RouterOption {
+	return func(r *routerConfig) {
+		r.metricsRegistry = registry
+	}
+}
+
 func WithMiddlewares(middlewares ...MiddlewareFunc) RouterOption {
 	return func(r *routerConfig) {
 		r.middlewares = append(r.middlewares, middlewares...)
 	}
 }
 
+/*
+WithMutualTLS requires clients to present a certificate signed by one of
+the CAs in clientCAs. The verified identity is available to handlers
+through ClientIdentityFromContext. Use LoadCertPool to read CAs from PEM
+files. This requires a server certificate from WithTLSCertificate or
+WithLetsEncrypt.
+*/
+func WithMutualTLS(clientCAs *x509.CertPool) RouterOption {
+	return func(r *routerConfig) {
+		r.clientCAs = clientCAs
+	}
+}
+
+/*
+WithNotFoundHandler sets the handler for requests that don't match any
+route. By default a 404 is written with WriteError.
+*/
+func WithNotFoundHandler(handler http.Handler) RouterOption {
+	return func(r *routerConfig) {
+		r.notFound = handler
+	}
+}
+
+/*
+WithOpenAPI serves an OpenAPI 3 document describing the router's routes
+at path, such as "/openapi.json". Annotate routes with Route.Doc to add
+summaries and request and response schemas.
+*/
+func WithOpenAPI(path string, info OpenAPIInfo) RouterOption {
+	return func(r *routerConfig) {
+		r.openAPIPath = path
+		r.openAPIInfo = info
+	}
+}
+
+/*
+WithPostShutdownHooks registers functions to run after the HTTP server has
+finished draining connections. This is a good place to close session
+stores and database connections.
+*/
+func WithPostShutdownHooks(hooks ...ShutdownHook) RouterOption {
+	return func(r *routerConfig) {
+		r.postShutdownHooks = append(r.postShutdownHooks, hooks...)
+	}
+}
+
+/*
+WithPreShutdownHooks registers functions to run before the HTTP server
+begins draining connections. This is a good place to stop cron jobs and
+SSE brokers so long-lived requests can finish.
+*/
+func WithPreShutdownHooks(hooks ...ShutdownHook) RouterOption {
+	return func(r *routerConfig) {
+		r.preShutdownHooks = append(r.preShutdownHooks, hooks...)
+	}
+}
+
+/*
+WithRateLimit applies a token bucket rate limit to every request. To limit
+only certain routes, add NewRateLimitMiddleware to Route.Middlewares instead.
+*/
+func WithRateLimit(limit RateLimit, options ...RateLimitOption) RouterOption {
+	return func(r *routerConfig) {
+		r.rateLimit = &limit
+		r.rateLimitOptions = options
+	}
+}
+
+/*
+WithRecovery recovers from panics in handlers, logs them, and responds
+with a 500.
+*/
+func WithRecovery() RouterOption {
+	return func(r *routerConfig) {
+		r.recovery = true
+	}
+}
+
+/*
+WithRequestID assigns every request an ID, or uses the one provided
+in the X-Request-ID header. Use RequestIDFromContext or RequestLogger
+to retrieve it in handlers.
+*/
+func WithRequestID() RouterOption {
+	return func(r *routerConfig) {
+		r.requestID = true
+	}
+}
+
+/*
+WithRequestTimeout gives every route a deadline. A route can override
+this with its Timeout field, and routes with Streaming set are skipped.
+Unlike WithWriteTimeout, the handler's context is cancelled and the client
+gets an error response. See NewTimeoutMiddleware.
+*/
+func WithRequestTimeout(timeout time.Duration, options ...TimeoutOption) RouterOption {
+	return func(r *routerConfig) {
+		r.requestTimeout = timeout
+		r.requestTimeoutOptions = options
+	}
+}
+
+/*
+WithRouteGroups registers groups of routes that share a path prefix and
+middlewares. Grouped routes are registered alongside the routes passed
+to Setup.
+*/
+func WithRouteGroups(groups ...RouteGroup) RouterOption {
+	return func(r *routerConfig) {
+		r.routeGroups = append(r.routeGroups, groups...)
+	}
+}
+
+/*
+WithSecurityHeaders sets HSTS, X-Content-Type-Options, Referrer-Policy,
+Permissions-Policy, X-Frame-Options, and optionally Content-Security-Policy
+headers on every response. See NewSecurityHeadersMiddleware for the
+defaults. When a CSP report path is configured with WithCSPReportOnly,
+the router also serves the report endpoint.
+*/
+func WithSecurityHeaders(options ...SecurityHeadersOption) RouterOption {
+	return func(r *routerConfig) {
+		r.securityHeaders = true
+		r.securityHeadersOpts = options
+	}
+}
+
+/*
+WithShutdownTimeout sets how long the server waits for in-flight requests
+to finish during a graceful shutdown. Defaults to 15 seconds.
+*/
+func WithShutdownTimeout(timeout time.Duration) RouterOption {
+	return func(r *routerConfig) {
+		r.shutdownTimeout = timeout
+	}
+}
+
+/*
+WithStaticAssets serves a set of static assets created with NewStaticAssets.
+Create the assets before the router when templates need the "assetPath"
+function at startup.
+*/
+func WithStaticAssets(assets *StaticAssets) RouterOption {
+	return func(r *routerConfig) {
+		r.staticAssets = assets
+	}
+}
+
+/*
+WithStaticContent serves static files from fs. Files are fingerprinted
+and may be precompressed. See StaticAssets. The assets are available as
+Router.Assets.
+*/
 func WithStaticContent(rootDir, prefix string, fs fs.FS) RouterOption {
 	return func(r *routerConfig) {
 		r.serveStaticContent = true
@@ -95,15 +429,56 @@ func WithStaticContent(rootDir, prefix string, fs fs.FS) RouterOption {
 	}
 }
 
-func UseGzip(excludedPaths ...string) RouterOption {
+/*
+WithTrustedProxies resolves the real client IP address, scheme, and host
+for requests from the given proxies (CIDR ranges or single addresses, such
+as "10.0.0.0/8"). This runs before every other middleware, so access logs,
+rate limiting, and handlers all see the client's address through
+httphelpers.ClientIP. See NewRealIPMiddleware.
+*/
+func WithTrustedProxies(proxies ...string) RouterOption {
+	return func(r *routerConfig) {
+		r.trustedProxies = append(r.trustedProxies, proxies...)
+	}
+}
+
+/*
+WithTLSCertificate serves HTTPS using a PEM encoded certificate and key
+from disk. The files are watched for changes and reloaded, so renewed
+certificates are picked up without a restart.
+*/
+func WithTLSCertificate(certFile, keyFile string) RouterOption {
 	return func(r *routerConfig) {
-		r.useGzip = true
-		r.gzipExcludedPaths = excludedPaths
+		r.tlsCertFile = certFile
+		r.tlsKeyFile = keyFile
 	}
 }
 
+/*
+UseCompression compresses route responses with the best coding the client
+accepts (gzip or deflate by default). See NewCompressionMiddleware for
+details and options.
+*/
+func UseCompression(options ...CompressionOption) RouterOption {
+	return func(r *routerConfig) {
+		r.useCompression = true
+		r.compressionOptions = append(r.compressionOptions, options...)
+	}
+}
+
+/*
+UseGzip compresses route responses, skipping any paths starting with
+one of excludedPaths. Despite the name, deflate is also negotiated.
+*/
+func UseGzip(excludedPaths ...string) RouterOption {
+	return UseCompression(WithExcludedPaths(excludedPaths...))
+}
+
+/*
+UseGzipForStaticFiles compresses static content served with WithStaticContent.
+*/
 func UseGzipForStaticFiles() RouterOption {
 	return func(r *routerConfig) {
-		r.useGzipForStaticFS = true
+		r.useCompressionForFS = true
 	}
 }
@@ -3,14 +3,19 @@ package mux2
 import (
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
-	"io/fs"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/adampresley/adamgokit/metrics"
 	"github.com/adampresley/adamgokit/waiter"
 	"github.com/rs/cors"
 )
@@ -36,15 +41,47 @@ type Route struct {
 	Handler     http.Handler
 	HandlerFunc http.HandlerFunc
 	Middlewares []MiddlewareFunc
+
+	/*
+	 * MaxBodyBytes limits the size of the request body. Zero uses the
+	 * router default from WithMaxBodyBytes, and a negative value
+	 * removes the limit.
+	 */
+	MaxBodyBytes int64
+
+	/*
+	 * Timeout sets a deadline for the handler. Zero uses the router
+	 * default from WithRequestTimeout, and a negative value removes
+	 * the deadline.
+	 */
+	Timeout time.Duration
+
+	/*
+	 * Streaming marks routes that stream their response or upgrade the
+	 * connection, such as an sse.SseBroker or websocket handler. These
+	 * are never given a timeout.
+	 */
+	Streaming bool
+
+	/*
+	 * Doc describes the route in the OpenAPI document served by
+	 * WithOpenAPI. Routes without a Doc are still listed.
+	 */
+	Doc *RouteDoc
 }
 
 type Router struct {
-	Mux    *http.ServeMux
-	Server *http.Server
-
-	opts        *routerConfig
-	shutdownCtx context.Context
-	stopApp     context.CancelFunc
+	Assets  *StaticAssets
+	Metrics *metrics.Registry
+	Mux     *http.ServeMux
+	Server  *http.Server
+
+	name         string
+	opts         *routerConfig
+	shutdownCtx  context.Context
+	shutdownErr  error
+	shutdownOnce sync.Once
+	stopApp      context.CancelFunc
 }
 
 /*
@@ -63,10 +100,11 @@ func Setup(config MuxConfig, routes []Route, shutdownCtx context.Context, stopAp
 		letsEncryptConfig:    nil,
 		middlewares:          []MiddlewareFunc{},
 		serveStaticContent:   false,
+		shutdownTimeout:      15 * time.Second,
 		staticContentRootDir: "",
 		staticContentPrefix:  "",
 		staticFS:             nil,
-		useGzipForStaticFS:   false,
+		useCompressionForFS:  false,
 	}
 
 	for _, opt := range options {
@@ -75,12 +113,18 @@ func Setup(config MuxConfig, routes []Route, shutdownCtx context.Context, stopAp
 
 	validateConfig(opts)
 
+	if opts.serveStaticContent && opts.staticAssets == nil {
+		opts.staticAssets = getStaticAssets(opts)
+	}
+
 	m := setupMux(routes, opts)
 	s := setupServer(opts, m)
 
 	result := &Router{
-		Mux:    m,
-		Server: s,
+		Assets:  opts.staticAssets,
+		Metrics: opts.metricsRegistry,
+		Mux:     m,
+		Server:  s,
 
 		opts:        opts,
 		shutdownCtx: shutdownCtx,
@@ -91,32 +135,223 @@ func Setup(config MuxConfig, routes []Route, shutdownCtx context.Context, stopAp
 }
 
 /*
-Starts the HTTP server. This method blocks until the server is stopped.
+Starts the HTTP server. The listener runs in the background, and this method
+blocks until the shutdown context is cancelled, an interrupt or terminate
+signal is received, or the listener fails. The server is then gracefully
+shut down (see Shutdown). Errors are returned rather than exiting the process.
+*/
+func (r *Router) Start() error {
+	listener, err := r.listen()
+
+	if err != nil {
+		r.cancelApp()
+		return err
+	}
+
+	return r.Serve(listener)
+}
+
+/*
+Serve behaves like Start, but accepts connections on an existing listener.
+This method blocks until the server is shut down.
+*/
+func (r *Router) Serve(listener net.Listener) error {
+	return serveRouters(r.shutdownCtx, r.cancelApp, r.Shutdown, []*Router{r}, []net.Listener{listener})
+}
+
+/*
+serveRouters serves each router on its listener, then blocks until the
+shutdown context is cancelled, an interrupt or terminate signal is
+received, or any of them fails. The app is stopped, and shutdown is
+called to gracefully stop every router. It is used by Router.Serve and
+Server.Start.
+*/
+func serveRouters(shutdownCtx context.Context, cancelApp func(), shutdown func() error, routers []*Router, listeners []net.Listener) error {
+	/*
+	 * Every router sends one error when its server stops, and may send
+	 * another from a Let's Encrypt challenge server.
+	 */
+	serverErr := make(chan error, 2*len(routers))
+
+	quit := waiter.Wait()
+	defer signal.Stop(quit)
+
+	for index, router := range routers {
+		if err := router.serve(listeners[index], serverErr); err != nil {
+			closeListeners(listeners[index+1:])
+			cancelApp()
+			return errors.Join(err, shutdown())
+		}
+	}
+
+	select {
+	case err := <-serverErr:
+		cancelApp()
+
+		if !errors.Is(err, http.ErrServerClosed) {
+			return errors.Join(fmt.Errorf("HTTP server stopped unexpectedly: %w", err), shutdown())
+		}
+
+	case <-quit:
+		slog.Info("received shutdown signal")
+		cancelApp()
+
+	case <-shutdownCtx.Done():
+	}
+
+	return shutdown()
+}
+
+/*
+listen loads the TLS certificate, if there is one, and opens a listener on
+the router's address. Addresses starting with "unix:" are Unix domain
+sockets.
 */
-func (r *Router) Start() {
+func (r *Router) listen() (net.Listener, error) {
 	var (
-		err error
+		err      error
+		listener net.Listener
 	)
 
-	slog.Info("starting HTTP server", slog.String("address", r.opts.address))
+	if r.opts.certificates != nil {
+		if err = r.opts.certificates.load(); err != nil {
+			return nil, err
+		}
+	}
 
-	if r.opts.letsEncryptConfig != nil {
-		err = r.Server.ListenAndServeTLS("", "")
-	} else {
-		err = r.Server.ListenAndServe()
+	if listener, err = listen(r.opts.address); err != nil {
+		return nil, fmt.Errorf("error starting HTTP server%s: %w", r.nameSuffix(), err)
 	}
 
-	if err != nil && err != http.ErrServerClosed {
-		slog.Error("error starting HTTP server", slog.Any("error", err))
-		os.Exit(-1)
+	return listener, nil
+}
+
+/*
+serve starts the HTTP server, and the Let's Encrypt challenge server if
+there is one, in the background. Errors from either are sent to
+serverErr. The HTTP server always sends one, which is
+http.ErrServerClosed after a graceful shutdown.
+*/
+func (r *Router) serve(listener net.Listener, serverErr chan<- error) error {
+	if r.opts.challengeServer != nil {
+		challengeListener, err := net.Listen("tcp", r.opts.challengeServer.Addr)
+
+		if err != nil {
+			_ = listener.Close()
+			return fmt.Errorf("error starting Let's Encrypt challenge server%s: %w", r.nameSuffix(), err)
+		}
+
+		slog.Info("starting Let's Encrypt challenge server", slog.String("address", challengeListener.Addr().String()))
+
+		go func() {
+			if err := r.opts.challengeServer.Serve(challengeListener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				serverErr <- fmt.Errorf("Let's Encrypt challenge server%s: %w", r.nameSuffix(), err)
+			}
+		}()
+	}
+
+	if r.opts.debug {
+		writeRouteTable(os.Stdout, r.opts.routeInfo)
+	}
+
+	logger := slog.Default()
+
+	if r.name != "" {
+		logger = logger.With(slog.String("listener", r.name))
 	}
 
+	logger.Info("starting HTTP server", slog.String("address", listener.Addr().String()))
+
 	go func() {
-		<-waiter.Wait()
-		r.stopApp()
+		var err error
+
+		if r.Server.TLSConfig != nil {
+			err = r.Server.ServeTLS(listener, "", "")
+		} else {
+			err = r.Server.Serve(listener)
+		}
+
+		if r.name != "" {
+			err = fmt.Errorf("%s listener: %w", r.name, err)
+		}
+
+		serverErr <- err
 	}()
 
-	<-r.shutdownCtx.Done()
+	return nil
+}
+
+func (r *Router) nameSuffix() string {
+	if r.name == "" {
+		return ""
+	}
+
+	return fmt.Sprintf(" for %s listener", r.name)
+}
+
+/*
+Shutdown gracefully stops the HTTP server. Pre-shutdown hooks run first, then
+the server stops accepting connections and waits up to the shutdown timeout
+for in-flight requests to finish. Connections still open after the timeout
+are closed. Post-shutdown hooks run last, with a fresh timeout of their own.
+It is safe to call Shutdown more than once; later calls return the result
+of the first.
+*/
+func (r *Router) Shutdown() error {
+	r.shutdownOnce.Do(func() {
+		r.shutdownErr = r.shutdown()
+	})
+
+	return r.shutdownErr
+}
+
+func (r *Router) shutdown() error {
+	var (
+		errs []error
+	)
+
+	logger := slog.Default()
+
+	if r.name != "" {
+		logger = logger.With(slog.String("listener", r.name))
+	}
+
+	logger.Info("shutting down HTTP server", slog.Duration("timeout", r.opts.shutdownTimeout))
+
+	if r.opts.health != nil {
+		r.opts.health.shuttingDown.Store(true)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), r.opts.shutdownTimeout)
+	defer cancel()
+
+	errs = append(errs, runShutdownHooks(ctx, r.opts.preShutdownHooks)...)
+
+	if err := r.Server.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("error draining HTTP server connections: %w", err))
+		_ = r.Server.Close()
+	}
+
+	if r.opts.challengeServer != nil {
+		if err := r.opts.challengeServer.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("error shutting down Let's Encrypt challenge server: %w", err))
+			_ = r.opts.challengeServer.Close()
+		}
+	}
+
+	postCtx, postCancel := context.WithTimeout(context.Background(), r.opts.shutdownTimeout)
+	defer postCancel()
+
+	errs = append(errs, runShutdownHooks(postCtx, r.opts.postShutdownHooks)...)
+
+	logger.Info("shut down complete")
+	return errors.Join(errs...)
+}
+
+func (r *Router) cancelApp() {
+	if r.stopApp != nil {
+		r.stopApp()
+	}
 }
 
 func validateConfig(config *routerConfig) {
@@ -135,25 +370,71 @@ func validateConfig(config *routerConfig) {
 			config.staticContentPrefix = "/static/"
 		}
 	}
+
+	if config.letsEncryptConfig != nil && config.tlsCertFile != "" {
+		panic("cannot use both Let's Encrypt and a static TLS certificate.")
+	}
+
+	if config.clientCAs != nil && config.letsEncryptConfig == nil && config.tlsCertFile == "" {
+		panic("mutual TLS requires a server certificate. use WithTLSCertificate or WithLetsEncrypt.")
+	}
+
+	if config.metricsPath != "" && config.metricsRegistry == nil {
+		config.metricsRegistry = metrics.NewRegistry()
+	}
 }
 
 func setupMux(routes []Route, opts *routerConfig) *http.ServeMux {
 	var (
-		staticFS      http.Handler
 		excludedPaths []string
+		instruments   *routeMetrics
+		compression   MiddlewareFunc
+		csrf          MiddlewareFunc
 	)
 
 	m := http.NewServeMux()
 
-	if opts.serveStaticContent {
-		staticFS = http.FileServer(getStaticFileSystem(opts))
-		var wrappedStaticFS http.Handler = staticFS
+	if opts.useCompression {
+		compression = NewCompressionMiddleware(opts.compressionOptions...)
+	}
+
+	if opts.csrf {
+		csrf = NewCSRFMiddleware(opts.csrfOptions...)
+	}
+
+	if opts.healthChecksEnabled {
+		opts.health = newHealthChecker(opts.healthChecks)
+		m.HandleFunc("GET /healthz", opts.health.liveness)
+		m.HandleFunc("GET /readyz", opts.health.readiness)
+
+		opts.addRouteInfo(RouteInfo{Pattern: "GET /healthz", Internal: true})
+		opts.addRouteInfo(RouteInfo{Pattern: "GET /readyz", Internal: true})
+	}
+
+	if opts.metricsPath != "" {
+		instruments = opts.instruments()
+		m.Handle(fmt.Sprintf("GET %s", opts.metricsPath), opts.metricsRegistry)
+		opts.addRouteInfo(RouteInfo{Pattern: fmt.Sprintf("GET %s", opts.metricsPath), Internal: true})
+	}
 
-		if opts.useGzipForStaticFS {
-			wrappedStaticFS = NewGzipMiddleware()(wrappedStaticFS)
+	if opts.securityHeaders {
+		securityConfig := newSecurityHeadersConfig(opts.securityHeadersOpts...)
+
+		if securityConfig.CSPReportPath != "" {
+			m.Handle(fmt.Sprintf("POST %s", securityConfig.CSPReportPath), NewCSPReportHandler(securityConfig.CSPReportHandler))
+			opts.addRouteInfo(RouteInfo{Pattern: fmt.Sprintf("POST %s", securityConfig.CSPReportPath), Internal: true})
 		}
+	}
+
+	if opts.staticAssets != nil {
+		var staticHandler http.Handler = opts.staticAssets
 
-		m.Handle(fmt.Sprintf("GET %s", normalizeStaticContentPrefix(opts.staticContentPrefix)), wrappedStaticFS)
+		if opts.useCompressionForFS {
+			staticHandler = NewCompressionMiddleware(opts.compressionOptions...)(staticHandler)
+		}
+
+		m.Handle(fmt.Sprintf("GET %s", opts.staticAssets.Prefix()), staticHandler)
+		opts.addRouteInfo(RouteInfo{Pattern: fmt.Sprintf("GET %s", opts.staticAssets.Prefix()), Internal: true})
 	}
 
 	if opts.authConfig != nil {
@@ -166,8 +447,17 @@ func setupMux(routes []Route, opts *routerConfig) *http.ServeMux {
 		excludedPaths = append(excludedPaths, opts.authConfig.ExcludedPaths...)
 	}
 
-	for _, route := range routes {
-		var handler http.Handler
+	allRoutes := make([]Route, 0, len(routes))
+	allRoutes = append(allRoutes, routes...)
+	allRoutes = append(allRoutes, flattenRouteGroups(opts.routeGroups)...)
+
+	for index, route := range allRoutes {
+		var (
+			handler     http.Handler
+			middlewares []string
+		)
+
+		info := RouteInfo{Pattern: route.Path, Doc: route.Doc}
 
 		if route.HandlerFunc != nil {
 			handler = http.HandlerFunc(route.HandlerFunc)
@@ -177,15 +467,34 @@ func setupMux(routes []Route, opts *routerConfig) *http.ServeMux {
 			handler = route.Handler
 		}
 
+		/*
+		 * CSRF protection wraps the handler, so it also covers
+		 * routes excluded from auth, such as login forms.
+		 */
+		if csrf != nil {
+			handler = csrf(handler)
+			middlewares = append(middlewares, "csrf")
+		}
+
 		/*
 		 * If we have an auth configuration, and the path isn't excluded,
 		 * wrap in the auth middleware.
 		 */
 		if opts.authConfig != nil {
 			included := true
+			path := route.Path
+
+			/*
+			 * Route group patterns are built with the method in front,
+			 * so they are compared by path. Routes passed to Setup are
+			 * compared by the pattern as written.
+			 */
+			if index >= len(routes) {
+				_, path = splitRoutePattern(route.Path)
+			}
 
 			for _, excluded := range excludedPaths {
-				if strings.HasPrefix(route.Path, excluded) {
+				if strings.HasPrefix(route.Path, excluded) || strings.HasPrefix(path, excluded) {
 					included = false
 					break
 				}
@@ -193,8 +502,9 @@ func setupMux(routes []Route, opts *routerConfig) *http.ServeMux {
 
 			if included {
 				handler = opts.authConfig.Middleware(handler)
+				middlewares = append(middlewares, "auth")
+				info.Authenticated = true
 			}
-
 		}
 
 		/*
@@ -202,61 +512,215 @@ func setupMux(routes []Route, opts *routerConfig) *http.ServeMux {
 		 */
 		for _, mw := range opts.middlewares {
 			handler = mw(handler)
+			middlewares = append(middlewares, middlewareName(mw))
+		}
+
+		timeout := route.Timeout
+
+		if timeout == 0 {
+			timeout = opts.requestTimeout
+		}
+
+		if timeout > 0 && !route.Streaming {
+			handler = NewTimeoutMiddleware(timeout, opts.requestTimeoutOptions...)(handler)
+			middlewares = append(middlewares, "timeout")
 		}
 
 		/*
-		 * Wrap in any additional route-configured middlewares.
+		 * Wrap in any additional route-configured middlewares. For routes
+		 * declared in a RouteGroup these include the group middlewares,
+		 * so they wrap the router-level middlewares.
 		 */
 		for _, mw := range route.Middlewares {
 			handler = mw(handler)
+			middlewares = append(middlewares, middlewareName(mw))
+		}
+
+		if instruments != nil {
+			handler = instruments.instrument(route.Path, handler)
+			middlewares = append(middlewares, "metrics")
 		}
 
-		/* Wrap in gzip middleware if enabled */
-		if opts.useGzip {
-			handler = NewGzipMiddleware(WithExcludedPaths(opts.gzipExcludedPaths...))(handler)
+		/* Wrap in compression middleware if enabled */
+		if compression != nil {
+			handler = compression(handler)
+			middlewares = append(middlewares, "compression")
+		}
+
+		/*
+		 * The body limit is the outermost wrapper, so it applies before
+		 * any middleware reads the body, such as CSRF checking a form.
+		 */
+		maxBodyBytes := route.MaxBodyBytes
+
+		if maxBodyBytes == 0 {
+			maxBodyBytes = opts.maxBodyBytes
+		}
+
+		if maxBodyBytes > 0 {
+			handler = NewMaxBodyBytesMiddleware(maxBodyBytes)(handler)
+			middlewares = append(middlewares, "maxBodyBytes")
 		}
 
 		m.HandleFunc(route.Path, http.HandlerFunc(handler.ServeHTTP))
+
+		slices.Reverse(middlewares)
+		info.Middlewares = middlewares
+		opts.addRouteInfo(info)
+	}
+
+	/*
+	 * The OpenAPI document is built from the routes registered above,
+	 * so it is registered last, and doesn't list itself.
+	 */
+	if opts.openAPIPath != "" {
+		pattern := fmt.Sprintf("GET %s", opts.openAPIPath)
+
+		m.Handle(pattern, newOpenAPIHandler(opts.openAPIInfo, opts.routeInfo))
+		opts.addRouteInfo(RouteInfo{Pattern: pattern, Internal: true})
 	}
 
+	sortRouteInfo(opts.routeInfo)
 	return m
 }
 
 func setupServer(opts *routerConfig, m *http.ServeMux) *http.Server {
 	var (
-		tlsConfig *tls.Config
-		server    *http.Server
+		server *http.Server
 	)
 
-	if opts.letsEncryptConfig != nil {
-		tlsConfig = startCertManager(*opts.letsEncryptConfig)
+	server = &http.Server{
+		Addr:              opts.address,
+		WriteTimeout:      opts.httpWriteTimeout,
+		ReadTimeout:       opts.httpReadTimeout,
+		ReadHeaderTimeout: opts.httpReadHeaderTimeout,
+		IdleTimeout:       opts.httpIdleTimeout,
+		MaxHeaderBytes:    opts.maxHeaderBytes,
+		Handler:           setupHandler(opts, m),
+		TLSConfig:         setupTLS(opts),
 	}
 
-	server = &http.Server{
-		Addr:         opts.address,
-		WriteTimeout: opts.httpWriteTimeout,
-		ReadTimeout:  opts.httpReadTimeout,
-		IdleTimeout:  opts.httpIdleTimeout,
-		Handler:      opts.cors.Handler(m),
-		TLSConfig:    tlsConfig,
+	if opts.h2c {
+		server.Protocols = &http.Protocols{}
+		server.Protocols.SetHTTP1(true)
+		server.Protocols.SetHTTP2(true)
+		server.Protocols.SetUnencryptedHTTP2(true)
+	}
+
+	if len(opts.connStateHooks) > 0 {
+		hooks := opts.connStateHooks
+
+		server.ConnState = func(conn net.Conn, state http.ConnState) {
+			for _, hook := range hooks {
+				hook(conn, state)
+			}
+		}
 	}
 
 	return server
 }
 
-func getStaticFileSystem(opts *routerConfig) http.FileSystem {
-	if opts.debug {
-		return http.FS(os.DirFS(opts.staticContentRootDir))
+/*
+setupTLS builds the TLS configuration from either Let's Encrypt or a
+static certificate, adding client certificate verification when mutual
+TLS is enabled. It returns nil when TLS is not configured.
+*/
+func setupTLS(opts *routerConfig) *tls.Config {
+	var (
+		tlsConfig *tls.Config
+	)
+
+	switch {
+	case opts.letsEncryptConfig != nil:
+		tlsConfig, opts.challengeServer = startCertManager(*opts.letsEncryptConfig, opts.address)
+
+	case opts.tlsCertFile != "":
+		opts.certificates = newCertificateReloader(opts.tlsCertFile, opts.tlsKeyFile)
+
+		tlsConfig = &tls.Config{
+			GetCertificate: opts.certificates.GetCertificate,
+			MinVersion:     tls.VersionTLS12,
+			NextProtos:     []string{"h2", "http/1.1"},
+		}
+
+	default:
+		return nil
+	}
+
+	if opts.clientCAs != nil {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		tlsConfig.ClientCAs = opts.clientCAs
+	}
+
+	return tlsConfig
+}
+
+/*
+setupHandler wraps the mux in the middlewares that apply to every request,
+including those that don't match a route. From outermost to innermost
+these are real IP resolution, request ID, the error handler, access log,
+panic recovery, security headers, rate limiting, CORS, and the mutual TLS
+client identity. Unmatched requests go to the not found and method not
+allowed handlers.
+*/
+func setupHandler(opts *routerConfig, m *http.ServeMux) http.Handler {
+	var handler http.Handler = newErrorPagesHandler(opts, m)
+
+	handler = opts.cors.Handler(handler)
+
+	if opts.clientCAs != nil {
+		handler = newClientIdentityMiddleware()(handler)
 	}
 
-	fsys, err := fs.Sub(opts.staticFS, opts.staticContentRootDir)
+	if opts.rateLimit != nil {
+		handler = NewRateLimitMiddleware(*opts.rateLimit, opts.rateLimitOptions...)(handler)
+	}
+
+	if opts.securityHeaders {
+		handler = NewSecurityHeadersMiddleware(opts.securityHeadersOpts...)(handler)
+	}
+
+	if opts.recovery {
+		handler = NewRecoveryMiddleware()(handler)
+	}
+
+	if opts.accessLog {
+		handler = NewAccessLogMiddleware(opts.accessLogger)(handler)
+	}
+
+	if opts.errorHandler != nil {
+		handler = newErrorHandlerMiddleware(opts.errorHandler)(handler)
+	}
+
+	if opts.requestID {
+		handler = NewRequestIDMiddleware()(handler)
+	}
+
+	if len(opts.trustedProxies) > 0 {
+		handler = NewRealIPMiddleware(opts.trustedProxies...)(handler)
+	}
+
+	return handler
+}
+
+func getStaticAssets(opts *routerConfig) *StaticAssets {
+	var (
+		err    error
+		assets *StaticAssets
+	)
+
+	if opts.debug {
+		assets, err = NewStaticAssets("", opts.staticContentPrefix, os.DirFS(opts.staticContentRootDir), WithStaticAssetsDevMode(true))
+	} else {
+		assets, err = NewStaticAssets(opts.staticContentRootDir, opts.staticContentPrefix, opts.staticFS)
+	}
 
 	if err != nil {
 		slog.Error("error loading static asset filesystem", slog.Any("error", err))
 		os.Exit(-1)
 	}
 
-	return http.FS(fsys)
+	return assets
 }
 
 func normalizeStaticContentPrefix(prefix string) string {
@@ -0,0 +1,196 @@
+package mux2
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRouter_Serve_GracefulShutdown(t *testing.T) {
+	shutdownCtx, stopApp := context.WithCancel(context.Background())
+	defer stopApp()
+
+	requestStarted := make(chan struct{})
+	calls := []string{}
+	lock := &sync.Mutex{}
+
+	recordHook := func(name string) ShutdownHook {
+		return func(ctx context.Context) error {
+			lock.Lock()
+			defer lock.Unlock()
+
+			calls = append(calls, name)
+			return nil
+		}
+	}
+
+	slowHandler := func(w http.ResponseWriter, r *http.Request) {
+		close(requestStarted)
+		time.Sleep(200 * time.Millisecond)
+		_, _ = io.WriteString(w, "done")
+	}
+
+	router := Setup(
+		Config{Host: "127.0.0.1:0"},
+		[]Route{{Path: "GET /slow", HandlerFunc: slowHandler}},
+		shutdownCtx,
+		stopApp,
+
+		WithShutdownTimeout(2*time.Second),
+		WithPreShutdownHooks(recordHook("pre")),
+		WithPostShutdownHooks(recordHook("post")),
+	)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	serveErr := make(chan error, 1)
+
+	go func() {
+		serveErr <- router.Serve(listener)
+	}()
+
+	responseBody := make(chan string, 1)
+
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String() + "/slow")
+
+		if err != nil {
+			responseBody <- err.Error()
+			return
+		}
+
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		responseBody <- string(b)
+	}()
+
+	<-requestStarted
+	stopApp()
+
+	assert.Equal(t, "done", <-responseBody, "in-flight request should be drained")
+	assert.NoError(t, <-serveErr)
+	assert.Equal(t, []string{"pre", "post"}, calls)
+}
+
+func TestRouter_Start_ListenError(t *testing.T) {
+	shutdownCtx, stopApp := context.WithCancel(context.Background())
+	defer stopApp()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	router := Setup(Config{Host: listener.Addr().String()}, []Route{}, shutdownCtx, stopApp)
+
+	err = router.Start()
+	assert.Error(t, err)
+	assert.ErrorIs(t, shutdownCtx.Err(), context.Canceled, "a listen failure should stop the app")
+}
+
+func TestRouter_Serve_UnexpectedErrorShutsDown(t *testing.T) {
+	shutdownCtx, stopApp := context.WithCancel(context.Background())
+	defer stopApp()
+
+	acceptErr := errors.New("accept failed")
+	calls := []string{}
+
+	router := Setup(
+		Config{Host: "127.0.0.1:0"},
+		[]Route{},
+		shutdownCtx,
+		stopApp,
+
+		WithHealthChecks(),
+		WithPreShutdownHooks(func(ctx context.Context) error { calls = append(calls, "pre"); return nil }),
+		WithPostShutdownHooks(func(ctx context.Context) error { calls = append(calls, "post"); return nil }),
+	)
+
+	err := router.Serve(&failingListener{err: acceptErr})
+	assert.ErrorIs(t, err, acceptErr)
+	assert.ErrorIs(t, shutdownCtx.Err(), context.Canceled)
+	assert.Equal(t, []string{"pre", "post"}, calls, "shutdown hooks should run")
+	assert.True(t, router.opts.health.shuttingDown.Load(), "readiness should report shutting down")
+}
+
+/*
+failingListener is a net.Listener whose Accept always fails.
+*/
+type failingListener struct {
+	err error
+}
+
+func (l *failingListener) Accept() (net.Conn, error) { return nil, l.err }
+func (l *failingListener) Close() error              { return nil }
+func (l *failingListener) Addr() net.Addr            { return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)} }
+
+func TestRouter_Shutdown_ReturnsHookErrors(t *testing.T) {
+	shutdownCtx, stopApp := context.WithCancel(context.Background())
+	defer stopApp()
+
+	hookErr := errors.New("hook failed")
+
+	router := Setup(
+		Config{Host: "127.0.0.1:0"},
+		[]Route{},
+		shutdownCtx,
+		stopApp,
+
+		WithPostShutdownHooks(func(ctx context.Context) error { return hookErr }),
+	)
+
+	err := router.Shutdown()
+	assert.ErrorIs(t, err, hookErr)
+	assert.ErrorIs(t, router.Shutdown(), hookErr, "subsequent calls return the first result")
+}
+
+func TestRouter_H2C(t *testing.T) {
+	shutdownCtx, stopApp := context.WithCancel(context.Background())
+	defer stopApp()
+
+	proto := func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.Proto)
+	}
+
+	router := Setup(
+		Config{Host: "127.0.0.1:0"},
+		[]Route{{Path: "GET /proto", HandlerFunc: proto}},
+		shutdownCtx,
+		stopApp,
+
+		WithH2C(),
+	)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	serveErr := make(chan error, 1)
+
+	go func() {
+		serveErr <- router.Serve(listener)
+	}()
+
+	protocols := &http.Protocols{}
+	protocols.SetUnencryptedHTTP2(true)
+
+	client := &http.Client{Transport: &http.Transport{Protocols: protocols}}
+
+	resp, err := client.Get("http://" + listener.Addr().String() + "/proto")
+	require.NoError(t, err)
+
+	b, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	assert.Equal(t, "HTTP/2.0", string(b))
+
+	stopApp()
+	assert.NoError(t, <-serveErr)
+}
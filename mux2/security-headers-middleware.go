@@ -0,0 +1,441 @@
+package mux2
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+/*
+Source values for Content-Security-Policy directives. CSPNoncePlaceholder is
+replaced with the nonce generated for each request.
+*/
+const (
+	CSPNone             = "'none'"
+	CSPNoncePlaceholder = "'nonce'"
+	CSPSelf             = "'self'"
+	CSPStrictDynamic    = "'strict-dynamic'"
+	CSPUnsafeInline     = "'unsafe-inline'"
+)
+
+type SecurityHeadersConfig struct {
+	CSP                   *ContentSecurityPolicy
+	CSPReportOnly         bool
+	CSPReportPath         string
+	CSPReportHandler      func(r *http.Request, report CSPReport)
+	FrameOptions          string
+	HSTSIncludeSubdomains bool
+	HSTSMaxAge            time.Duration
+	HSTSPreload           bool
+	PermissionsPolicy     string
+	ReferrerPolicy        string
+}
+
+type SecurityHeadersOption func(c *SecurityHeadersConfig)
+
+type cspNonceContextKey struct{}
+
+/*
+NewSecurityHeadersMiddleware sets security related response headers on
+every response. The defaults are:
+
+  - Strict-Transport-Security: max-age=31536000; includeSubDomains
+  - X-Content-Type-Options: nosniff
+  - Referrer-Policy: strict-origin-when-cross-origin
+  - Permissions-Policy: camera=(), geolocation=(), microphone=()
+  - X-Frame-Options: DENY
+
+A Content-Security-Policy is only sent when one is configured with
+WithContentSecurityPolicy.
+*/
+func NewSecurityHeadersMiddleware(options ...SecurityHeadersOption) MiddlewareFunc {
+	config := newSecurityHeadersConfig(options...)
+
+	hsts := ""
+
+	if config.HSTSMaxAge > 0 {
+		hsts = fmt.Sprintf("max-age=%d", int(config.HSTSMaxAge.Seconds()))
+
+		if config.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+
+		if config.HSTSPreload {
+			hsts += "; preload"
+		}
+	}
+
+	cspHeader := "Content-Security-Policy"
+
+	if config.CSPReportOnly {
+		cspHeader = "Content-Security-Policy-Report-Only"
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+
+			if hsts != "" {
+				h.Set("Strict-Transport-Security", hsts)
+			}
+
+			h.Set("X-Content-Type-Options", "nosniff")
+
+			if config.ReferrerPolicy != "" {
+				h.Set("Referrer-Policy", config.ReferrerPolicy)
+			}
+
+			if config.PermissionsPolicy != "" {
+				h.Set("Permissions-Policy", config.PermissionsPolicy)
+			}
+
+			if config.FrameOptions != "" {
+				h.Set("X-Frame-Options", config.FrameOptions)
+			}
+
+			if config.CSP != nil {
+				nonce := newCSPNonce()
+				h.Set(cspHeader, config.CSP.String(nonce))
+				markPersonalized(r.Context())
+				r = r.WithContext(context.WithValue(r.Context(), cspNonceContextKey{}, nonce))
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func newSecurityHeadersConfig(options ...SecurityHeadersOption) *SecurityHeadersConfig {
+	config := &SecurityHeadersConfig{
+		FrameOptions:          "DENY",
+		HSTSIncludeSubdomains: true,
+		HSTSMaxAge:            365 * 24 * time.Hour,
+		PermissionsPolicy:     "camera=(), geolocation=(), microphone=()",
+		ReferrerPolicy:        "strict-origin-when-cross-origin",
+	}
+
+	for _, opt := range options {
+		opt(config)
+	}
+
+	if config.CSP != nil && config.CSPReportPath != "" {
+		config.CSP = config.CSP.Clone().Add("report-uri", config.CSPReportPath)
+	}
+
+	return config
+}
+
+/*
+WithContentSecurityPolicy sends a Content-Security-Policy header built
+from csp. A new nonce is generated for every request and is available from
+CSPNonceFromContext.
+*/
+func WithContentSecurityPolicy(csp *ContentSecurityPolicy) SecurityHeadersOption {
+	return func(c *SecurityHeadersConfig) {
+		c.CSP = csp
+	}
+}
+
+/*
+WithCSPReportOnly sends the policy as Content-Security-Policy-Report-Only,
+so violations are reported without being blocked. Violation reports are
+sent to reportPath, which the router serves. Each report is passed to
+handler. If handler is nil, reports are logged as warnings.
+*/
+func WithCSPReportOnly(reportPath string, handler func(r *http.Request, report CSPReport)) SecurityHeadersOption {
+	return func(c *SecurityHeadersConfig) {
+		c.CSPReportOnly = true
+		c.CSPReportPath = reportPath
+		c.CSPReportHandler = handler
+	}
+}
+
+/*
+WithFrameOptions sets X-Frame-Options. Use an empty string to omit it,
+for example when using the CSP frame-ancestors directive instead.
+*/
+func WithFrameOptions(options string) SecurityHeadersOption {
+	return func(c *SecurityHeadersConfig) {
+		c.FrameOptions = options
+	}
+}
+
+/*
+WithHSTS configures Strict-Transport-Security. A maxAge of zero omits
+the header.
+*/
+func WithHSTS(maxAge time.Duration, includeSubdomains, preload bool) SecurityHeadersOption {
+	return func(c *SecurityHeadersConfig) {
+		c.HSTSMaxAge = maxAge
+		c.HSTSIncludeSubdomains = includeSubdomains
+		c.HSTSPreload = preload
+	}
+}
+
+/*
+WithPermissionsPolicy sets Permissions-Policy. Use an empty string to omit it.
+*/
+func WithPermissionsPolicy(policy string) SecurityHeadersOption {
+	return func(c *SecurityHeadersConfig) {
+		c.PermissionsPolicy = policy
+	}
+}
+
+/*
+WithReferrerPolicy sets Referrer-Policy. Use an empty string to omit it.
+*/
+func WithReferrerPolicy(policy string) SecurityHeadersOption {
+	return func(c *SecurityHeadersConfig) {
+		c.ReferrerPolicy = policy
+	}
+}
+
+/*
+CSPNonceFromContext returns the Content-Security-Policy nonce for the
+current request, or an empty string if there isn't one.
+*/
+func CSPNonceFromContext(ctx context.Context) string {
+	nonce, _ := ctx.Value(cspNonceContextKey{}).(string)
+	return nonce
+}
+
+/*
+CSPNonce returns the Content-Security-Policy nonce for the request.
+*/
+func CSPNonce(r *http.Request) string {
+	return CSPNonceFromContext(r.Context())
+}
+
+func newCSPNonce() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+/*
+ContentSecurityPolicy builds a Content-Security-Policy header value.
+Directives are written in the order they were added.
+
+	csp := mux2.NewContentSecurityPolicy().
+	  Add("default-src", mux2.CSPSelf).
+	  Add("script-src", mux2.CSPSelf, mux2.CSPNoncePlaceholder).
+	  Add("img-src", mux2.CSPSelf, "data:")
+*/
+type ContentSecurityPolicy struct {
+	directives []cspDirective
+}
+
+type cspDirective struct {
+	name    string
+	sources []string
+}
+
+func NewContentSecurityPolicy() *ContentSecurityPolicy {
+	return &ContentSecurityPolicy{}
+}
+
+/*
+DefaultContentSecurityPolicy returns a strict policy that only allows
+same-origin content, and scripts and styles with the request nonce.
+*/
+func DefaultContentSecurityPolicy() *ContentSecurityPolicy {
+	return NewContentSecurityPolicy().
+		Add("default-src", CSPSelf).
+		Add("script-src", CSPSelf, CSPNoncePlaceholder).
+		Add("style-src", CSPSelf, CSPNoncePlaceholder).
+		Add("img-src", CSPSelf, "data:").
+		Add("object-src", CSPNone).
+		Add("base-uri", CSPSelf).
+		Add("form-action", CSPSelf).
+		Add("frame-ancestors", CSPNone)
+}
+
+/*
+Add appends sources to a directive, creating it if needed.
+*/
+func (csp *ContentSecurityPolicy) Add(directive string, sources ...string) *ContentSecurityPolicy {
+	for i := range csp.directives {
+		if csp.directives[i].name == directive {
+			csp.directives[i].sources = append(csp.directives[i].sources, sources...)
+			return csp
+		}
+	}
+
+	csp.directives = append(csp.directives, cspDirective{name: directive, sources: slices.Clone(sources)})
+	return csp
+}
+
+func (csp *ContentSecurityPolicy) Clone() *ContentSecurityPolicy {
+	result := &ContentSecurityPolicy{}
+
+	for _, d := range csp.directives {
+		result.directives = append(result.directives, cspDirective{name: d.name, sources: slices.Clone(d.sources)})
+	}
+
+	return result
+}
+
+/*
+String returns the header value, replacing CSPNoncePlaceholder with nonce.
+*/
+func (csp *ContentSecurityPolicy) String(nonce string) string {
+	var (
+		b strings.Builder
+	)
+
+	for i, d := range csp.directives {
+		if i > 0 {
+			b.WriteString("; ")
+		}
+
+		b.WriteString(d.name)
+
+		for _, source := range d.sources {
+			b.WriteByte(' ')
+
+			if source == CSPNoncePlaceholder {
+				b.WriteString("'nonce-" + nonce + "'")
+				continue
+			}
+
+			b.WriteString(source)
+		}
+	}
+
+	return b.String()
+}
+
+/*
+CSPReport is a Content-Security-Policy violation report. Browsers send
+these either in the older report-uri format, or with the Reporting API.
+Both are converted to this structure.
+*/
+type CSPReport struct {
+	BlockedURL         string `json:"blockedURL"`
+	Disposition        string `json:"disposition"`
+	DocumentURL        string `json:"documentURL"`
+	EffectiveDirective string `json:"effectiveDirective"`
+	LineNumber         int    `json:"lineNumber"`
+	OriginalPolicy     string `json:"originalPolicy"`
+	Referrer           string `json:"referrer"`
+	SourceFile         string `json:"sourceFile"`
+}
+
+type legacyCSPReport struct {
+	Report struct {
+		BlockedURI         string `json:"blocked-uri"`
+		Disposition        string `json:"disposition"`
+		DocumentURI        string `json:"document-uri"`
+		EffectiveDirective string `json:"effective-directive"`
+		LineNumber         int    `json:"line-number"`
+		OriginalPolicy     string `json:"original-policy"`
+		Referrer           string `json:"referrer"`
+		SourceFile         string `json:"source-file"`
+		ViolatedDirective  string `json:"violated-directive"`
+	} `json:"csp-report"`
+}
+
+type reportingAPIReport struct {
+	Type string    `json:"type"`
+	Body CSPReport `json:"body"`
+}
+
+/*
+NewCSPReportHandler accepts Content-Security-Policy violation reports
+and passes each one to handler. If handler is nil, reports are logged
+as warnings. The router registers this at the report path given to
+WithCSPReportOnly.
+*/
+func NewCSPReportHandler(handler func(r *http.Request, report CSPReport)) http.HandlerFunc {
+	if handler == nil {
+		handler = logCSPReport
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 64*1024))
+
+		if err != nil {
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		reports, err := parseCSPReports(r.Header.Get("Content-Type"), body)
+
+		if err != nil {
+			slog.Debug("invalid CSP report", slog.Any("error", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		for _, report := range reports {
+			handler(r, report)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func parseCSPReports(contentType string, body []byte) ([]CSPReport, error) {
+	if strings.HasPrefix(contentType, "application/reports+json") {
+		var (
+			reports []reportingAPIReport
+			result  []CSPReport
+		)
+
+		if err := json.Unmarshal(body, &reports); err != nil {
+			return nil, err
+		}
+
+		for _, report := range reports {
+			if report.Type == "csp-violation" {
+				result = append(result, report.Body)
+			}
+		}
+
+		return result, nil
+	}
+
+	legacy := legacyCSPReport{}
+
+	if err := json.Unmarshal(body, &legacy); err != nil {
+		return nil, err
+	}
+
+	directive := legacy.Report.EffectiveDirective
+
+	if directive == "" {
+		directive = legacy.Report.ViolatedDirective
+	}
+
+	return []CSPReport{
+		{
+			BlockedURL:         legacy.Report.BlockedURI,
+			Disposition:        legacy.Report.Disposition,
+			DocumentURL:        legacy.Report.DocumentURI,
+			EffectiveDirective: directive,
+			LineNumber:         legacy.Report.LineNumber,
+			OriginalPolicy:     legacy.Report.OriginalPolicy,
+			Referrer:           legacy.Report.Referrer,
+			SourceFile:         legacy.Report.SourceFile,
+		},
+	}, nil
+}
+
+func logCSPReport(r *http.Request, report CSPReport) {
+	slog.Warn(
+		"content security policy violation",
+		slog.String("blockedURL", report.BlockedURL),
+		slog.String("directive", report.EffectiveDirective),
+		slog.String("documentURL", report.DocumentURL),
+		slog.String("sourceFile", report.SourceFile),
+		slog.Int("lineNumber", report.LineNumber),
+	)
+}
@@ -0,0 +1,118 @@
+package mux2
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecurityHeadersMiddleware_Defaults(t *testing.T) {
+	handler := NewSecurityHeadersMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, CSPNonce(r))
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Equal(t, "max-age=31536000; includeSubDomains", w.Header().Get("Strict-Transport-Security"))
+	assert.Equal(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, "strict-origin-when-cross-origin", w.Header().Get("Referrer-Policy"))
+	assert.Equal(t, "camera=(), geolocation=(), microphone=()", w.Header().Get("Permissions-Policy"))
+	assert.Equal(t, "DENY", w.Header().Get("X-Frame-Options"))
+	assert.Empty(t, w.Header().Get("Content-Security-Policy"))
+}
+
+func TestSecurityHeadersMiddleware_ContentSecurityPolicyNonce(t *testing.T) {
+	csp := NewContentSecurityPolicy().
+		Add("default-src", CSPSelf).
+		Add("script-src", CSPSelf, CSPNoncePlaceholder)
+
+	nonces := []string{}
+
+	handler := NewSecurityHeadersMiddleware(
+		WithContentSecurityPolicy(csp),
+		WithFrameOptions(""),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonces = append(nonces, CSPNonce(r))
+	}))
+
+	for range 2 {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		nonce := nonces[len(nonces)-1]
+		require.NotEmpty(t, nonce)
+		assert.Equal(t, "default-src 'self'; script-src 'self' 'nonce-"+nonce+"'", w.Header().Get("Content-Security-Policy"))
+		assert.Empty(t, w.Header().Get("X-Frame-Options"))
+	}
+
+	assert.NotEqual(t, nonces[0], nonces[1], "every request should get a new nonce")
+}
+
+func TestSecurityHeadersMiddleware_ReportOnly(t *testing.T) {
+	handler := NewSecurityHeadersMiddleware(
+		WithContentSecurityPolicy(DefaultContentSecurityPolicy()),
+		WithCSPReportOnly("/csp-reports", nil),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	assert.Empty(t, w.Header().Get("Content-Security-Policy"))
+	assert.True(t, strings.HasSuffix(w.Header().Get("Content-Security-Policy-Report-Only"), "; report-uri /csp-reports"))
+}
+
+func TestCSPReportHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantReports []CSPReport
+	}{
+		{
+			name:        "report-uri format",
+			contentType: "application/csp-report",
+			body:        `{"csp-report": {"document-uri": "https://example.com/", "blocked-uri": "https://evil.com/x.js", "violated-directive": "script-src"}}`,
+			wantStatus:  http.StatusNoContent,
+			wantReports: []CSPReport{{BlockedURL: "https://evil.com/x.js", DocumentURL: "https://example.com/", EffectiveDirective: "script-src"}},
+		},
+		{
+			name:        "reporting API format",
+			contentType: "application/reports+json",
+			body:        `[{"type": "csp-violation", "body": {"documentURL": "https://example.com/", "blockedURL": "inline", "effectiveDirective": "style-src"}}, {"type": "deprecation", "body": {}}]`,
+			wantStatus:  http.StatusNoContent,
+			wantReports: []CSPReport{{BlockedURL: "inline", DocumentURL: "https://example.com/", EffectiveDirective: "style-src"}},
+		},
+		{
+			name:        "invalid JSON",
+			contentType: "application/csp-report",
+			body:        `nope`,
+			wantStatus:  http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var reports []CSPReport
+
+			handler := NewCSPReportHandler(func(r *http.Request, report CSPReport) {
+				reports = append(reports, report)
+			})
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/csp-reports", io.NopCloser(strings.NewReader(tt.body)))
+			r.Header.Set("Content-Type", tt.contentType)
+
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantReports, reports)
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package mux2
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/adampresley/adamgokit/metrics"
+)
+
+/*
+A Listener describes one of the HTTP servers run by a Server. Each
+listener has its own routes and router options, such as middlewares, TLS,
+and metrics. Address is a "host:port", or a Unix domain socket path
+prefixed with "unix:".
+
+	mux2.Listener{
+	  Name:    "admin",
+	  Address: "127.0.0.1:9090",
+	  Routes:  adminRoutes,
+	  Options: []mux2.RouterOption{mux2.WithMetrics("/metrics"), mux2.WithHealthChecks()},
+	}
+*/
+type Listener struct {
+	Name    string
+	Address string
+	Routes  []Route
+	Options []RouterOption
+}
+
+/*
+A Server runs several listeners together, such as a public site and an
+internal admin port. They start together, and stop together when the
+shutdown context is cancelled, a signal is received, or any listener
+fails.
+*/
+type Server struct {
+	Routers map[string]*Router
+
+	names        []string
+	shutdownCtx  context.Context
+	shutdownErr  error
+	shutdownOnce sync.Once
+	stopApp      context.CancelFunc
+}
+
+/*
+NewServer sets up a Router for each listener. Listener names must be
+unique. Each router runs its own shutdown hooks when the server stops.
+*/
+func NewServer(shutdownCtx context.Context, stopApp context.CancelFunc, listeners ...Listener) *Server {
+	result := &Server{
+		Routers: make(map[string]*Router, len(listeners)),
+
+		shutdownCtx: shutdownCtx,
+		stopApp:     stopApp,
+	}
+
+	if len(listeners) == 0 {
+		panic("a server needs at least one listener")
+	}
+
+	/*
+	 * Listeners that share a metrics registry share route metrics too.
+	 */
+	sharedRouteMetrics := map[*metrics.Registry]*routeMetrics{}
+
+	shareRouteMetrics := func(config *routerConfig) {
+		config.sharedRouteMetrics = sharedRouteMetrics
+	}
+
+	for _, listener := range listeners {
+		if listener.Name == "" {
+			panic("every listener must have a name")
+		}
+
+		if _, ok := result.Routers[listener.Name]; ok {
+			panic(fmt.Sprintf("duplicate listener name '%s'", listener.Name))
+		}
+
+		router := Setup(Config{Host: listener.Address}, listener.Routes, shutdownCtx, stopApp, append(slices.Clone(listener.Options), shareRouteMetrics)...)
+		router.name = listener.Name
+
+		result.Routers[listener.Name] = router
+		result.names = append(result.names, listener.Name)
+	}
+
+	return result
+}
+
+/*
+Router returns the router for a listener, or nil if there isn't one with
+that name.
+*/
+func (s *Server) Router(name string) *Router {
+	return s.Routers[name]
+}
+
+/*
+Start opens every listener, then serves them until the shutdown context is
+cancelled, an interrupt or terminate signal is received, or a listener
+fails. Every listener is then gracefully shut down. If any listener can't
+be opened, none are started.
+*/
+func (s *Server) Start() error {
+	var (
+		err       error
+		listeners = make([]net.Listener, 0, len(s.names))
+	)
+
+	routers := make([]*Router, 0, len(s.names))
+
+	for _, name := range s.names {
+		var listener net.Listener
+
+		if listener, err = s.Routers[name].listen(); err != nil {
+			closeListeners(listeners)
+			s.cancelApp()
+			return err
+		}
+
+		listeners = append(listeners, listener)
+		routers = append(routers, s.Routers[name])
+	}
+
+	return serveRouters(s.shutdownCtx, s.cancelApp, s.Shutdown, routers, listeners)
+}
+
+/*
+Shutdown gracefully stops every listener at the same time. See
+Router.Shutdown. Errors from every listener are joined. It is safe to
+call Shutdown more than once.
+*/
+func (s *Server) Shutdown() error {
+	s.shutdownOnce.Do(func() {
+		var (
+			errs = make([]error, len(s.names))
+			wg   sync.WaitGroup
+		)
+
+		for index, name := range s.names {
+			router := s.Routers[name]
+
+			wg.Go(func() {
+				errs[index] = router.Shutdown()
+			})
+		}
+
+		wg.Wait()
+		s.shutdownErr = errors.Join(errs...)
+	})
+
+	return s.shutdownErr
+}
+
+func (s *Server) cancelApp() {
+	if s.stopApp != nil {
+		s.stopApp()
+	}
+}
+
+/*
+listen opens a TCP listener, or a Unix domain socket listener if address
+starts with "unix:". A socket file left behind by a previous run is
+removed first. The socket file is removed when the listener is closed.
+*/
+func listen(address string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(address, "unix:")
+
+	if !ok {
+		return net.Listen("tcp", address)
+	}
+
+	if info, err := os.Stat(path); err == nil && info.Mode().Type() == fs.ModeSocket {
+		if err = os.Remove(path); err != nil {
+			return nil, fmt.Errorf("error removing old socket file '%s': %w", path, err)
+		}
+	}
+
+	return net.Listen("unix", path)
+}
+
+func closeListeners(listeners []net.Listener) {
+	for _, listener := range listeners {
+		_ = listener.Close()
+	}
+}
@@ -0,0 +1,146 @@
+package mux2
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func unixClient(socketPath string) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socketPath)
+			},
+		},
+	}
+}
+
+func TestServer_Start(t *testing.T) {
+	shutdownCtx, stopApp := context.WithCancel(context.Background())
+	defer stopApp()
+
+	dir := t.TempDir()
+	publicSocket := filepath.Join(dir, "public.sock")
+	adminSocket := filepath.Join(dir, "admin.sock")
+
+	lock := &sync.Mutex{}
+	stopped := []string{}
+
+	recordHook := func(name string) ShutdownHook {
+		return func(ctx context.Context) error {
+			lock.Lock()
+			defer lock.Unlock()
+
+			stopped = append(stopped, name)
+			return nil
+		}
+	}
+
+	text := func(body string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, body)
+		}
+	}
+
+	server := NewServer(
+		shutdownCtx,
+		stopApp,
+
+		Listener{
+			Name:    "public",
+			Address: "unix:" + publicSocket,
+			Routes:  []Route{{Path: "GET /{$}", HandlerFunc: text("public")}},
+			Options: []RouterOption{WithPostShutdownHooks(recordHook("public"))},
+		},
+		Listener{
+			Name:    "admin",
+			Address: "unix:" + adminSocket,
+			Routes:  []Route{{Path: "GET /{$}", HandlerFunc: text("admin")}},
+			Options: []RouterOption{WithHealthChecks(), WithPostShutdownHooks(recordHook("admin"))},
+		},
+	)
+
+	require.NotNil(t, server.Router("admin"))
+	assert.Nil(t, server.Router("missing"))
+
+	startErr := make(chan error, 1)
+
+	go func() {
+		startErr <- server.Start()
+	}()
+
+	get := func(socketPath, path string) (int, string) {
+		var (
+			err  error
+			resp *http.Response
+		)
+
+		require.Eventually(t, func() bool {
+			resp, err = unixClient(socketPath).Get("http://unix" + path)
+			return err == nil
+		}, 2*time.Second, 10*time.Millisecond)
+
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(b)
+	}
+
+	_, body := get(publicSocket, "/")
+	assert.Equal(t, "public", body)
+
+	_, body = get(adminSocket, "/")
+	assert.Equal(t, "admin", body)
+
+	status, _ := get(publicSocket, "/healthz")
+	assert.Equal(t, http.StatusNotFound, status, "each listener has its own routes")
+
+	status, _ = get(adminSocket, "/healthz")
+	assert.Equal(t, http.StatusOK, status)
+
+	stopApp()
+
+	assert.NoError(t, <-startErr)
+	assert.ElementsMatch(t, []string{"public", "admin"}, stopped)
+	assert.NoFileExists(t, publicSocket, "socket files are removed on shutdown")
+}
+
+func TestServer_Start_ListenError(t *testing.T) {
+	shutdownCtx, stopApp := context.WithCancel(context.Background())
+	defer stopApp()
+
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer taken.Close()
+
+	socketPath := filepath.Join(t.TempDir(), "public.sock")
+
+	server := NewServer(
+		shutdownCtx,
+		stopApp,
+
+		Listener{Name: "public", Address: "unix:" + socketPath},
+		Listener{Name: "admin", Address: taken.Addr().String()},
+	)
+
+	err = server.Start()
+	assert.Error(t, err)
+	assert.ErrorIs(t, shutdownCtx.Err(), context.Canceled, "a listen failure should stop the app")
+
+	_, err = net.Dial("unix", socketPath)
+	assert.Error(t, err, "listeners already opened are closed")
+}
+
+func TestNewServer_DuplicateNames(t *testing.T) {
+	assert.Panics(t, func() {
+		NewServer(context.Background(), nil, Listener{Name: "public"}, Listener{Name: "public"})
+	})
+}
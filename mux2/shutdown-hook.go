@@ -0,0 +1,49 @@
+package mux2
+
+import (
+	"context"
+	"log/slog"
+)
+
+/*
+A ShutdownHook is a function run during graceful shutdown. The context
+carries the shutdown deadline. For example, to stop cron jobs before the
+server drains its connections:
+
+	mux2.WithPreShutdownHooks(func(ctx context.Context) error {
+	   select {
+	   case <-cron.Stop().Done():
+	   case <-ctx.Done():
+	      return ctx.Err()
+	   }
+
+	   return nil
+	})
+*/
+type ShutdownHook func(ctx context.Context) error
+
+/*
+ShutdownHookFunc adapts a plain function, such as the cleanup function
+returned by sessions.NewPGStore, into a ShutdownHook.
+*/
+func ShutdownHookFunc(fn func()) ShutdownHook {
+	return func(ctx context.Context) error {
+		fn()
+		return nil
+	}
+}
+
+func runShutdownHooks(ctx context.Context, hooks []ShutdownHook) []error {
+	var (
+		errs []error
+	)
+
+	for _, hook := range hooks {
+		if err := hook(ctx); err != nil {
+			slog.Error("error running shutdown hook", slog.Any("error", err))
+			errs = append(errs, err)
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,320 @@
+package mux2
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+const fingerprintLength = 8
+
+/*
+precompressedEncodings are the sibling file extensions picked up for
+each asset, in order of preference.
+*/
+var precompressedEncodings = []struct {
+	encoding  string
+	extension string
+}{
+	{encoding: "br", extension: ".br"},
+	{encoding: "gzip", extension: ".gz"},
+}
+
+/*
+StaticAssets serves static files with content-hash fingerprints and
+precompressed variants. At startup every file is hashed, so
+"css/styles.css" is also available as "css/styles.3f2a1c9b.css".
+Fingerprinted paths are served with a long-lived, immutable Cache-Control
+header, as their content can never change. Every file gets a strong ETag,
+and conditional requests are answered with 304 Not Modified.
+
+If a file has ".br" or ".gz" siblings (for example "css/styles.css.br"),
+they are served to clients that accept that encoding.
+
+Use Path (or the "assetPath" template function from FuncMap) to get the
+fingerprinted URL of a file.
+*/
+type StaticAssets struct {
+	assets        map[string]*staticAsset
+	devMode       bool
+	fingerprinted map[string]*staticAsset
+	fsys          fs.FS
+	prefix        string
+}
+
+type staticAsset struct {
+	contentType       string
+	encodings         map[string]string
+	fingerprintedName string
+	hash              string
+	modTime           time.Time
+	name              string
+}
+
+type StaticAssetsOption func(*StaticAssets)
+
+/*
+WithStaticAssetsDevMode disables fingerprinting and caching, and reads
+files from disk on every request so edits show up without a restart.
+*/
+func WithStaticAssetsDevMode(enabled bool) StaticAssetsOption {
+	return func(s *StaticAssets) {
+		s.devMode = enabled
+	}
+}
+
+/*
+NewStaticAssets indexes the files in fsys under rootDir that are served
+from prefix. As with WithStaticContent, the prefix is also the directory
+the files live in. For example, with a rootDir of "app" and a prefix of
+"/static/", the file "app/static/css/styles.css" is served at
+"/static/css/styles.css", and its asset name is "css/styles.css".
+*/
+func NewStaticAssets(rootDir, prefix string, fsys fs.FS, options ...StaticAssetsOption) (*StaticAssets, error) {
+	var (
+		err error
+	)
+
+	result := &StaticAssets{
+		assets:        map[string]*staticAsset{},
+		fingerprinted: map[string]*staticAsset{},
+		prefix:        normalizeStaticContentPrefix(prefix),
+	}
+
+	for _, opt := range options {
+		opt(result)
+	}
+
+	if rootDir != "" && rootDir != "." {
+		if fsys, err = fs.Sub(fsys, rootDir); err != nil {
+			return nil, fmt.Errorf("error loading static asset root directory '%s': %w", rootDir, err)
+		}
+	}
+
+	assetDir := strings.Trim(result.prefix, "/")
+
+	if result.fsys, err = fs.Sub(fsys, assetDir); err != nil {
+		return nil, fmt.Errorf("error loading static asset directory '%s': %w", assetDir, err)
+	}
+
+	if result.devMode {
+		return result, nil
+	}
+
+	if err = result.index(); err != nil {
+		return nil, fmt.Errorf("error indexing static assets: %w", err)
+	}
+
+	return result, nil
+}
+
+func (s *StaticAssets) index() error {
+	err := fs.WalkDir(s.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			return nil
+		}
+
+		content, err := fs.ReadFile(s.fsys, name)
+
+		if err != nil {
+			return fmt.Errorf("error reading static asset '%s': %w", name, err)
+		}
+
+		info, err := d.Info()
+
+		if err != nil {
+			return fmt.Errorf("error reading static asset info for '%s': %w", name, err)
+		}
+
+		sum := sha256.Sum256(content)
+		hash := hex.EncodeToString(sum[:])
+
+		asset := &staticAsset{
+			contentType:       mime.TypeByExtension(path.Ext(name)),
+			encodings:         map[string]string{},
+			fingerprintedName: fingerprintName(name, hash[:fingerprintLength]),
+			hash:              hash,
+			modTime:           info.ModTime(),
+			name:              name,
+		}
+
+		if asset.contentType == "" {
+			asset.contentType = http.DetectContentType(content)
+		}
+
+		s.assets[name] = asset
+		s.fingerprinted[asset.fingerprintedName] = asset
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	for name, asset := range s.assets {
+		for _, precompressed := range precompressedEncodings {
+			if _, ok := s.assets[name+precompressed.extension]; ok {
+				asset.encodings[precompressed.encoding] = name + precompressed.extension
+			}
+		}
+	}
+
+	return nil
+}
+
+/*
+Path returns the URL of an asset, such as "/static/css/styles.3f2a1c9b.css"
+for "css/styles.css". Unknown assets, and all assets in dev mode, return
+their URL without a fingerprint.
+*/
+func (s *StaticAssets) Path(name string) string {
+	name = strings.TrimPrefix(name, "/")
+
+	if asset, ok := s.assets[name]; ok && !s.devMode {
+		return s.prefix + asset.fingerprintedName
+	}
+
+	return s.prefix + name
+}
+
+/*
+FuncMap returns template functions for use with rendering.WithFuncs.
+"assetPath" returns the fingerprinted URL of an asset:
+
+	<link rel="stylesheet" href="{{ assetPath "css/styles.css" }}" />
+*/
+func (s *StaticAssets) FuncMap() template.FuncMap {
+	return template.FuncMap{
+		"assetPath": s.Path,
+	}
+}
+
+/*
+Prefix returns the URL path prefix the assets are served from.
+*/
+func (s *StaticAssets) Prefix() string {
+	return s.prefix
+}
+
+func (s *StaticAssets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, s.prefix)
+
+	if name == "" || strings.HasSuffix(name, "/") {
+		name += "index.html"
+	}
+
+	if s.devMode {
+		w.Header().Set("Cache-Control", "no-cache")
+		http.ServeFileFS(w, r, s.fsys, name)
+		return
+	}
+
+	immutable := true
+	asset, ok := s.fingerprinted[name]
+
+	if !ok {
+		immutable = false
+
+		if asset, ok = s.assets[name]; !ok {
+			WriteError(w, r, http.StatusNotFound, nil)
+			return
+		}
+	}
+
+	fileName := asset.name
+	etag := asset.hash[:16]
+
+	if len(asset.encodings) > 0 {
+		w.Header().Add("Vary", "Accept-Encoding")
+		accepted := parseAcceptEncoding(r.Header.Get("Accept-Encoding"))
+
+		for _, precompressed := range precompressedEncodings {
+			encodedName, exists := asset.encodings[precompressed.encoding]
+
+			if exists && accepted[precompressed.encoding] > 0 {
+				fileName = encodedName
+				etag += "-" + precompressed.encoding
+				w.Header().Set("Content-Encoding", precompressed.encoding)
+				break
+			}
+		}
+	}
+
+	f, err := s.fsys.Open(fileName)
+
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	defer f.Close()
+	content, err := asReadSeeker(f)
+
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	if immutable {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+
+	w.Header().Set("Content-Type", asset.contentType)
+	w.Header().Set("ETag", `"`+etag+`"`)
+
+	http.ServeContent(w, r, asset.name, asset.modTime, content)
+}
+
+/*
+asReadSeeker returns the file itself if it supports seeking, as files
+from embed.FS and os.DirFS do. Otherwise the file is read into memory.
+*/
+func asReadSeeker(f fs.File) (io.ReadSeeker, error) {
+	if seeker, ok := f.(io.ReadSeeker); ok {
+		return seeker, nil
+	}
+
+	content, err := io.ReadAll(f)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return bytes.NewReader(content), nil
+}
+
+/*
+fingerprintName inserts a fingerprint before the file extension, so
+"css/styles.css" becomes "css/styles.3f2a1c9b.css".
+*/
+func fingerprintName(name, fingerprint string) string {
+	ext := path.Ext(name)
+
+	/*
+	 * Keep precompressed siblings next to their fingerprinted original,
+	 * such as "css/styles.3f2a1c9b.css.gz".
+	 */
+	for _, precompressed := range precompressedEncodings {
+		if ext == precompressed.extension {
+			base := strings.TrimSuffix(name, ext)
+			return fingerprintName(base, fingerprint) + ext
+		}
+	}
+
+	return strings.TrimSuffix(name, ext) + "." + fingerprint + ext
+}
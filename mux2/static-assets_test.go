@@ -0,0 +1,81 @@
+package mux2
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaticAssets(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app/static/css/styles.css":    {Data: []byte("body { color: red; }")},
+		"app/static/css/styles.css.br": {Data: []byte("brotli bytes")},
+		"app/static/css/styles.css.gz": {Data: []byte("gzip bytes")},
+		"app/static/js/app.js":         {Data: []byte("console.log('hi');")},
+	}
+
+	assets, err := NewStaticAssets("app", "/static/", fsys)
+	require.NoError(t, err)
+
+	stylesPath := assets.Path("css/styles.css")
+	assert.Regexp(t, `^/static/css/styles\.[0-9a-f]{8}\.css$`, stylesPath)
+	assert.Equal(t, "/static/unknown.css", assets.Path("unknown.css"))
+
+	serve := func(path string, headers map[string]string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, path, nil)
+
+		for k, v := range headers {
+			r.Header.Set(k, v)
+		}
+
+		assets.ServeHTTP(w, r)
+		return w
+	}
+
+	t.Run("Fingerprinted paths are immutable", func(t *testing.T) {
+		w := serve(stylesPath, nil)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "body { color: red; }", w.Body.String())
+		assert.Equal(t, "public, max-age=31536000, immutable", w.Header().Get("Cache-Control"))
+		assert.Contains(t, w.Header().Get("Content-Type"), "text/css")
+		assert.NotEmpty(t, w.Header().Get("ETag"))
+	})
+
+	t.Run("Original paths must revalidate", func(t *testing.T) {
+		w := serve("/static/js/app.js", nil)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+	})
+
+	t.Run("Matching ETag returns 304", func(t *testing.T) {
+		etag := serve("/static/js/app.js", nil).Header().Get("ETag")
+		w := serve("/static/js/app.js", map[string]string{"If-None-Match": etag})
+
+		assert.Equal(t, http.StatusNotModified, w.Code)
+	})
+
+	t.Run("Serves precompressed siblings", func(t *testing.T) {
+		w := serve(stylesPath, map[string]string{"Accept-Encoding": "gzip, br"})
+
+		assert.Equal(t, "br", w.Header().Get("Content-Encoding"))
+		assert.Equal(t, "brotli bytes", w.Body.String())
+		assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+		assert.Contains(t, w.Header().Get("Content-Type"), "text/css")
+
+		w = serve(stylesPath, map[string]string{"Accept-Encoding": "gzip"})
+		assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+		assert.Equal(t, "gzip bytes", w.Body.String())
+	})
+
+	t.Run("Unknown files are not found", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, serve("/static/css/", nil).Code)
+		assert.Equal(t, http.StatusNotFound, serve("/static/nope.css", nil).Code)
+	})
+}
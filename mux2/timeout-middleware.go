@@ -0,0 +1,195 @@
+package mux2
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrRequestTimeout = fmt.Errorf("the request took too long to process")
+)
+
+type TimeoutConfig struct {
+	exempt func(r *http.Request) bool
+	status int
+}
+
+type TimeoutOption func(*TimeoutConfig)
+
+/*
+WithTimeoutExempt skips the timeout for requests where exempt returns
+true, in addition to streaming and upgrade requests.
+*/
+func WithTimeoutExempt(exempt func(r *http.Request) bool) TimeoutOption {
+	return func(config *TimeoutConfig) {
+		config.exempt = exempt
+	}
+}
+
+/*
+WithTimeoutStatus sets the status written when a handler runs out of
+time. Defaults to 503 Service Unavailable. Use 504 Gateway Timeout when
+the handler is mostly waiting on upstream services.
+*/
+func WithTimeoutStatus(status int) TimeoutOption {
+	return func(config *TimeoutConfig) {
+		config.status = status
+	}
+}
+
+/*
+NewTimeoutMiddleware gives each request a context deadline of timeout.
+Handlers should pass r.Context() to anything that may block, so they stop
+work when the deadline passes. If the handler hasn't finished by then, the
+client gets a 503 written with WriteError, and anything the handler writes
+afterwards is discarded. Writes after the timeout return
+http.ErrHandlerTimeout.
+
+Responses are buffered until the handler returns, so streaming requests
+are exempt. These are requests that accept text/event-stream, such as SSE,
+and protocol upgrades, such as websockets. Routes with Streaming set are
+never wrapped by the router.
+*/
+func NewTimeoutMiddleware(timeout time.Duration, options ...TimeoutOption) MiddlewareFunc {
+	config := &TimeoutConfig{
+		exempt: func(r *http.Request) bool { return false },
+		status: http.StatusServiceUnavailable,
+	}
+
+	for _, opt := range options {
+		opt(config)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isStreamingRequest(r) || config.exempt(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			r = r.WithContext(ctx)
+			tw := &timeoutWriter{header: make(http.Header)}
+			done := make(chan struct{})
+			panicked := make(chan any, 1)
+
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicked <- p
+					}
+				}()
+
+				next.ServeHTTP(tw, r)
+				close(done)
+			}()
+
+			select {
+			case p := <-panicked:
+				// Re-panic here, so the recovery middleware can handle it
+				panic(p)
+
+			case <-done:
+				tw.lock.Lock()
+				defer tw.lock.Unlock()
+
+				dst := w.Header()
+
+				for key, values := range tw.header {
+					dst[key] = values
+				}
+
+				if !tw.wroteHeader {
+					tw.status = http.StatusOK
+				}
+
+				w.WriteHeader(tw.status)
+				_, _ = w.Write(tw.body.Bytes())
+
+			case <-ctx.Done():
+				tw.lock.Lock()
+				defer tw.lock.Unlock()
+
+				tw.timedOut = true
+
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					RequestLogger(r).Warn("request timed out", slog.Duration("timeout", timeout))
+					WriteError(w, r, config.status, ErrRequestTimeout)
+				}
+			}
+		})
+	}
+}
+
+/*
+isStreamingRequest returns true for requests whose response is streamed
+or that take over the connection, such as SSE and websockets.
+*/
+func isStreamingRequest(r *http.Request) bool {
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		return true
+	}
+
+	return isUpgradeRequest(r)
+}
+
+/*
+timeoutWriter buffers the handler's response. The lock guards against the
+handler writing at the same time as the timeout response is sent.
+*/
+type timeoutWriter struct {
+	body        bytes.Buffer
+	header      http.Header
+	lock        sync.Mutex
+	status      int
+	timedOut    bool
+	wroteHeader bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.header
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.lock.Lock()
+	defer tw.lock.Unlock()
+
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+
+	if !tw.wroteHeader {
+		tw.writeHeaderLocked(http.StatusOK)
+	}
+
+	return tw.body.Write(b)
+}
+
+func (tw *timeoutWriter) WriteHeader(status int) {
+	tw.lock.Lock()
+	defer tw.lock.Unlock()
+
+	if tw.timedOut {
+		return
+	}
+
+	tw.writeHeaderLocked(status)
+}
+
+func (tw *timeoutWriter) writeHeaderLocked(status int) {
+	if tw.wroteHeader || (status >= 100 && status < 200) {
+		return
+	}
+
+	tw.status = status
+	tw.wroteHeader = true
+}
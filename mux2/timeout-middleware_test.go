@@ -0,0 +1,112 @@
+package mux2
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTimeoutMiddleware(t *testing.T) {
+	lateWrite := make(chan error, 1)
+
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		time.Sleep(10 * time.Millisecond)
+
+		_, err := io.WriteString(w, "too late")
+		lateWrite <- err
+	}
+
+	fast := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Thing", "1")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, "done")
+	}
+
+	t.Run("Handlers that finish in time are unchanged", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		NewTimeoutMiddleware(time.Second)(http.HandlerFunc(fast)).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		assert.Equal(t, http.StatusCreated, w.Code)
+		assert.Equal(t, "1", w.Header().Get("X-Thing"))
+		assert.Equal(t, "done", w.Body.String())
+	})
+
+	t.Run("Slow handlers get an error and later writes are discarded", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Accept", "application/json")
+
+		NewTimeoutMiddleware(20*time.Millisecond, WithTimeoutStatus(http.StatusGatewayTimeout))(http.HandlerFunc(slow)).ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+		assert.Equal(t, "application/problem+json", w.Header().Get("Content-Type"))
+		assert.True(t, errors.Is(<-lateWrite, http.ErrHandlerTimeout))
+		assert.NotContains(t, w.Body.String(), "too late")
+	})
+
+	t.Run("Streaming requests are exempt", func(t *testing.T) {
+		streaming := func(w http.ResponseWriter, r *http.Request) {
+			_, hasDeadline := r.Context().Deadline()
+			assert.False(t, hasDeadline)
+			w.(http.Flusher).Flush()
+		}
+
+		for _, headers := range []map[string]string{
+			{"Accept": "text/event-stream"},
+			{"Connection": "Upgrade", "Upgrade": "websocket"},
+		} {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+
+			for key, value := range headers {
+				r.Header.Set(key, value)
+			}
+
+			NewTimeoutMiddleware(time.Millisecond)(http.HandlerFunc(streaming)).ServeHTTP(w, r)
+			assert.True(t, w.Flushed)
+		}
+	})
+
+	t.Run("Panics reach the recovery middleware", func(t *testing.T) {
+		panics := func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		}
+
+		assert.PanicsWithValue(t, "boom", func() {
+			NewTimeoutMiddleware(time.Second)(http.HandlerFunc(panics)).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		})
+	})
+}
+
+func TestRouter_RequestTimeout(t *testing.T) {
+	deadline := func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Deadline(); ok {
+			_, _ = io.WriteString(w, "deadline")
+		}
+	}
+
+	router := Setup(
+		Config{Host: "127.0.0.1:0"},
+		[]Route{
+			{Path: "GET /default", HandlerFunc: deadline},
+			{Path: "GET /none", HandlerFunc: deadline, Timeout: -1},
+			{Path: "GET /events", HandlerFunc: deadline, Streaming: true},
+		},
+		nil,
+		nil,
+
+		WithRequestTimeout(time.Second),
+	)
+
+	for path, expected := range map[string]string{"/default": "deadline", "/none": "", "/events": ""} {
+		w := httptest.NewRecorder()
+		router.Server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		assert.Equal(t, expected, w.Body.String(), path)
+	}
+}
@@ -0,0 +1,205 @@
+package mux2
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+const certificateReloadInterval = 10 * time.Second
+
+/*
+certificateReloader serves a certificate and key loaded from disk. The
+files are checked for changes at most every 10 seconds during handshakes,
+and reloaded when either changes, so renewed certificates are picked up
+without a restart.
+*/
+type certificateReloader struct {
+	certFile string
+	keyFile  string
+
+	certificate *tls.Certificate
+	checkedAt   time.Time
+	lock        *sync.Mutex
+	modTime     time.Time
+}
+
+func newCertificateReloader(certFile, keyFile string) *certificateReloader {
+	return &certificateReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		lock:     &sync.Mutex{},
+	}
+}
+
+func (c *certificateReloader) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.certificate != nil && time.Since(c.checkedAt) < certificateReloadInterval {
+		return c.certificate, nil
+	}
+
+	if err := c.reload(); err != nil {
+		/*
+		 * Keep serving the previous certificate if a reload fails. The
+		 * files may be halfway through being replaced.
+		 */
+		if c.certificate != nil {
+			slog.Error("error reloading TLS certificate. using previous certificate", slog.Any("error", err))
+			return c.certificate, nil
+		}
+
+		return nil, err
+	}
+
+	return c.certificate, nil
+}
+
+/*
+load reads the certificate eagerly, so configuration errors are reported
+when the server starts rather than on the first handshake.
+*/
+func (c *certificateReloader) load() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.reload()
+}
+
+/*
+reload loads the certificate if the files have changed since the last
+load. Callers must hold the lock.
+*/
+func (c *certificateReloader) reload() error {
+	c.checkedAt = time.Now()
+
+	modTime, err := latestModTime(c.certFile, c.keyFile)
+
+	if err != nil {
+		return fmt.Errorf("error reading TLS certificate files: %w", err)
+	}
+
+	if c.certificate != nil && !modTime.After(c.modTime) {
+		return nil
+	}
+
+	certificate, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+
+	if err != nil {
+		return fmt.Errorf("error loading TLS certificate: %w", err)
+	}
+
+	if c.certificate != nil {
+		slog.Info("reloaded TLS certificate", slog.String("certFile", c.certFile))
+	}
+
+	c.certificate = &certificate
+	c.modTime = modTime
+	return nil
+}
+
+func latestModTime(files ...string) (time.Time, error) {
+	var (
+		result time.Time
+	)
+
+	for _, file := range files {
+		info, err := os.Stat(file)
+
+		if err != nil {
+			return result, err
+		}
+
+		if info.ModTime().After(result) {
+			result = info.ModTime()
+		}
+	}
+
+	return result, nil
+}
+
+/*
+LoadCertPool reads PEM encoded CA certificates from one or more files
+into a certificate pool, for use with WithMutualTLS.
+*/
+func LoadCertPool(pemFiles ...string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+
+	for _, pemFile := range pemFiles {
+		b, err := os.ReadFile(pemFile)
+
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA certificate file '%s': %w", pemFile, err)
+		}
+
+		if !pool.AppendCertsFromPEM(b) {
+			return nil, fmt.Errorf("no valid certificates found in '%s'", pemFile)
+		}
+	}
+
+	return pool, nil
+}
+
+/*
+ClientIdentity describes the verified client certificate of a mutual
+TLS connection.
+*/
+type ClientIdentity struct {
+	Certificate    *x509.Certificate
+	CommonName     string
+	DNSNames       []string
+	EmailAddresses []string
+	Organization   []string
+	SerialNumber   *big.Int
+	URIs           []*url.URL
+}
+
+type clientIdentityContextKey struct{}
+
+/*
+ClientIdentityFromContext returns the verified client certificate identity
+for a mutual TLS request. The second return value is false if there is none.
+*/
+func ClientIdentityFromContext(ctx context.Context) (ClientIdentity, bool) {
+	identity, ok := ctx.Value(clientIdentityContextKey{}).(ClientIdentity)
+	return identity, ok
+}
+
+/*
+newClientIdentityMiddleware puts the identity from the verified client
+certificate into the request context.
+*/
+func newClientIdentityMiddleware() MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			certificate := r.TLS.VerifiedChains[0][0]
+
+			identity := ClientIdentity{
+				Certificate:    certificate,
+				CommonName:     certificate.Subject.CommonName,
+				DNSNames:       certificate.DNSNames,
+				EmailAddresses: certificate.EmailAddresses,
+				Organization:   certificate.Subject.Organization,
+				SerialNumber:   certificate.SerialNumber,
+				URIs:           certificate.URIs,
+			}
+
+			ctx := context.WithValue(r.Context(), clientIdentityContextKey{}, identity)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
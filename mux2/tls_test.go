@@ -0,0 +1,254 @@
+package mux2
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCertificate struct {
+	certificate *x509.Certificate
+	key         *ecdsa.PrivateKey
+	certPEM     []byte
+	keyPEM      []byte
+}
+
+func newTestCertificate(t *testing.T, commonName string, parent *testCertificate, isCA bool) *testCertificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName, Organization: []string{"Test"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	parentCert, parentKey := template, key
+
+	if parent != nil {
+		parentCert, parentKey = parent.certificate, parent.key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parentCert, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+
+	certificate, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	return &testCertificate{
+		certificate: certificate,
+		key:         key,
+		certPEM:     pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:      pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func writeTestCertificate(t *testing.T, dir string, cert *testCertificate) (string, string) {
+	t.Helper()
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+
+	require.NoError(t, os.WriteFile(certFile, cert.certPEM, 0o600))
+	require.NoError(t, os.WriteFile(keyFile, cert.keyPEM, 0o600))
+	return certFile, keyFile
+}
+
+func TestCertificateReloader_ReloadsChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	first := newTestCertificate(t, "first", nil, false)
+	certFile, keyFile := writeTestCertificate(t, dir, first)
+
+	reloader := newCertificateReloader(certFile, keyFile)
+	require.NoError(t, reloader.load())
+
+	got, err := reloader.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, first.certificate.Raw, got.Certificate[0])
+
+	second := newTestCertificate(t, "second", nil, false)
+	writeTestCertificate(t, dir, second)
+
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, later, later))
+
+	// Within the reload interval the cached certificate is served
+	got, err = reloader.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, first.certificate.Raw, got.Certificate[0])
+
+	reloader.checkedAt = time.Time{}
+
+	got, err = reloader.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, second.certificate.Raw, got.Certificate[0])
+}
+
+func TestCertificateReloader_KeepsCertificateWhenReloadFails(t *testing.T) {
+	dir := t.TempDir()
+	cert := newTestCertificate(t, "server", nil, false)
+	certFile, keyFile := writeTestCertificate(t, dir, cert)
+
+	reloader := newCertificateReloader(certFile, keyFile)
+	require.NoError(t, reloader.load())
+
+	require.NoError(t, os.WriteFile(certFile, []byte("not a certificate"), 0o600))
+	later := time.Now().Add(time.Minute)
+	require.NoError(t, os.Chtimes(certFile, later, later))
+	reloader.checkedAt = time.Time{}
+
+	got, err := reloader.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, cert.certificate.Raw, got.Certificate[0])
+}
+
+func TestRouter_MutualTLS_ClientIdentity(t *testing.T) {
+	shutdownCtx, stopApp := context.WithCancel(context.Background())
+	defer stopApp()
+
+	dir := t.TempDir()
+	ca := newTestCertificate(t, "Test CA", nil, true)
+	server := newTestCertificate(t, "server", ca, false)
+	client := newTestCertificate(t, "client-1", ca, false)
+	certFile, keyFile := writeTestCertificate(t, dir, server)
+
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, ca.certPEM, 0o600))
+
+	clientCAs, err := LoadCertPool(caFile)
+	require.NoError(t, err)
+
+	whoAmI := func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := ClientIdentityFromContext(r.Context())
+
+		if !ok {
+			http.Error(w, "no identity", http.StatusUnauthorized)
+			return
+		}
+
+		_, _ = io.WriteString(w, identity.CommonName)
+	}
+
+	router := Setup(
+		Config{Host: "127.0.0.1:0"},
+		[]Route{{Path: "GET /whoami", HandlerFunc: whoAmI}},
+		shutdownCtx,
+		stopApp,
+
+		WithTLSCertificate(certFile, keyFile),
+		WithMutualTLS(clientCAs),
+	)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	serveErr := make(chan error, 1)
+
+	go func() {
+		serveErr <- router.Serve(listener)
+	}()
+
+	clientKeyPair, err := tls.X509KeyPair(client.certPEM, client.keyPEM)
+	require.NoError(t, err)
+
+	newClient := func(certificates ...tls.Certificate) *http.Client {
+		return &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{
+					Certificates: certificates,
+					RootCAs:      clientCAs,
+				},
+			},
+		}
+	}
+
+	url := "https://" + listener.Addr().String() + "/whoami"
+
+	resp, err := newClient(clientKeyPair).Get(url)
+	require.NoError(t, err)
+
+	b, _ := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "client-1", string(b))
+
+	_, err = newClient().Get(url)
+	assert.Error(t, err, "clients without a certificate should be rejected")
+
+	stopApp()
+	assert.NoError(t, <-serveErr)
+}
+
+func TestHTTPSRedirectHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		tlsAddress string
+		method     string
+		target     string
+		wantStatus int
+		wantURL    string
+	}{
+		{"default port", ":443", http.MethodGet, "http://example.com/a?b=c", http.StatusMovedPermanently, "https://example.com/a?b=c"},
+		{"custom port", ":8443", http.MethodGet, "http://example.com:80/a", http.StatusMovedPermanently, "https://example.com:8443/a"},
+		{"non GET keeps method", ":443", http.MethodPost, "http://example.com/form", http.StatusPermanentRedirect, "https://example.com/form"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+
+			newHTTPSRedirectHandler(tt.tlsAddress).ServeHTTP(w, r)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			assert.Equal(t, tt.wantURL, w.Header().Get("Location"))
+		})
+	}
+}
+
+func TestLetsEncryptConfig_Domains(t *testing.T) {
+	config := LetsEncryptConfig{Domain: "example.com", Domains: []string{"www.example.com", "example.com"}}
+	assert.Equal(t, []string{"www.example.com", "example.com"}, config.domains())
+}
+
+func TestStartCertManager_ChallengeServerTimeouts(t *testing.T) {
+	_, server := startCertManager(LetsEncryptConfig{CertPath: t.TempDir(), Domain: "example.com"}, ":443")
+
+	assert.Equal(t, ":80", server.Addr)
+	assert.Equal(t, challengeReadHeaderTimeout, server.ReadHeaderTimeout)
+	assert.Equal(t, challengeReadTimeout, server.ReadTimeout)
+	assert.Equal(t, challengeWriteTimeout, server.WriteTimeout)
+	assert.Equal(t, challengeIdleTimeout, server.IdleTimeout)
+}
@@ -204,6 +204,9 @@ func getFuncs(additionalFuncs template.FuncMap) template.FuncMap {
 		"isSet":               templateFuncIsSet,
 		"isLastItem":          isLastItem,
 		"containsString":      containsString,
+		"cspNonce":            cspNonce,
+		"csrfField":           csrfField,
+		"csrfToken":           csrfToken,
 		"stringSliceContains": sliceContains[string],
 		"uintSliceContains":   sliceContains[uint],
 		"stringNotEmpty":      stringNotEmpty,
@@ -287,7 +290,7 @@ func javascriptIncludes(keyName string, data any) template.HTML {
 			return ""
 		}
 
-		result.WriteString(fmt.Sprintf(`<script type="%s" src="%s"></script>`, include.Type, include.Src))
+		result.WriteString(fmt.Sprintf(`<script type="%s" src="%s"%s></script>`, include.Type, include.Src, nonceAttribute(data)))
 	}
 
 	return template.HTML(result.String())
@@ -323,12 +326,79 @@ func stylesheetIncludes(keyName string, data any) template.HTML {
 			return ""
 		}
 
-		result.WriteString(fmt.Sprintf(`<link type="text/css" rel="stylesheet" media="%s" href="%s" />`, include.Media, include.Href))
+		result.WriteString(fmt.Sprintf(`<link type="text/css" rel="stylesheet" media="%s" href="%s"%s />`, include.Media, include.Href, nonceAttribute(data)))
 	}
 
 	return template.HTML(result.String())
 }
 
+/*
+csrfToken returns the CSRFToken string field of data, or an empty
+string if there isn't one.
+*/
+func csrfToken(data any) string {
+	return stringField("CSRFToken", data)
+}
+
+/*
+cspNonce returns the CSPNonce string field of data, for inline scripts
+and styles. It returns an empty string if there isn't one.
+*/
+func cspNonce(data any) string {
+	return stringField("CSPNonce", data)
+}
+
+func nonceAttribute(data any) string {
+	nonce := cspNonce(data)
+
+	if nonce == "" {
+		return ""
+	}
+
+	return fmt.Sprintf(` nonce="%s"`, template.HTMLEscapeString(nonce))
+}
+
+func stringField(name string, data any) string {
+	v := reflect.ValueOf(data)
+
+	if v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+
+	field := v.FieldByName(name)
+
+	if !field.IsValid() || field.Kind() != reflect.String {
+		return ""
+	}
+
+	return field.String()
+}
+
+/*
+csrfField renders a hidden form input with the CSRFToken field of data.
+The input is named by the CSRFFieldName field, or "csrf_token" if that
+is empty.
+*/
+func csrfField(data any) template.HTML {
+	token := csrfToken(data)
+
+	if token == "" {
+		return ""
+	}
+
+	name := stringField("CSRFFieldName", data)
+
+	if name == "" {
+		name = "csrf_token"
+	}
+
+	return template.HTML(fmt.Sprintf(`<input type="hidden" name="%s" value="%s" />`, template.HTMLEscapeString(name), template.HTMLEscapeString(token)))
+}
+
 func join(s any, sep string) string {
 	v := reflect.ValueOf(s)
 
@@ -3,6 +3,9 @@ package rendering
 import "html/template"
 
 type BaseViewModel struct {
+	CSPNonce           string
+	CSRFFieldName      string
+	CSRFToken          string
 	IsError            bool
 	IsHtmx             bool
 	IsWarning          bool
@@ -0,0 +1,134 @@
+package sse
+
+import (
+	"context"
+	"sync"
+)
+
+/*
+Backplane carries published events between app instances, so clients
+receive them no matter which instance they are connected to. When a
+broker has a backplane, Publish, PublishTo, and PublishToClient send to
+the backplane, and the broker delivers what it receives from its
+subscription. A backplane must deliver each message to every subscriber,
+including the one on the instance that published it. The channel returned
+by Subscribe is closed when the subscription ends.
+*/
+type Backplane interface {
+	Publish(ctx context.Context, message BackplaneMessage) error
+	Subscribe(ctx context.Context) <-chan BackplaneMessage
+}
+
+/*
+BackplaneMessage is an event on its way to clients. An empty topic and
+client ID means every client.
+*/
+type BackplaneMessage struct {
+	ClientID string `json:"clientID"`
+	Event    Event  `json:"event"`
+	Topic    string `json:"topic"`
+}
+
+/*
+MemoryBackplane is a Backplane for brokers in the same process. It is
+useful for tests, and for running several brokers that share events.
+*/
+type MemoryBackplane struct {
+	lock        *sync.RWMutex
+	subscribers map[*memorySubscriber]struct{}
+}
+
+type memorySubscriber struct {
+	closed   bool
+	done     <-chan struct{}
+	lock     *sync.RWMutex
+	messages chan BackplaneMessage
+}
+
+func NewMemoryBackplane() *MemoryBackplane {
+	return &MemoryBackplane{
+		lock:        &sync.RWMutex{},
+		subscribers: make(map[*memorySubscriber]struct{}),
+	}
+}
+
+/*
+Publish sends a message to every subscriber. It waits for subscribers
+that are behind, until ctx is done.
+*/
+func (m *MemoryBackplane) Publish(ctx context.Context, message BackplaneMessage) error {
+	m.lock.RLock()
+
+	subscribers := make([]*memorySubscriber, 0, len(m.subscribers))
+
+	for subscriber := range m.subscribers {
+		subscribers = append(subscribers, subscriber)
+	}
+
+	m.lock.RUnlock()
+
+	for _, subscriber := range subscribers {
+		if err := subscriber.send(ctx, message); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/*
+Subscribe returns a channel of published messages. The subscription ends,
+and the channel is closed, when ctx is done.
+*/
+func (m *MemoryBackplane) Subscribe(ctx context.Context) <-chan BackplaneMessage {
+	subscriber := &memorySubscriber{
+		done:     ctx.Done(),
+		lock:     &sync.RWMutex{},
+		messages: make(chan BackplaneMessage, 64),
+	}
+
+	m.lock.Lock()
+	m.subscribers[subscriber] = struct{}{}
+	m.lock.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		m.lock.Lock()
+		delete(m.subscribers, subscriber)
+		m.lock.Unlock()
+
+		/*
+		 * Publishers waiting on this subscriber give up now that done
+		 * is closed, so the lock is released soon.
+		 */
+		subscriber.lock.Lock()
+		subscriber.closed = true
+		close(subscriber.messages)
+		subscriber.lock.Unlock()
+	}()
+
+	return subscriber.messages
+}
+
+/*
+send waits for room in the subscriber's buffer, until the subscription
+ends or ctx is done.
+*/
+func (s *memorySubscriber) send(ctx context.Context, message BackplaneMessage) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.closed {
+		return nil
+	}
+
+	select {
+	case s.messages <- message:
+	case <-s.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	return nil
+}
@@ -0,0 +1,170 @@
+package sse
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestMemoryBackplane(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	backplane := NewMemoryBackplane()
+
+	subscriber1 := backplane.Subscribe(ctx)
+	subscriber2Ctx, cancelSubscriber2 := context.WithCancel(ctx)
+	subscriber2 := backplane.Subscribe(subscriber2Ctx)
+
+	message := BackplaneMessage{Event: Event{Data: "hello"}, Topic: "news"}
+	assert.NoError(t, backplane.Publish(ctx, message))
+
+	assert.Equal(t, message, <-subscriber1)
+	assert.Equal(t, message, <-subscriber2)
+
+	cancelSubscriber2()
+
+	assert.Eventually(t, func() bool {
+		backplane.lock.RLock()
+		defer backplane.lock.RUnlock()
+
+		return len(backplane.subscribers) == 1
+	}, time.Second, 10*time.Millisecond, "cancelled subscribers should be removed")
+
+	select {
+	case _, ok := <-subscriber2:
+		assert.False(t, ok, "the channel of a cancelled subscriber should be closed")
+	case <-time.After(time.Second):
+		t.Fatal("the channel of a cancelled subscriber was not closed")
+	}
+
+	assert.NoError(t, backplane.Publish(ctx, message), "publishing after a subscriber is closed should not panic")
+	assert.Equal(t, message, <-subscriber1)
+}
+
+func TestMemoryBackplane_PublishToFullSubscriber(t *testing.T) {
+	backplane := NewMemoryBackplane()
+	subscriber := backplane.Subscribe(t.Context())
+
+	for range cap(subscriber) {
+		assert.NoError(t, backplane.Publish(t.Context(), BackplaneMessage{}))
+	}
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+	defer cancel()
+
+	assert.ErrorIs(t, backplane.Publish(ctx, BackplaneMessage{}), context.DeadlineExceeded)
+}
+
+func TestSseBroker_Backplane(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	backplane := NewMemoryBackplane()
+
+	broker1 := NewBroker(SseBrokerConfig{CancelContext: ctx, Backplane: backplane})
+	broker2 := NewBroker(SseBrokerConfig{CancelContext: ctx, Backplane: backplane})
+
+	go broker1.Listen()
+	go broker2.Listen()
+
+	client1 := newTestClient("1", "news")
+	client2 := newTestClient("2", "news")
+
+	broker1.newClients <- client1
+	broker2.newClients <- client2
+
+	broker1.PublishTo("news", Event{Data: "from broker 1"})
+	broker2.Publish(Event{Data: "from broker 2"})
+	broker1.PublishToClient("2", Event{Data: "for client 2"})
+
+	assert.Equal(t, "from broker 1", receiveEvent(t, client1).Data)
+	assert.Equal(t, "from broker 2", receiveEvent(t, client1).Data)
+
+	assert.Equal(t, "from broker 1", receiveEvent(t, client2).Data)
+	assert.Equal(t, "from broker 2", receiveEvent(t, client2).Data)
+	assert.Equal(t, "for client 2", receiveEvent(t, client2).Data)
+}
+
+func TestSseBroker_Backplane_PublishError(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	backplane := NewMockBackplane(t)
+	backplane.EXPECT().Subscribe(mock.Anything).Return(make(chan BackplaneMessage))
+	backplane.EXPECT().Publish(mock.Anything, BackplaneMessage{Event: Event{Data: "lost"}}).Return(errors.New("connection refused"))
+
+	broker := NewBroker(SseBrokerConfig{CancelContext: ctx, Backplane: backplane})
+	go broker.Listen()
+
+	client := newTestClient("1")
+	broker.newClients <- client
+
+	broker.Publish(Event{Data: "lost"})
+
+	select {
+	case event := <-client.events:
+		t.Fatalf("events should only be delivered from the backplane, got %v", event)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestPostgresBackplane_Publish_TooLarge(t *testing.T) {
+	backplane := &PostgresBackplane{channel: "sse_events"}
+
+	err := backplane.Publish(t.Context(), BackplaneMessage{Event: Event{Data: strings.Repeat("a", 8000)}})
+	assert.ErrorIs(t, err, ErrMessageTooLarge)
+}
+
+func TestSseBroker_Backplane_ReplayOnAnotherInstance(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	backplane := NewMemoryBackplane()
+
+	broker1 := NewBroker(SseBrokerConfig{CancelContext: ctx, Backplane: backplane, HistorySize: 10})
+	broker2 := NewBroker(SseBrokerConfig{CancelContext: ctx, Backplane: backplane, HistorySize: 10})
+
+	go broker1.Listen()
+	go broker2.Listen()
+
+	client := newTestClient("1")
+	other := newTestClient("2")
+	broker1.newClients <- client
+	broker2.newClients <- other
+
+	broker1.Publish(Event{Data: "seen"})
+	broker2.Publish(Event{Data: "missed 1"})
+	broker1.Publish(Event{Data: "missed 2"})
+
+	seen := receiveEvent(t, client)
+	assert.Equal(t, "seen", seen.Data)
+	assert.NotEmpty(t, seen.ID)
+	receiveEvent(t, client)
+	receiveEvent(t, client)
+
+	for range 3 {
+		receiveEvent(t, other)
+	}
+
+	/*
+	 * The client reconnects to the other instance, which must know the
+	 * event by the same ID.
+	 */
+	reconnected := newClient("1", seen.ID, 10, nil)
+	broker2.newClients <- reconnected
+	<-reconnected.ready
+
+	replayed := []string{}
+
+	for _, event := range reconnected.replay {
+		replayed = append(replayed, event.Data)
+	}
+
+	assert.Equal(t, []string{"missed 1", "missed 2"}, replayed)
+}
@@ -0,0 +1,93 @@
+package sse
+
+import (
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+/*
+SlowClientPolicy decides what happens to an event when a client's buffer
+is full because it isn't reading events as fast as they are published.
+*/
+type SlowClientPolicy int
+
+const (
+	// DropNewest drops the event. This is the default.
+	DropNewest SlowClientPolicy = iota
+
+	// DropOldest drops the oldest event in the buffer to make room.
+	DropOldest
+
+	// DisconnectClient closes the client's connection. The browser will
+	// reconnect, and can catch up from the history, if it is kept.
+	DisconnectClient
+)
+
+/*
+ClientStats reports on a connected client. Queued is the number of
+events waiting in its buffer.
+*/
+type ClientStats struct {
+	ConnectedAt time.Time
+	Dropped     uint64
+	ID          string
+	Queued      int
+	Sent        uint64
+	Topics      []string
+}
+
+/*
+client is a single connection. Its ID and topics are set when it
+connects, and don't change. When the broker registers the client, it
+fills in the events to replay, then closes ready. If the client is
+disconnected for being too slow, the broker closes kicked.
+*/
+type client struct {
+	connectedAt time.Time
+	dropped     atomic.Uint64
+	events      chan Event
+	id          string
+	kicked      chan struct{}
+	lastEventID string
+	ready       chan struct{}
+	replay      []Event
+	sent        atomic.Uint64
+	topics      map[string]struct{}
+}
+
+func newClient(id, lastEventID string, bufferSize int, topics []string) *client {
+	result := &client{
+		connectedAt: time.Now(),
+		events:      make(chan Event, bufferSize),
+		id:          id,
+		kicked:      make(chan struct{}),
+		lastEventID: lastEventID,
+		ready:       make(chan struct{}),
+		topics:      make(map[string]struct{}),
+	}
+
+	for _, topic := range topics {
+		result.topics[topic] = struct{}{}
+	}
+
+	return result
+}
+
+func (c *client) stats() ClientStats {
+	result := ClientStats{
+		ConnectedAt: c.connectedAt,
+		Dropped:     c.dropped.Load(),
+		ID:          c.id,
+		Queued:      len(c.events),
+		Sent:        c.sent.Load(),
+		Topics:      make([]string, 0, len(c.topics)),
+	}
+
+	for topic := range c.topics {
+		result.Topics = append(result.Topics, topic)
+	}
+
+	slices.Sort(result.Topics)
+	return result
+}
@@ -1,7 +1,37 @@
 package sse
 
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+/*
+Event is a server-sent event. Data may span several lines. Retry, if set,
+tells the browser how long to wait before reconnecting when the
+connection drops.
+*/
 type Event struct {
-	Event string `json:"event"`
-	ID    string `json:"id"`
-	Data  string `json:"data"`
+	Event string        `json:"event"`
+	ID    string        `json:"id"`
+	Data  string        `json:"data"`
+	Retry time.Duration `json:"retry"`
+}
+
+/*
+NewJSONEvent creates an event with data marshaled to JSON.
+
+	event, err := sse.NewJSONEvent("order-updated", order)
+*/
+func NewJSONEvent(event string, data any) (Event, error) {
+	var (
+		err error
+		b   []byte
+	)
+
+	if b, err = json.Marshal(data); err != nil {
+		return Event{}, fmt.Errorf("failed to marshal SSE event data: %w", err)
+	}
+
+	return Event{Event: event, Data: string(b)}, nil
 }
@@ -0,0 +1,243 @@
+package sse
+
+import (
+	"cmp"
+	"crypto/rand"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+/*
+eventHistory keeps recently published events for each topic, so clients
+that reconnect with a Last-Event-ID header can be sent what they missed.
+Events published to everyone are kept under the empty topic. It is only
+used from the broker's Listen loop, so it needs no locking.
+*/
+type eventHistory struct {
+	maxAge time.Duration
+	seq    uint64
+	size   int
+	topics map[string]*ring
+}
+
+type historyEntry struct {
+	event       Event
+	publishedAt time.Time
+	seq         uint64
+}
+
+func newEventHistory(size int, maxAge time.Duration) *eventHistory {
+	return &eventHistory{
+		maxAge: maxAge,
+		size:   size,
+		topics: make(map[string]*ring),
+	}
+}
+
+/*
+record adds an event to a topic's history.
+*/
+func (h *eventHistory) record(topic string, event Event, now time.Time) {
+	h.seq++
+
+	r, ok := h.topics[topic]
+
+	if !ok {
+		r = newRing(h.size)
+		h.topics[topic] = r
+	}
+
+	r.add(historyEntry{event: event, publishedAt: now, seq: h.seq})
+}
+
+/*
+since returns the events published after lastEventID, to everyone or to
+one of the topics, oldest first. If lastEventID is no longer in the
+history, but is a generated ID, events published after it are still
+returned. Otherwise there is no way to tell what was missed, and nothing
+is returned.
+*/
+func (h *eventHistory) since(lastEventID string, topics map[string]struct{}, now time.Time) []Event {
+	rings := []*ring{}
+
+	if r, ok := h.topics[""]; ok {
+		rings = append(rings, r)
+	}
+
+	for topic := range topics {
+		if r, ok := h.topics[topic]; ok {
+			rings = append(rings, r)
+		}
+	}
+
+	lastSeq, found := uint64(0), false
+
+	for _, r := range rings {
+		r.each(func(entry historyEntry) {
+			if entry.event.ID == lastEventID {
+				lastSeq, found = entry.seq, true
+			}
+		})
+	}
+
+	include := func(entry historyEntry) bool {
+		return entry.seq > lastSeq
+	}
+
+	if !found {
+		lastPublished, ok := parseEventID(lastEventID)
+
+		if !ok {
+			return nil
+		}
+
+		/*
+		 * Generated IDs sort in the order they were published. Events
+		 * with their own IDs are compared by when they were received.
+		 */
+		include = func(entry historyEntry) bool {
+			if _, ok := parseEventID(entry.event.ID); ok {
+				return entry.event.ID > lastEventID
+			}
+
+			return entry.publishedAt.After(lastPublished)
+		}
+	}
+
+	entries := []historyEntry{}
+
+	for _, r := range rings {
+		r.each(func(entry historyEntry) {
+			if include(entry) && !h.expired(entry, now) {
+				entries = append(entries, entry)
+			}
+		})
+	}
+
+	slices.SortFunc(entries, func(a, b historyEntry) int {
+		return cmp.Compare(a.seq, b.seq)
+	})
+
+	result := make([]Event, 0, len(entries))
+
+	for _, entry := range entries {
+		result = append(result, entry.event)
+	}
+
+	return result
+}
+
+/*
+prune removes expired events, and forgets topics with nothing left.
+*/
+func (h *eventHistory) prune(now time.Time) {
+	for topic, r := range h.topics {
+		for r.count > 0 && h.expired(r.oldest(), now) {
+			r.removeOldest()
+		}
+
+		if r.count == 0 {
+			delete(h.topics, topic)
+		}
+	}
+}
+
+func (h *eventHistory) expired(entry historyEntry, now time.Time) bool {
+	return h.maxAge > 0 && now.Sub(entry.publishedAt) > h.maxAge
+}
+
+/*
+eventIDGenerator creates IDs for events published without one. IDs are
+the publish time in nanoseconds, in hex, followed by a random node ID,
+such as "18a3f2c4b5d6e7f8-KX3ZQ7PA". They sort in the order events were
+published, across every instance sharing a backplane, as long as their
+clocks agree. The ID is assigned once, before the event is shared, so
+every instance records the event with the same ID.
+*/
+type eventIDGenerator struct {
+	last int64
+	lock *sync.Mutex
+	node string
+	now  func() time.Time
+}
+
+func newEventIDGenerator() *eventIDGenerator {
+	return &eventIDGenerator{
+		lock: &sync.Mutex{},
+		node: rand.Text()[:8],
+		now:  time.Now,
+	}
+}
+
+func (g *eventIDGenerator) next() string {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	n := max(g.now().UnixNano(), g.last+1)
+	g.last = n
+
+	return fmt.Sprintf("%016x-%s", n, g.node)
+}
+
+/*
+parseEventID returns the publish time of a generated event ID.
+*/
+func parseEventID(id string) (time.Time, bool) {
+	if len(id) < 18 || id[16] != '-' {
+		return time.Time{}, false
+	}
+
+	n, err := strconv.ParseInt(id[:16], 16, 64)
+
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(0, n), true
+}
+
+/*
+ring is a fixed size buffer of history entries. Once full, adding an
+entry overwrites the oldest.
+*/
+type ring struct {
+	count   int
+	entries []historyEntry
+	start   int
+}
+
+func newRing(size int) *ring {
+	return &ring{
+		entries: make([]historyEntry, size),
+	}
+}
+
+func (r *ring) add(entry historyEntry) {
+	r.entries[(r.start+r.count)%len(r.entries)] = entry
+
+	if r.count < len(r.entries) {
+		r.count++
+		return
+	}
+
+	r.start = (r.start + 1) % len(r.entries)
+}
+
+func (r *ring) each(fn func(entry historyEntry)) {
+	for i := range r.count {
+		fn(r.entries[(r.start+i)%len(r.entries)])
+	}
+}
+
+func (r *ring) oldest() historyEntry {
+	return r.entries[r.start]
+}
+
+func (r *ring) removeOldest() {
+	r.entries[r.start] = historyEntry{}
+	r.start = (r.start + 1) % len(r.entries)
+	r.count--
+}
@@ -0,0 +1,145 @@
+package sse
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventHistory_record(t *testing.T) {
+	now := time.Now()
+	history := newEventHistory(2, 0)
+
+	history.record("news", Event{ID: "1", Data: "a"}, now)
+	history.record("news", Event{ID: "2", Data: "b"}, now)
+	history.record("news", Event{ID: "3", Data: "c"}, now)
+
+	events := []string{}
+
+	history.topics["news"].each(func(entry historyEntry) {
+		events = append(events, entry.event.Data)
+	})
+
+	assert.Equal(t, []string{"b", "c"}, events, "the oldest event should be overwritten")
+}
+
+func TestEventHistory_since(t *testing.T) {
+	now := time.Now()
+	history := newEventHistory(10, time.Minute)
+	ids := newEventIDGenerator()
+
+	idAt := func(published time.Time) string {
+		ids.now = func() time.Time { return published }
+		return ids.next()
+	}
+
+	beforeHistory := idAt(now.Add(-3 * time.Minute))
+	sportsID := idAt(now.Add(-2 * time.Second))
+
+	history.record("", Event{ID: idAt(now.Add(-2 * time.Minute)), Data: "everyone 1"}, now.Add(-2*time.Minute))
+	history.record("news", Event{ID: "n1", Data: "news 1"}, now.Add(-3*time.Second))
+	history.record("sports", Event{ID: sportsID, Data: "sports 1"}, now.Add(-2*time.Second))
+	history.record("", Event{ID: idAt(now.Add(-time.Second)), Data: "everyone 2"}, now.Add(-time.Second))
+	history.record("news", Event{ID: idAt(now), Data: "news 2"}, now)
+
+	news := map[string]struct{}{"news": {}}
+
+	testCases := []struct {
+		name        string
+		lastEventID string
+		topics      map[string]struct{}
+		expected    []string
+	}{
+		{
+			name:        "After a custom ID",
+			lastEventID: "n1",
+			topics:      news,
+			expected:    []string{"everyone 2", "news 2"},
+		},
+		{
+			name:        "After an ID from another topic",
+			lastEventID: sportsID,
+			topics:      news,
+			expected:    []string{"everyone 2", "news 2"},
+		},
+		{
+			name:        "Expired events are skipped",
+			lastEventID: beforeHistory,
+			topics:      news,
+			expected:    []string{"news 1", "everyone 2", "news 2"},
+		},
+		{
+			name:        "Without topics",
+			lastEventID: beforeHistory,
+			topics:      map[string]struct{}{},
+			expected:    []string{"everyone 2"},
+		},
+		{
+			name:        "Unknown ID",
+			lastEventID: "unknown",
+			topics:      news,
+			expected:    []string{},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			events := []string{}
+
+			for _, event := range history.since(tc.lastEventID, tc.topics, now) {
+				events = append(events, event.Data)
+			}
+
+			assert.Equal(t, tc.expected, events)
+		})
+	}
+}
+
+func TestEventHistory_prune(t *testing.T) {
+	now := time.Now()
+	history := newEventHistory(10, time.Minute)
+
+	history.record("old", Event{Data: "a"}, now.Add(-2*time.Minute))
+	history.record("news", Event{Data: "b"}, now.Add(-2*time.Minute))
+	history.record("news", Event{Data: "c"}, now)
+
+	history.prune(now)
+
+	assert.NotContains(t, history.topics, "old", "topics with nothing left should be removed")
+	assert.Equal(t, 1, history.topics["news"].count)
+	assert.Equal(t, "c", history.topics["news"].oldest().event.Data)
+}
+
+func TestEventIDGenerator(t *testing.T) {
+	now := time.Now()
+	ids := newTestEventIDGenerator(now)
+
+	first := ids.next()
+	second := ids.next()
+
+	assert.Less(t, first, second, "IDs should sort in the order they were generated, even within the same nanosecond")
+
+	published, ok := parseEventID(first)
+	assert.True(t, ok)
+	assert.Equal(t, now.UnixNano(), published.UnixNano())
+
+	_, ok = parseEventID("42")
+	assert.False(t, ok)
+}
+
+/*
+newTestEventIDGenerator returns a generator whose clock starts at start,
+and moves forward a second for every ID.
+*/
+func newTestEventIDGenerator(start time.Time) *eventIDGenerator {
+	ids := newEventIDGenerator()
+	now := start.Add(-time.Second)
+
+	ids.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+
+	return ids
+}
@@ -110,6 +110,98 @@ func (_c *MockBroker_Publish_Call) RunAndReturn(run func(event Event)) *MockBrok
 	return _c
 }
 
+// PublishTo provides a mock function for the type MockBroker
+func (_mock *MockBroker) PublishTo(topic string, event Event) {
+	_mock.Called(topic, event)
+	return
+}
+
+// MockBroker_PublishTo_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'PublishTo'
+type MockBroker_PublishTo_Call struct {
+	*mock.Call
+}
+
+// PublishTo is a helper method to define mock.On call
+//   - topic string
+//   - event Event
+func (_e *MockBroker_Expecter) PublishTo(topic interface{}, event interface{}) *MockBroker_PublishTo_Call {
+	return &MockBroker_PublishTo_Call{Call: _e.mock.On("PublishTo", topic, event)}
+}
+
+func (_c *MockBroker_PublishTo_Call) Run(run func(topic string, event Event)) *MockBroker_PublishTo_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 string
+		if args[0] != nil {
+			arg0 = args[0].(string)
+		}
+		var arg1 Event
+		if args[1] != nil {
+			arg1 = args[1].(Event)
+		}
+		run(
+			arg0,
+			arg1,
+		)
+	})
+	return _c
+}
+
+func (_c *MockBroker_PublishTo_Call) Return() *MockBroker_PublishTo_Call {
+	_c.Call.Return()
+	return _c
+}
+
+func (_c *MockBroker_PublishTo_Call) RunAndReturn(run func(topic string, event Event)) *MockBroker_PublishTo_Call {
+	_c.Run(run)
+	return _c
+}
+
+// PublishToClient provides a mock function for the type MockBroker
+func (_mock *MockBroker) PublishToClient(clientID string, event Event) {
+	_mock.Called(clientID, event)
+	return
+}
+
+// MockBroker_PublishToClient_Call is a *mock.Call that shadows Run/Return methods with type explicit version for method 'PublishToClient'
+type MockBroker_PublishToClient_Call struct {
+	*mock.Call
+}
+
+// PublishToClient is a helper method to define mock.On call
+//   - clientID string
+//   - event Event
+func (_e *MockBroker_Expecter) PublishToClient(clientID interface{}, event interface{}) *MockBroker_PublishToClient_Call {
+	return &MockBroker_PublishToClient_Call{Call: _e.mock.On("PublishToClient", clientID, event)}
+}
+
+func (_c *MockBroker_PublishToClient_Call) Run(run func(clientID string, event Event)) *MockBroker_PublishToClient_Call {
+	_c.Call.Run(func(args mock.Arguments) {
+		var arg0 string
+		if args[0] != nil {
+			arg0 = args[0].(string)
+		}
+		var arg1 Event
+		if args[1] != nil {
+			arg1 = args[1].(Event)
+		}
+		run(
+			arg0,
+			arg1,
+		)
+	})
+	return _c
+}
+
+func (_c *MockBroker_PublishToClient_Call) Return() *MockBroker_PublishToClient_Call {
+	_c.Call.Return()
+	return _c
+}
+
+func (_c *MockBroker_PublishToClient_Call) RunAndReturn(run func(clientID string, event Event)) *MockBroker_PublishToClient_Call {
+	_c.Run(run)
+	return _c
+}
+
 // ServeHTTP provides a mock function for the type MockBroker
 func (_mock *MockBroker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	_mock.Called(w, r)
@@ -0,0 +1,158 @@
+package sse
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrMessageTooLarge = errors.New("message is too large for a postgres notification")
+)
+
+/*
+maxNotifyPayload is the largest payload PostgreSQL allows in a
+notification, less one byte for the terminating null.
+*/
+const maxNotifyPayload = 7999
+
+/*
+postgresDeliverTimeout is how long a notification waits for a broker that
+is behind, before it is dropped. Waiting longer would hold up the
+listener, and every notification after it.
+*/
+const postgresDeliverTimeout = time.Second
+
+/*
+PostgresBackplane is a Backplane that uses PostgreSQL LISTEN/NOTIFY, so
+every app instance connected to the same database receives every event.
+Notifications are limited to about 8KB, so send IDs or small payloads,
+not whole documents.
+*/
+type PostgresBackplane struct {
+	channel  string
+	db       *sql.DB
+	listener *pq.Listener
+	local    *MemoryBackplane
+}
+
+/*
+NewPostgresBackplane connects to PostgreSQL and listens for events on a
+notification channel. Every instance must use the same channel. Call
+Close when the app shuts down.
+
+	backplane, err := sse.NewPostgresBackplane(ctx, os.Getenv("DSN"), "sse_events")
+*/
+func NewPostgresBackplane(ctx context.Context, dsn, channel string) (*PostgresBackplane, error) {
+	var (
+		err error
+		db  *sql.DB
+	)
+
+	if db, err = sql.Open("postgres", dsn); err != nil {
+		return nil, fmt.Errorf("could not open postgres connection for SSE backplane: %w", err)
+	}
+
+	if err = db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("could not connect to postgres for SSE backplane: %w", err)
+	}
+
+	listener := pq.NewListener(dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			slog.Error("SSE backplane postgres listener error", "event", event, "error", err)
+		}
+	})
+
+	if err = listener.Listen(channel); err != nil {
+		listener.Close()
+		db.Close()
+		return nil, fmt.Errorf("could not listen on postgres channel '%s' for SSE backplane: %w", channel, err)
+	}
+
+	result := &PostgresBackplane{
+		channel:  channel,
+		db:       db,
+		listener: listener,
+		local:    NewMemoryBackplane(),
+	}
+
+	go result.receive()
+	return result, nil
+}
+
+/*
+Publish sends a message to every instance with a NOTIFY.
+*/
+func (p *PostgresBackplane) Publish(ctx context.Context, message BackplaneMessage) error {
+	var (
+		err     error
+		payload []byte
+	)
+
+	if payload, err = json.Marshal(message); err != nil {
+		return fmt.Errorf("could not marshal SSE backplane message: %w", err)
+	}
+
+	if len(payload) > maxNotifyPayload {
+		return fmt.Errorf("%w (%d bytes)", ErrMessageTooLarge, len(payload))
+	}
+
+	if _, err = p.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", p.channel, string(payload)); err != nil {
+		return fmt.Errorf("could not publish SSE backplane message: %w", err)
+	}
+
+	return nil
+}
+
+/*
+Subscribe returns a channel of messages published by any instance. The
+subscription ends when ctx is done.
+*/
+func (p *PostgresBackplane) Subscribe(ctx context.Context) <-chan BackplaneMessage {
+	return p.local.Subscribe(ctx)
+}
+
+/*
+Close stops listening and closes the database connections.
+*/
+func (p *PostgresBackplane) Close() error {
+	return errors.Join(p.listener.Close(), p.db.Close())
+}
+
+/*
+receive hands notifications to subscribers until the listener is closed.
+*/
+func (p *PostgresBackplane) receive() {
+	for notification := range p.listener.NotificationChannel() {
+		var message BackplaneMessage
+
+		/*
+		 * A nil notification means the connection was lost and
+		 * re-established. Anything published in between was missed.
+		 */
+		if notification == nil {
+			slog.Warn("SSE backplane reconnected to postgres. events published while disconnected were missed")
+			continue
+		}
+
+		if err := json.Unmarshal([]byte(notification.Extra), &message); err != nil {
+			slog.Error("could not unmarshal SSE backplane message", "error", err)
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), postgresDeliverTimeout)
+
+		if err := p.local.Publish(ctx, message); err != nil {
+			slog.Warn("SSE backplane dropped an event for a broker that is behind", "topic", message.Topic, "error", err)
+		}
+
+		cancel()
+	}
+}
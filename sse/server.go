@@ -2,55 +2,144 @@ package sse
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"slices"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/adampresley/adamgokit/httphelpers"
+	"github.com/adampresley/adamgokit/metrics"
 )
 
 type Broker interface {
 	Listen()
 	Publish(event Event)
+	PublishTo(topic string, event Event)
+	PublishToClient(clientID string, event Event)
 	ServeHTTP(w http.ResponseWriter, r *http.Request)
 }
 
 type Publisher interface {
 	Publish(event Event)
+	PublishTo(topic string, event Event)
+	PublishToClient(clientID string, event Event)
 }
 
+/*
+SseBrokerConfig configures a broker. Topics decides which topics a client
+subscribes to when it connects. ClientID identifies the client for
+PublishToClient, such as by the user ID in its session. Several
+connections, such as browser tabs, may share an ID. If ClientID is nil,
+each connection gets a random ID.
+
+HistorySize is the number of events to keep for each topic, and for
+events published to everyone. Clients that reconnect are sent the events
+they missed. HistoryMaxAge limits how long events are kept. Zero keeps
+them until they are pushed out by newer ones. Events published without an
+ID are given one, which sorts in publish order.
+
+HeartbeatInterval is how long a connection may be idle before a comment
+is sent to keep it open. It defaults to 30 seconds. Set it negative to
+turn heartbeats off.
+
+Backplane shares published events with brokers in other app instances.
+Events sent directly on EventChan are only delivered to this broker's
+clients.
+
+BufferSize is the number of events each client can have waiting to be
+sent. It defaults to 10. SlowClientPolicy decides what happens when a
+client's buffer is full.
+*/
 type SseBrokerConfig struct {
-	AllowedOrigin string
-	CancelContext context.Context
-	EventChan     chan Event
+	AllowedOrigin     string
+	Backplane         Backplane
+	BufferSize        int
+	CancelContext     context.Context
+	ClientID          func(r *http.Request) string
+	EventChan         chan Event
+	HeartbeatInterval time.Duration
+	HistoryMaxAge     time.Duration
+	HistorySize       int
+	SlowClientPolicy  SlowClientPolicy
+	Topics            TopicFunc
 }
 
 type SseBroker struct {
-	allowedOrigin  string
-	cancelContext  context.Context
-	clients        map[chan Event]struct{}
-	closingClients chan chan Event
-	eventChan      chan Event
-	lock           *sync.Mutex
-	newClients     chan chan Event
+	allowedOrigin     string
+	backplane         Backplane
+	bufferSize        int
+	cancelContext     context.Context
+	clientID          func(r *http.Request) string
+	clients           map[*client]struct{}
+	closingClients    chan *client
+	eventChan         chan Event
+	heartbeatInterval time.Duration
+	eventIDs          *eventIDGenerator
+	history           *eventHistory
+	lock              *sync.Mutex
+	messages          chan BackplaneMessage
+	newClients        chan *client
+	slowClientPolicy  SlowClientPolicy
+	topics            TopicFunc
 }
 
 func NewBroker(config SseBrokerConfig) *SseBroker {
 	result := &SseBroker{
-		allowedOrigin:  config.AllowedOrigin,
-		eventChan:      config.EventChan,
-		newClients:     make(chan chan Event),
-		closingClients: make(chan chan Event),
-		clients:        make(map[chan Event]struct{}),
-		cancelContext:  config.CancelContext,
-		lock:           &sync.Mutex{},
+		allowedOrigin:     config.AllowedOrigin,
+		backplane:         config.Backplane,
+		bufferSize:        config.BufferSize,
+		clientID:          config.ClientID,
+		eventChan:         config.EventChan,
+		heartbeatInterval: config.HeartbeatInterval,
+		messages:          make(chan BackplaneMessage, 64),
+		newClients:        make(chan *client),
+		closingClients:    make(chan *client),
+		clients:           make(map[*client]struct{}),
+		cancelContext:     config.CancelContext,
+		lock:              &sync.Mutex{},
+		slowClientPolicy:  config.SlowClientPolicy,
+		topics:            config.Topics,
 	}
 
 	if result.allowedOrigin == "" {
 		result.allowedOrigin = "*"
 	}
 
+	if result.cancelContext == nil {
+		result.cancelContext = context.Background()
+	}
+
+	if result.bufferSize <= 0 {
+		result.bufferSize = 10
+	}
+
+	if result.clientID == nil {
+		result.clientID = func(r *http.Request) string { return rand.Text() }
+	}
+
+	if result.eventChan == nil {
+		result.eventChan = make(chan Event)
+	}
+
+	if result.heartbeatInterval == 0 {
+		result.heartbeatInterval = 30 * time.Second
+	}
+
+	if config.HistorySize > 0 {
+		result.history = newEventHistory(config.HistorySize, config.HistoryMaxAge)
+		result.eventIDs = newEventIDGenerator()
+	}
+
+	if result.topics == nil {
+		result.topics = func(r *http.Request) []string { return nil }
+	}
+
 	return result
 }
 
@@ -62,6 +151,21 @@ func (b *SseBroker) Listen() {
 	slog.Info("SSE broker started")
 	defer slog.Info("SSE broker stopped")
 
+	var prune <-chan time.Time
+
+	if b.history != nil && b.history.maxAge > 0 {
+		ticker := time.NewTicker(b.history.maxAge)
+		defer ticker.Stop()
+
+		prune = ticker.C
+	}
+
+	var remote <-chan BackplaneMessage
+
+	if b.backplane != nil {
+		remote = b.backplane.Subscribe(b.cancelContext)
+	}
+
 	for {
 		select {
 		case <-b.cancelContext.Done():
@@ -70,7 +174,7 @@ func (b *SseBroker) Listen() {
 			b.lock.Lock()
 
 			for client := range b.clients {
-				close(client)
+				close(client.events)
 			}
 
 			b.lock.Unlock()
@@ -78,39 +182,225 @@ func (b *SseBroker) Listen() {
 			return
 
 		case client := <-b.newClients:
+			if b.history != nil && client.lastEventID != "" {
+				client.replay = b.history.since(client.lastEventID, client.topics, time.Now())
+			}
+
 			b.lock.Lock()
 			b.clients[client] = struct{}{}
 			b.lock.Unlock()
 
+			close(client.ready)
+
 			slog.Info("new SSE client connected", "totalClients", len(b.clients))
 
 		case client := <-b.closingClients:
+			/*
+			 * Slow clients that were disconnected have already been
+			 * removed.
+			 */
+			if _, ok := b.clients[client]; !ok {
+				continue
+			}
+
 			b.lock.Lock()
 			delete(b.clients, client)
 			b.lock.Unlock()
 
-			close(client)
+			close(client.events)
 			slog.Info("SSE client disconnected", "totalClients", len(b.clients))
 
 		case event := <-b.eventChan:
-			slog.Info("broker received event, broadcasting to clients", "event", event.Event, "id", event.ID, "clients", len(b.clients))
+			b.deliver(BackplaneMessage{Event: event})
 
-			for client := range b.clients {
-				select {
-				case client <- event:
-				default:
-					slog.Warn("client channel full. dropping event for a client.")
+		case msg := <-b.messages:
+			b.deliver(msg)
+
+		case msg, ok := <-remote:
+			if !ok {
+				if b.cancelContext.Err() == nil {
+					slog.Error("SSE backplane subscription closed. only events sent on the event channel will be delivered")
 				}
+
+				remote = nil
+				continue
 			}
+
+			b.deliver(msg)
+
+		case now := <-prune:
+			b.history.prune(now)
 		}
 	}
 }
 
 /*
-Publish sends an event to all connected clients.
+deliver sends an event to every client the message is addressed to. It
+is only called from Listen, which is the only goroutine that changes the
+client list. Events for everyone or for a topic are added to the history,
+if it is kept.
+*/
+func (b *SseBroker) deliver(msg BackplaneMessage) {
+	event := msg.Event
+
+	if b.history != nil && msg.ClientID == "" {
+		event = b.withEventID(event)
+		b.history.record(msg.Topic, event, time.Now())
+	}
+
+	slog.Debug("broker received event, sending to clients", "event", event.Event, "id", event.ID, "topic", msg.Topic, "clientID", msg.ClientID)
+
+	for client := range b.clients {
+		if msg.Topic != "" {
+			if _, ok := client.topics[msg.Topic]; !ok {
+				continue
+			}
+		}
+
+		if msg.ClientID != "" && client.id != msg.ClientID {
+			continue
+		}
+
+		select {
+		case client.events <- event:
+		default:
+			b.handleSlowClient(client, event)
+		}
+	}
+}
+
+/*
+handleSlowClient applies the slow client policy to a client whose buffer
+is full.
+*/
+func (b *SseBroker) handleSlowClient(client *client, event Event) {
+	switch b.slowClientPolicy {
+	case DropOldest:
+		select {
+		case <-client.events:
+			client.dropped.Add(1)
+		default:
+		}
+
+		select {
+		case client.events <- event:
+		default:
+			client.dropped.Add(1)
+		}
+
+		slog.Debug("client buffer full. dropped oldest event", "clientID", client.id, "event", event.Event, "id", event.ID)
+
+	case DisconnectClient:
+		client.dropped.Add(1)
+
+		b.lock.Lock()
+		delete(b.clients, client)
+		b.lock.Unlock()
+
+		close(client.kicked)
+		slog.Warn("client buffer full. disconnecting slow SSE client", "clientID", client.id, "totalClients", len(b.clients))
+
+	default:
+		client.dropped.Add(1)
+		slog.Debug("client buffer full. dropped event", "clientID", client.id, "event", event.Event, "id", event.ID)
+	}
+}
+
+/*
+ClientCount returns the number of currently connected clients.
+*/
+func (b *SseBroker) ClientCount() int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return len(b.clients)
+}
+
+/*
+Stats returns the events sent, dropped, and waiting for each connected
+client, oldest connection first.
+*/
+func (b *SseBroker) Stats() []ClientStats {
+	b.lock.Lock()
+
+	result := make([]ClientStats, 0, len(b.clients))
+
+	for client := range b.clients {
+		result = append(result, client.stats())
+	}
+
+	b.lock.Unlock()
+
+	slices.SortFunc(result, func(a, b ClientStats) int {
+		return a.ConnectedAt.Compare(b.ConnectedAt)
+	})
+
+	return result
+}
+
+/*
+RegisterMetrics registers an "sse_connected_clients" gauge reporting the
+number of clients connected to this broker.
+*/
+func (b *SseBroker) RegisterMetrics(registry *metrics.Registry) {
+	registry.NewGaugeFunc("sse_connected_clients", "Number of connected SSE clients.", func() float64 {
+		return float64(b.ClientCount())
+	})
+}
+
+/*
+Publish sends an event to all connected clients. Events from Publish,
+PublishTo, and PublishToClient are delivered in the order they were
+published. With a backplane, clients connected to other instances
+receive the event too.
 */
 func (b *SseBroker) Publish(event Event) {
-	b.eventChan <- event
+	b.send(BackplaneMessage{Event: event})
+}
+
+/*
+PublishTo sends an event to the clients subscribed to a topic.
+*/
+func (b *SseBroker) PublishTo(topic string, event Event) {
+	b.send(BackplaneMessage{Event: event, Topic: topic})
+}
+
+/*
+PublishToClient sends an event to the connections with a client ID. See
+SseBrokerConfig.ClientID.
+*/
+func (b *SseBroker) PublishToClient(clientID string, event Event) {
+	b.send(BackplaneMessage{ClientID: clientID, Event: event})
+}
+
+func (b *SseBroker) send(msg BackplaneMessage) {
+	if b.history != nil && msg.ClientID == "" {
+		msg.Event = b.withEventID(msg.Event)
+	}
+
+	if b.backplane != nil {
+		if err := b.backplane.Publish(b.cancelContext, msg); err != nil {
+			slog.Error("failed to publish SSE event to backplane", "event", msg.Event.Event, "error", err)
+		}
+
+		return
+	}
+
+	select {
+	case b.messages <- msg:
+	case <-b.cancelContext.Done():
+	}
+}
+
+/*
+withEventID gives an event without an ID a generated one.
+*/
+func (b *SseBroker) withEventID(event Event) Event {
+	if event.ID == "" {
+		event.ID = b.eventIDs.next()
+	}
+
+	return event
 }
 
 func (b *SseBroker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -126,7 +416,7 @@ func (b *SseBroker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	slog.Info("sse handler: new SSE connection established")
+	slog.Debug("sse handler: new SSE connection established")
 
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("X-Accel-Buffering", "no")
@@ -135,27 +425,31 @@ func (b *SseBroker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", b.allowedOrigin)
 
 	/*
-	 * Create a new channel for this client. Register them, and setup
+	 * Create a new client with its own channel. Register them, and setup
 	 * a a routine to unregister on disconnect. Then send an initial
-	 * greeting.
+	 * greeting, including the client ID, followed by any events missed
+	 * since the client was last connected.
 	 */
-	messageChan := make(chan Event, 10)
-	b.newClients <- messageChan
+	c := newClient(b.clientID(r), r.Header.Get("Last-Event-ID"), b.bufferSize, b.topics(r))
+
+	b.newClients <- c
 
 	defer func() {
 		select {
-		case b.closingClients <- messageChan:
+		case b.closingClients <- c:
 
 		case <-b.cancelContext.Done():
-			slog.Info("sse handler: broker already shutting down, skip client close notification")
+			slog.Debug("sse handler: broker already shutting down, skip client close notification")
 		}
 
-		slog.Info("sse handler: client connection closed")
+		slog.Debug("sse handler: client connection closed")
 	}()
 
+	clientID, _ := json.Marshal(c.id)
+
 	connectionEvent := Event{
 		Event: "connection",
-		Data:  `{"status": "connected"}`,
+		Data:  fmt.Sprintf(`{"status": "connected", "clientID": %s}`, clientID),
 	}
 
 	if err = b.writeEvent(w, connectionEvent); err != nil {
@@ -163,71 +457,126 @@ func (b *SseBroker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	select {
+	case <-c.ready:
+	case <-b.cancelContext.Done():
+		return
+	}
+
+	for _, event := range c.replay {
+		if err = b.writeEvent(w, event); err != nil {
+			slog.Error("sse handler: failed to replay SSE event", "error", err)
+			return
+		}
+
+		c.sent.Add(1)
+	}
+
 	flusher.Flush()
-	slog.Info("sse handler: sent initial SSE connection message")
+	slog.Debug("sse handler: sent initial SSE connection message", "replayed", len(c.replay))
 
 	/*
-	 * Loop and wait for events. Send them to the client.
+	 * Loop and wait for events. Send them to the client. If there are
+	 * none for a while, send a heartbeat.
 	 */
+	var (
+		heartbeat <-chan time.Time
+		ticker    *time.Ticker
+	)
+
+	if b.heartbeatInterval > 0 {
+		ticker = time.NewTicker(b.heartbeatInterval)
+		defer ticker.Stop()
+
+		heartbeat = ticker.C
+	}
+
 	for {
 		select {
+		case <-heartbeat:
+			if err = b.writeHeartbeat(w); err != nil {
+				slog.Error("sse handler: failed to write SSE heartbeat", "error", err)
+				return
+			}
+
+			flusher.Flush()
+
 		case <-b.cancelContext.Done():
-			slog.Info("sse handler: SSE connection closed (in servehttp)")
+			slog.Debug("sse handler: SSE connection closed (in servehttp)")
 			return
 
 		case <-r.Context().Done():
-			slog.Info("sse handler: client disconnected")
+			slog.Debug("sse handler: client disconnected")
 			return
 
-		case event, ok := <-messageChan:
+		case <-c.kicked:
+			slog.Debug("sse handler: slow client disconnected")
+			return
+
+		case event, ok := <-c.events:
 			if !ok {
-				slog.Info("sse handler: client channel closed")
+				slog.Debug("sse handler: client channel closed")
 				return
 			}
 
-			slog.Info("sse handler: received event for client", "event", event.Event, "id", event.ID)
-
 			if err = b.writeEvent(w, event); err != nil {
 				slog.Error("sse handler: failed to write SSE event", "error", err)
 				return
 			}
 
 			flusher.Flush()
-			slog.Info("sse handler: sent event to client", "event", event.Event, "id", event.ID)
+			c.sent.Add(1)
+			slog.Debug("sse handler: sent event to client", "event", event.Event, "id", event.ID)
+
+			if ticker != nil {
+				ticker.Reset(b.heartbeatInterval)
+			}
 		}
 	}
 }
 
+/*
+writeEvent writes an event in the text/event-stream format. Each line of
+the data is written as its own "data:" field, as a newline ends a field.
+*/
 func (b *SseBroker) writeEvent(w http.ResponseWriter, event Event) error {
 	var (
 		err error
-		// bytes []byte
+		sb  strings.Builder
 	)
 
-	// if bytes, err = json.Marshal(event.Data); err != nil {
-	// 	return fmt.Errorf("failed to marshal SSE event: %w", err)
-	// }
-
 	if event.Event != "" {
-		if _, err = fmt.Fprintf(w, "event: %s\n", event.Event); err != nil {
-			return err
-		}
+		fmt.Fprintf(&sb, "event: %s\n", event.Event)
 	}
 
 	if event.ID != "" {
-		if _, err = fmt.Fprintf(w, "id: %s\n", event.ID); err != nil {
-			return err
-		}
+		fmt.Fprintf(&sb, "id: %s\n", event.ID)
+	}
+
+	if event.Retry > 0 {
+		fmt.Fprintf(&sb, "retry: %d\n", event.Retry.Milliseconds())
 	}
 
-	// if len(bytes) > 0 && string(bytes) != "null" {
 	if len(event.Data) > 0 && event.Data != "null" {
-		// if _, err = fmt.Fprintf(w, "data: %s\n", string(bytes)); err != nil {
-		if _, err = fmt.Fprintf(w, "data: %s\n", event.Data); err != nil {
-			return err
+		data := strings.ReplaceAll(event.Data, "\r\n", "\n")
+		data = strings.ReplaceAll(data, "\r", "\n")
+
+		for line := range strings.SplitSeq(data, "\n") {
+			fmt.Fprintf(&sb, "data: %s\n", line)
 		}
 	}
 
-	_, err = fmt.Fprint(w, "\n")
+	sb.WriteString("\n")
+
+	_, err = io.WriteString(w, sb.String())
+	return err
+}
+
+/*
+writeHeartbeat writes a comment, which browsers ignore. Sending something
+now and then stops proxies from closing idle connections.
+*/
+func (b *SseBroker) writeHeartbeat(w http.ResponseWriter) error {
+	_, err := io.WriteString(w, ": heartbeat\n\n")
 	return err
 }
@@ -2,6 +2,7 @@ package sse
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
@@ -76,6 +77,29 @@ func TestSseBroker_writeEvent(t *testing.T) {
 			event:    Event{},
 			expected: "\n",
 		},
+		{
+			name: "Event with multi-line Data",
+			event: Event{
+				Data: "line 1\nline 2\r\nline 3\rline 4",
+			},
+			expected: "data: line 1\ndata: line 2\ndata: line 3\ndata: line 4\n\n",
+		},
+		{
+			name: "Event with trailing newline in Data",
+			event: Event{
+				Data: "line 1\n",
+			},
+			expected: "data: line 1\ndata: \n\n",
+		},
+		{
+			name: "Event with Retry",
+			event: Event{
+				ID:    "1",
+				Data:  "data",
+				Retry: 2500 * time.Millisecond,
+			},
+			expected: "id: 1\nretry: 2500\ndata: data\n\n",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -97,6 +121,7 @@ func TestSseBroker_ServeHTTP(t *testing.T) {
 
 	broker := NewBroker(SseBrokerConfig{
 		CancelContext: ctx,
+		ClientID:      func(r *http.Request) string { return "client-1" },
 		EventChan:     make(chan Event),
 	})
 
@@ -137,7 +162,7 @@ func TestSseBroker_ServeHTTP(t *testing.T) {
 	require.NoError(t, err)
 
 	// Check for the initial connection event
-	expectedInitialEvent := "event: connection\ndata: {\"status\": \"connected\"}\n\n"
+	expectedInitialEvent := "event: connection\ndata: {\"status\": \"connected\", \"clientID\": \"client-1\"}\n\n"
 	assert.True(t, strings.HasPrefix(string(body), expectedInitialEvent), "Response body should start with the connection event")
 }
 
@@ -152,7 +177,7 @@ func TestSseBroker_ClientManagement(t *testing.T) {
 	go broker.Listen()
 
 	// Test client connection
-	clientChan1 := make(chan Event, 1)
+	clientChan1 := newTestClient("1")
 	broker.newClients <- clientChan1
 	time.Sleep(50 * time.Millisecond) // Give broker time to process
 
@@ -161,7 +186,7 @@ func TestSseBroker_ClientManagement(t *testing.T) {
 	broker.lock.Unlock()
 
 	// Test another client connection
-	clientChan2 := make(chan Event, 1)
+	clientChan2 := newTestClient("2")
 	broker.newClients <- clientChan2
 	time.Sleep(50 * time.Millisecond)
 
@@ -181,7 +206,7 @@ func TestSseBroker_ClientManagement(t *testing.T) {
 
 	// Ensure the disconnected channel is closed
 	select {
-	case _, ok := <-clientChan1:
+	case _, ok := <-clientChan1.events:
 		assert.False(t, ok, "Disconnected client channel should be closed")
 	case <-time.After(100 * time.Millisecond):
 		t.Fatal("Channel was not closed after disconnect")
@@ -200,8 +225,8 @@ func TestSseBroker_Broadcast(t *testing.T) {
 	go broker.Listen()
 
 	// Connect two clients
-	client1 := make(chan Event, 1)
-	client2 := make(chan Event, 1)
+	client1 := newTestClient("1")
+	client2 := newTestClient("2")
 	broker.newClients <- client1
 	broker.newClients <- client2
 	time.Sleep(50 * time.Millisecond) // Allow broker to process new clients
@@ -217,7 +242,7 @@ func TestSseBroker_Broadcast(t *testing.T) {
 	go func() {
 		defer wg.Done()
 		select {
-		case received := <-client1:
+		case received := <-client1.events:
 			assert.Equal(t, testEvent, received)
 		case <-time.After(100 * time.Millisecond):
 			t.Error("Client 1 did not receive event in time")
@@ -227,7 +252,7 @@ func TestSseBroker_Broadcast(t *testing.T) {
 	go func() {
 		defer wg.Done()
 		select {
-		case received := <-client2:
+		case received := <-client2.events:
 			assert.Equal(t, testEvent, received)
 		case <-time.After(100 * time.Millisecond):
 			t.Error("Client 2 did not receive event in time")
@@ -258,7 +283,7 @@ func TestSseBroker_RaceTest(t *testing.T) {
 	for i := range numGoroutines {
 		go func(i int) {
 			defer wg.Done()
-			clientChan := make(chan Event, 1)
+			clientChan := newTestClient("")
 			broker.newClients <- clientChan
 			time.Sleep(time.Duration(10+i%10) * time.Millisecond) // Stagger operations
 			broker.closingClients <- clientChan
@@ -285,6 +310,7 @@ func TestSseBroker_ServeHTTP_EventFlow(t *testing.T) {
 
 	broker := NewBroker(SseBrokerConfig{
 		CancelContext: ctx,
+		ClientID:      func(r *http.Request) string { return "client-1" },
 		EventChan:     make(chan Event),
 	})
 	go broker.Listen()
@@ -306,15 +332,15 @@ func TestSseBroker_ServeHTTP_EventFlow(t *testing.T) {
 
 	// Get the client channel from the broker
 	broker.lock.Lock()
-	var clientChan chan Event
-	for ch := range broker.clients {
-		clientChan = ch
+	var clientChan *client
+	for c := range broker.clients {
+		clientChan = c
 	}
 	broker.lock.Unlock()
 	require.NotNil(t, clientChan)
 
 	// Send an event to the client
-	clientChan <- Event{Event: "test-event", Data: "hello world"}
+	clientChan.events <- Event{Event: "test-event", Data: "hello world"}
 
 	// Stop the handler and wait for it to finish
 	cancel()
@@ -324,9 +350,349 @@ func TestSseBroker_ServeHTTP_EventFlow(t *testing.T) {
 	body := w.Body.String()
 
 	expectedEvents := []string{
-		"event: connection\ndata: {\"status\": \"connected\"}\n\n",
+		"event: connection\ndata: {\"status\": \"connected\", \"clientID\": \"client-1\"}\n\n",
 		"event: test-event\ndata: hello world\n\n",
 	}
 
 	assert.Equal(t, strings.Join(expectedEvents, ""), body)
 }
+
+func TestSseBroker_PublishTo(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	broker := NewBroker(SseBrokerConfig{CancelContext: ctx})
+	go broker.Listen()
+
+	news := newTestClient("1", "news")
+	sports := newTestClient("2", "sports")
+	both := newTestClient("3", "news", "sports")
+
+	broker.newClients <- news
+	broker.newClients <- sports
+	broker.newClients <- both
+
+	broker.PublishTo("news", Event{Data: "headline"})
+	broker.Publish(Event{Data: "everyone"})
+
+	assert.Equal(t, "headline", receiveEvent(t, news).Data)
+	assert.Equal(t, "everyone", receiveEvent(t, news).Data)
+	assert.Equal(t, "everyone", receiveEvent(t, sports).Data, "sports should not receive news")
+	assert.Equal(t, "headline", receiveEvent(t, both).Data)
+	assert.Equal(t, "everyone", receiveEvent(t, both).Data)
+}
+
+func TestSseBroker_PublishToClient(t *testing.T) {
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	broker := NewBroker(SseBrokerConfig{CancelContext: ctx})
+	go broker.Listen()
+
+	tab1 := newTestClient("user-1")
+	tab2 := newTestClient("user-1")
+	other := newTestClient("user-2")
+
+	broker.newClients <- tab1
+	broker.newClients <- tab2
+	broker.newClients <- other
+
+	broker.PublishToClient("user-1", Event{Data: "for you"})
+	broker.Publish(Event{Data: "everyone"})
+
+	assert.Equal(t, "for you", receiveEvent(t, tab1).Data)
+	assert.Equal(t, "for you", receiveEvent(t, tab2).Data)
+	assert.Equal(t, "everyone", receiveEvent(t, other).Data, "other clients should not receive the event")
+}
+
+func TestSseBroker_ServeHTTP_Topics(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	broker := NewBroker(SseBrokerConfig{
+		CancelContext: ctx,
+		Topics:        CombineTopics(TopicsFromPathValue("id", "document:"), TopicsFromQuery("topics", "public:")),
+	})
+	go broker.Listen()
+
+	req := httptest.NewRequest("GET", "/documents/42/events?topics=news,sports&topics=weather", nil)
+	req.SetPathValue("id", "42")
+	w := httptest.NewRecorder()
+
+	var wg sync.WaitGroup
+
+	wg.Go(func() {
+		broker.ServeHTTP(w, req)
+	})
+
+	time.Sleep(100 * time.Millisecond)
+
+	broker.lock.Lock()
+	require.Len(t, broker.clients, 1)
+
+	for c := range broker.clients {
+		assert.Len(t, c.id, 26, "client ID should default to a random string")
+		assert.Equal(t, map[string]struct{}{"document:42": {}, "public:news": {}, "public:sports": {}, "public:weather": {}}, c.topics)
+	}
+
+	broker.lock.Unlock()
+
+	broker.PublishTo("document:42", Event{Event: "saved", Data: "42"})
+	broker.PublishTo("document:43", Event{Event: "saved", Data: "43"})
+	time.Sleep(100 * time.Millisecond)
+
+	cancel()
+	wg.Wait()
+
+	body := w.Body.String()
+	assert.Contains(t, body, "event: saved\ndata: 42\n\n")
+	assert.NotContains(t, body, "data: 43")
+}
+
+func TestTopicsFromQuery(t *testing.T) {
+	req := httptest.NewRequest("GET", "/events?topics=a,+b,,c&topics=user:43", nil)
+	assert.Equal(t, []string{"public:a", "public:b", "public:c", "public:user:43"}, TopicsFromQuery("topics", "public:")(req))
+
+	req = httptest.NewRequest("GET", "/events", nil)
+	assert.Empty(t, TopicsFromQuery("topics", "public:")(req))
+
+	assert.Panics(t, func() { TopicsFromQuery("topics", "") })
+}
+
+func TestTopicsFromPathValue(t *testing.T) {
+	req := httptest.NewRequest("GET", "/documents/42/events", nil)
+	assert.Nil(t, TopicsFromPathValue("id", "document:")(req))
+
+	req.SetPathValue("id", "42")
+	assert.Equal(t, []string{"document:42"}, TopicsFromPathValue("id", "document:")(req))
+}
+
+func newTestClient(id string, topics ...string) *client {
+	return newClient(id, "", 10, topics)
+}
+
+func receiveEvent(t *testing.T, c *client) Event {
+	t.Helper()
+
+	select {
+	case event := <-c.events:
+		return event
+	case <-time.After(time.Second):
+		t.Fatal("client did not receive an event in time")
+		return Event{}
+	}
+}
+
+func TestSseBroker_ServeHTTP_Replay(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	broker := NewBroker(SseBrokerConfig{
+		CancelContext: ctx,
+		ClientID:      func(r *http.Request) string { return "client-1" },
+		HistorySize:   10,
+		Topics:        TopicsFromQuery("topics", "public:"),
+	})
+	broker.eventIDs = newTestEventIDGenerator(time.Unix(1, 0))
+	broker.eventIDs.node = "NODE"
+	go broker.Listen()
+
+	broker.Publish(Event{Data: "seen"})
+	broker.Publish(Event{Data: "missed 1"})
+	broker.PublishTo("public:news", Event{Data: "missed 2"})
+	broker.PublishTo("sports", Event{Data: "not subscribed"})
+	time.Sleep(50 * time.Millisecond)
+
+	req := httptest.NewRequest("GET", "/sse?topics=news", nil)
+	req.Header.Set("Last-Event-ID", testEventID(1))
+	w := httptest.NewRecorder()
+
+	var wg sync.WaitGroup
+
+	wg.Go(func() {
+		broker.ServeHTTP(w, req)
+	})
+
+	time.Sleep(100 * time.Millisecond)
+	broker.PublishTo("public:news", Event{Data: "live"})
+	time.Sleep(100 * time.Millisecond)
+
+	cancel()
+	wg.Wait()
+
+	expectedEvents := []string{
+		"event: connection\ndata: {\"status\": \"connected\", \"clientID\": \"client-1\"}\n\n",
+		"id: " + testEventID(2) + "\ndata: missed 1\n\n",
+		"id: " + testEventID(3) + "\ndata: missed 2\n\n",
+		"id: " + testEventID(5) + "\ndata: live\n\n",
+	}
+
+	assert.Equal(t, strings.Join(expectedEvents, ""), w.Body.String())
+}
+
+func TestSseBroker_ServeHTTP_Heartbeat(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	broker := NewBroker(SseBrokerConfig{
+		CancelContext:     ctx,
+		ClientID:          func(r *http.Request) string { return "client-1" },
+		HeartbeatInterval: 50 * time.Millisecond,
+	})
+	go broker.Listen()
+
+	req := httptest.NewRequest("GET", "/sse", nil)
+	w := httptest.NewRecorder()
+
+	var wg sync.WaitGroup
+
+	wg.Go(func() {
+		broker.ServeHTTP(w, req)
+	})
+
+	time.Sleep(80 * time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	expectedEvents := []string{
+		"event: connection\ndata: {\"status\": \"connected\", \"clientID\": \"client-1\"}\n\n",
+		": heartbeat\n\n",
+	}
+
+	assert.Equal(t, strings.Join(expectedEvents, ""), w.Body.String())
+	assert.Equal(t, 30*time.Second, NewBroker(SseBrokerConfig{}).heartbeatInterval, "heartbeats should default to 30 seconds")
+}
+
+func TestNewJSONEvent(t *testing.T) {
+	event, err := NewJSONEvent("order", map[string]any{"id": 42, "status": "shipped"})
+	require.NoError(t, err)
+	assert.Equal(t, Event{Event: "order", Data: `{"id":42,"status":"shipped"}`}, event)
+
+	_, err = NewJSONEvent("order", make(chan int))
+	assert.Error(t, err)
+}
+
+func TestSseBroker_SlowClientPolicy(t *testing.T) {
+	testCases := []struct {
+		name            string
+		policy          SlowClientPolicy
+		expectedEvents  []string
+		expectedDropped uint64
+		expectConnected bool
+		expectKicked    bool
+	}{
+		{
+			name:            "Drop newest",
+			policy:          DropNewest,
+			expectedEvents:  []string{"1", "2"},
+			expectedDropped: 2,
+			expectConnected: true,
+		},
+		{
+			name:            "Drop oldest",
+			policy:          DropOldest,
+			expectedEvents:  []string{"3", "4"},
+			expectedDropped: 2,
+			expectConnected: true,
+		},
+		{
+			name:            "Disconnect",
+			policy:          DisconnectClient,
+			expectedEvents:  []string{"1", "2"},
+			expectedDropped: 1,
+			expectKicked:    true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(t.Context())
+			defer cancel()
+
+			broker := NewBroker(SseBrokerConfig{CancelContext: ctx, SlowClientPolicy: tc.policy})
+			go broker.Listen()
+
+			client := newClient("1", "", 2, nil)
+			broker.newClients <- client
+
+			for _, data := range []string{"1", "2", "3", "4"} {
+				broker.Publish(Event{Data: data})
+			}
+
+			assert.Eventually(t, func() bool {
+				return client.dropped.Load() == tc.expectedDropped
+			}, time.Second, 10*time.Millisecond)
+
+			events := []string{}
+
+			for range len(client.events) {
+				events = append(events, (<-client.events).Data)
+			}
+
+			assert.Equal(t, tc.expectedEvents, events)
+			assert.Equal(t, tc.expectConnected, broker.ClientCount() == 1)
+
+			select {
+			case <-client.kicked:
+				assert.True(t, tc.expectKicked, "client should not have been disconnected")
+			default:
+				assert.False(t, tc.expectKicked, "client should have been disconnected")
+			}
+		})
+	}
+}
+
+func TestSseBroker_Stats(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	broker := NewBroker(SseBrokerConfig{
+		BufferSize:    3,
+		CancelContext: ctx,
+		ClientID:      func(r *http.Request) string { return "client-1" },
+		Topics:        TopicsFromQuery("topics", "public:"),
+	})
+	go broker.Listen()
+
+	req := httptest.NewRequest("GET", "/sse?topics=sports,news", nil)
+	w := httptest.NewRecorder()
+
+	var wg sync.WaitGroup
+
+	wg.Go(func() {
+		broker.ServeHTTP(w, req)
+	})
+
+	time.Sleep(100 * time.Millisecond)
+	broker.Publish(Event{Data: "1"})
+	broker.PublishTo("public:news", Event{Data: "2"})
+
+	assert.Eventually(t, func() bool {
+		stats := broker.Stats()
+		return len(stats) == 1 && stats[0].Sent == 2
+	}, time.Second, 10*time.Millisecond)
+
+	stats := broker.Stats()[0]
+	assert.Equal(t, "client-1", stats.ID)
+	assert.Equal(t, []string{"public:news", "public:sports"}, stats.Topics)
+	assert.Equal(t, uint64(0), stats.Dropped)
+	assert.Equal(t, 0, stats.Queued)
+	assert.False(t, stats.ConnectedAt.IsZero())
+
+	broker.lock.Lock()
+	for c := range broker.clients {
+		assert.Equal(t, 3, cap(c.events), "the buffer size should be configurable")
+	}
+	broker.lock.Unlock()
+
+	cancel()
+	wg.Wait()
+}
+
+/*
+testEventID returns the ID generated by a test event ID generator named
+"NODE", at the given Unix time in seconds.
+*/
+func testEventID(seconds int64) string {
+	return fmt.Sprintf("%016x-NODE", seconds*int64(time.Second))
+}
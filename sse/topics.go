@@ -0,0 +1,81 @@
+package sse
+
+import (
+	"net/http"
+	"strings"
+)
+
+/*
+TopicFunc returns the topics a client subscribes to, based on its request.
+Events published with PublishTo only reach clients subscribed to the topic.
+*/
+type TopicFunc func(r *http.Request) []string
+
+/*
+TopicsFromPathValue subscribes clients to the value of a path wildcard.
+For example, with the route "GET /documents/{id}/events", use
+TopicsFromPathValue("id", "document:") to subscribe to "document:42".
+*/
+func TopicsFromPathValue(name, prefix string) TopicFunc {
+	return func(r *http.Request) []string {
+		value := r.PathValue(name)
+
+		if value == "" {
+			return nil
+		}
+
+		return []string{prefix + value}
+	}
+}
+
+/*
+TopicsFromQuery subscribes clients to the topics named in a query
+parameter. The parameter may be repeated, or hold a comma-separated list.
+Clients choose these topics themselves, so each is given a prefix that
+keeps it apart from topics derived from the session. For example,
+TopicsFromQuery("topics", "public:") subscribes "?topics=news,sports" to
+"public:news" and "public:sports", and "?topics=user:43" to
+"public:user:43". This panics if prefix is empty.
+*/
+func TopicsFromQuery(name, prefix string) TopicFunc {
+	if prefix == "" {
+		panic("TopicsFromQuery needs a prefix, so clients can't subscribe to other topics")
+	}
+
+	return func(r *http.Request) []string {
+		result := []string{}
+
+		for _, value := range r.URL.Query()[name] {
+			for topic := range strings.SplitSeq(value, ",") {
+				if topic = strings.TrimSpace(topic); topic != "" {
+					result = append(result, prefix+topic)
+				}
+			}
+		}
+
+		return result
+	}
+}
+
+/*
+CombineTopics subscribes clients to the topics from every function. Use
+this to mix path or query topics with ones from a callback, such as a
+per-user topic from the session. Give callback topics a prefix that no
+path or query topic uses, so clients can't name them.
+
+	sse.CombineTopics(
+	  sse.TopicsFromPathValue("id", "document:"),
+	  func(r *http.Request) []string { return []string{"user:" + userID(r)} },
+	)
+*/
+func CombineTopics(funcs ...TopicFunc) TopicFunc {
+	return func(r *http.Request) []string {
+		result := []string{}
+
+		for _, fn := range funcs {
+			result = append(result, fn(r)...)
+		}
+
+		return result
+	}
+}
@@ -0,0 +1,458 @@
+package websocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	opContinuation byte = 0x0
+	opText         byte = 0x1
+	opBinary       byte = 0x2
+	opClose        byte = 0x8
+	opPing         byte = 0x9
+	opPong         byte = 0xA
+
+	finBit  byte = 0x80
+	maskBit byte = 0x80
+
+	maxControlPayload = 125
+	writeTimeout      = 10 * time.Second
+	closeTimeout      = 5 * time.Second
+
+	defaultMaxMessageSize = 64 << 10
+)
+
+var (
+	ErrClosed          = errors.New("websocket connection closed")
+	ErrMessageTooLarge = errors.New("websocket message too large")
+	ErrProtocol        = errors.New("websocket protocol error")
+	ErrInvalidUTF8     = errors.New("websocket text message is not valid UTF-8")
+)
+
+/*
+Conn is a server-side websocket connection, returned by Upgrade. One
+goroutine may read messages while others write. Writes are safe to call
+concurrently.
+*/
+type Conn struct {
+	Subprotocol string
+
+	closeOnce      sync.Once
+	closeSent      atomic.Bool
+	closeTimeout   time.Duration
+	conn           net.Conn
+	done           chan struct{}
+	maxMessageSize int64
+	pingInterval   time.Duration
+	reader         *bufio.Reader
+	writeLock      sync.Mutex
+}
+
+func newConn(conn net.Conn, reader *bufio.Reader, config *UpgradeConfig) *Conn {
+	result := &Conn{
+		closeTimeout:   closeTimeout,
+		conn:           conn,
+		done:           make(chan struct{}),
+		maxMessageSize: config.MaxMessageSize,
+		pingInterval:   config.PingInterval,
+		reader:         reader,
+	}
+
+	if result.maxMessageSize <= 0 {
+		result.maxMessageSize = defaultMaxMessageSize
+	}
+
+	if result.pingInterval > 0 {
+		go result.keepAlive()
+	}
+
+	return result
+}
+
+/*
+ReadMessage blocks until a complete message arrives. Fragmented messages
+are reassembled, and pings are answered. When the peer closes the
+connection, the close is acknowledged and a *CloseError is returned.
+Protocol violations and messages larger than the maximum size close the
+connection with the matching status code.
+*/
+func (c *Conn) ReadMessage() (MessageType, []byte, error) {
+	var (
+		messageType byte
+		message     []byte
+		inMessage   bool
+	)
+
+	for {
+		if c.pingInterval > 0 && !c.closeSent.Load() {
+			/*
+			 * Any frame, including the pong replies to our pings,
+			 * proves the peer is still there. Once we have sent a
+			 * close frame, the close timeout applies instead.
+			 */
+			_ = c.conn.SetReadDeadline(time.Now().Add(2 * c.pingInterval))
+		}
+
+		fin, opcode, payload, err := c.readFrame(c.maxMessageSize - int64(len(message)))
+
+		if err != nil {
+			return 0, nil, c.fail(err)
+		}
+
+		switch opcode {
+		case opPing:
+			if err = c.writeFrame(opPong, payload); err != nil {
+				return 0, nil, c.fail(err)
+			}
+
+			continue
+
+		case opPong:
+			continue
+
+		case opClose:
+			return 0, nil, c.handleClose(payload)
+
+		case opText, opBinary:
+			if inMessage {
+				return 0, nil, c.fail(fmt.Errorf("%w: expected a continuation frame", ErrProtocol))
+			}
+
+			inMessage = true
+			messageType = opcode
+			message = payload
+
+		case opContinuation:
+			if !inMessage {
+				return 0, nil, c.fail(fmt.Errorf("%w: unexpected continuation frame", ErrProtocol))
+			}
+
+			message = append(message, payload...)
+
+		default:
+			return 0, nil, c.fail(fmt.Errorf("%w: unknown opcode %d", ErrProtocol, opcode))
+		}
+
+		if !fin {
+			continue
+		}
+
+		if messageType == opText && !utf8.Valid(message) {
+			return 0, nil, c.fail(ErrInvalidUTF8)
+		}
+
+		return MessageType(messageType), message, nil
+	}
+}
+
+/*
+WriteMessage sends a complete message in a single frame.
+*/
+func (c *Conn) WriteMessage(messageType MessageType, data []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return fmt.Errorf("invalid message type %s", messageType)
+	}
+
+	return c.writeFrame(byte(messageType), data)
+}
+
+/*
+WriteText sends a text message.
+*/
+func (c *Conn) WriteText(data string) error {
+	return c.WriteMessage(TextMessage, []byte(data))
+}
+
+/*
+Ping sends a ping. The peer replies with a pong, which ReadMessage
+consumes. Pings are sent automatically when a ping interval is set.
+*/
+func (c *Conn) Ping(data []byte) error {
+	return c.writeFrame(opPing, data)
+}
+
+/*
+WriteClose starts the close handshake by sending a close frame with a
+status code and reason. Reasons longer than 123 bytes are cut short.
+Keep calling ReadMessage until it returns an error: the peer's reply ends
+the connection, or it times out after a few seconds.
+*/
+func (c *Conn) WriteClose(code int, reason string) error {
+	payload := make([]byte, 2, 2+len(reason))
+	binary.BigEndian.PutUint16(payload, uint16(code))
+	payload = append(payload, reason...)
+
+	/*
+	 * The reason must be valid UTF-8, so it is cut before any rune that
+	 * doesn't fit.
+	 */
+	if len(payload) > maxControlPayload {
+		end := maxControlPayload
+
+		for end > 2 && !utf8.RuneStart(payload[end]) {
+			end--
+		}
+
+		payload = payload[:end]
+	}
+
+	if err := c.writeFrame(opClose, payload); err != nil {
+		return err
+	}
+
+	return c.conn.SetReadDeadline(time.Now().Add(c.closeTimeout))
+}
+
+/*
+Close closes the underlying connection immediately, without a close
+handshake. It is safe to call more than once.
+*/
+func (c *Conn) Close() error {
+	var err error
+
+	c.closeOnce.Do(func() {
+		close(c.done)
+		err = c.conn.Close()
+	})
+
+	return err
+}
+
+/*
+Done is closed when the connection is closed.
+*/
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+/*
+handleClose replies to a close frame from the peer and closes the
+connection.
+*/
+func (c *Conn) handleClose(payload []byte) error {
+	result := &CloseError{Code: CloseNoStatusReceived}
+
+	switch {
+	case len(payload) == 1:
+		return c.fail(fmt.Errorf("%w: invalid close frame", ErrProtocol))
+
+	case len(payload) >= 2:
+		result.Code = int(binary.BigEndian.Uint16(payload))
+		result.Reason = string(payload[2:])
+
+		if !utf8.ValidString(result.Reason) {
+			return c.fail(ErrInvalidUTF8)
+		}
+
+		if !validCloseCode(result.Code) {
+			return c.fail(fmt.Errorf("%w: invalid close code %d", ErrProtocol, result.Code))
+		}
+	}
+
+	replyCode := result.Code
+
+	if replyCode == CloseNoStatusReceived {
+		replyCode = CloseNormalClosure
+	}
+
+	_ = c.WriteClose(replyCode, "")
+	_ = c.Close()
+
+	return result
+}
+
+/*
+fail closes the connection after a read error. Protocol errors are
+reported to the peer with a close frame first.
+*/
+func (c *Conn) fail(err error) error {
+	code := 0
+
+	switch {
+	case errors.Is(err, ErrProtocol):
+		code = CloseProtocolError
+
+	case errors.Is(err, ErrInvalidUTF8):
+		code = CloseInvalidPayload
+
+	case errors.Is(err, ErrMessageTooLarge):
+		code = CloseMessageTooBig
+	}
+
+	if code != 0 {
+		_ = c.WriteClose(code, "")
+	}
+
+	_ = c.Close()
+
+	if errors.Is(err, net.ErrClosed) {
+		return ErrClosed
+	}
+
+	return err
+}
+
+/*
+readFrame reads a single frame sent by a client, and unmasks its payload.
+Data frame payloads larger than limit are rejected.
+*/
+func (c *Conn) readFrame(limit int64) (bool, byte, []byte, error) {
+	var (
+		err    error
+		header [2]byte
+		mask   [4]byte
+	)
+
+	if _, err = io.ReadFull(c.reader, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin := header[0]&finBit != 0
+	opcode := header[0] & 0x0F
+	masked := header[1]&maskBit != 0
+	length := int64(header[1] & 0x7F)
+
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, fmt.Errorf("%w: reserved bits set", ErrProtocol)
+	}
+
+	if !masked {
+		return false, 0, nil, fmt.Errorf("%w: client frames must be masked", ErrProtocol)
+	}
+
+	switch length {
+	case 126:
+		var extended [2]byte
+
+		if _, err = io.ReadFull(c.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+
+		length = int64(binary.BigEndian.Uint16(extended[:]))
+
+	case 127:
+		var extended [8]byte
+
+		if _, err = io.ReadFull(c.reader, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+
+		if extended[0]&0x80 != 0 {
+			return false, 0, nil, fmt.Errorf("%w: invalid frame length", ErrProtocol)
+		}
+
+		length = int64(binary.BigEndian.Uint64(extended[:]))
+	}
+
+	if opcode >= opClose {
+		if !fin || length > maxControlPayload {
+			return false, 0, nil, fmt.Errorf("%w: invalid control frame", ErrProtocol)
+		}
+	} else if length > limit {
+		return false, 0, nil, ErrMessageTooLarge
+	}
+
+	if _, err = io.ReadFull(c.reader, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	payload := make([]byte, length)
+
+	if _, err = io.ReadFull(c.reader, payload); err != nil {
+		return false, 0, nil, err
+	}
+
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return fin, opcode, payload, nil
+}
+
+/*
+writeFrame sends a single, unmasked frame. Once a close frame has been
+sent, only the close handshake may continue.
+*/
+func (c *Conn) writeFrame(opcode byte, payload []byte) error {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	if c.closeSent.Load() {
+		return ErrClosed
+	}
+
+	if opcode == opClose {
+		c.closeSent.Store(true)
+	}
+
+	frame := make([]byte, 0, 10+len(payload))
+	frame = append(frame, finBit|opcode)
+
+	switch length := len(payload); {
+	case length <= 125:
+		frame = append(frame, byte(length))
+
+	case length <= 0xFFFF:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(length))
+
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(length))
+	}
+
+	frame = append(frame, payload...)
+
+	_ = c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+/*
+keepAlive pings the peer until the connection is closed.
+*/
+func (c *Conn) keepAlive() {
+	ticker := time.NewTicker(c.pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+
+		case <-ticker.C:
+			if err := c.Ping(nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+/*
+validCloseCode reports whether a peer may send a close code. See RFC
+6455, section 7.4.
+*/
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 3000 && code <= 4999:
+		return true
+
+	case code >= 1000 && code <= 1011:
+		return code != 1004 && code != CloseNoStatusReceived && code != CloseAbnormalClosure
+	}
+
+	return false
+}
@@ -0,0 +1,343 @@
+package websocket
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+/*
+testClient is a minimal websocket client, for testing the server side.
+*/
+type testClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func dial(t *testing.T, serverURL, path string) *testClient {
+	t.Helper()
+
+	address := strings.TrimPrefix(serverURL, "http://")
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { _ = conn.Close() })
+
+	request := "GET " + path + " HTTP/1.1\r\n" +
+		"Host: " + address + "\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n" +
+		"Sec-WebSocket-Version: 13\r\n\r\n"
+
+	_, err = io.WriteString(conn, request)
+	require.NoError(t, err)
+
+	client := &testClient{conn: conn, reader: bufio.NewReader(conn)}
+	resp, err := http.ReadResponse(client.reader, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	require.Equal(t, "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=", resp.Header.Get("Sec-WebSocket-Accept"))
+
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return client
+}
+
+func (c *testClient) writeFrame(t *testing.T, fin bool, opcode byte, payload []byte, masked bool) {
+	t.Helper()
+
+	first := opcode
+
+	if fin {
+		first |= finBit
+	}
+
+	frame := []byte{first}
+	second := byte(0)
+
+	if masked {
+		second = maskBit
+	}
+
+	switch {
+	case len(payload) <= 125:
+		frame = append(frame, second|byte(len(payload)))
+
+	default:
+		frame = append(frame, second|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	}
+
+	if masked {
+		mask := []byte{1, 2, 3, 4}
+		frame = append(frame, mask...)
+
+		for i, b := range payload {
+			frame = append(frame, b^mask[i%4])
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	_, err := c.conn.Write(frame)
+	require.NoError(t, err)
+}
+
+func (c *testClient) readFrame(t *testing.T) (byte, []byte) {
+	t.Helper()
+
+	header := make([]byte, 2)
+	_, err := io.ReadFull(c.reader, header)
+	require.NoError(t, err)
+
+	assert.Zero(t, header[1]&maskBit, "server frames are not masked")
+	length := int(header[1] & 0x7F)
+
+	if length == 126 {
+		extended := make([]byte, 2)
+		_, err = io.ReadFull(c.reader, extended)
+		require.NoError(t, err)
+		length = int(binary.BigEndian.Uint16(extended))
+	}
+
+	payload := make([]byte, length)
+	_, err = io.ReadFull(c.reader, payload)
+	require.NoError(t, err)
+
+	return header[0] & 0x0F, payload
+}
+
+func (c *testClient) expectClose(t *testing.T, code int) {
+	t.Helper()
+
+	opcode, payload := c.readFrame(t)
+	require.Equal(t, opClose, opcode)
+	require.GreaterOrEqual(t, len(payload), 2)
+	assert.Equal(t, code, int(binary.BigEndian.Uint16(payload)))
+}
+
+func closePayload(code int) []byte {
+	return binary.BigEndian.AppendUint16(nil, uint16(code))
+}
+
+func echo(conn *Conn, r *http.Request) {
+	for {
+		messageType, data, err := conn.ReadMessage()
+
+		if err != nil {
+			return
+		}
+
+		_ = conn.WriteMessage(messageType, data)
+	}
+}
+
+func TestUpgrade_BadHandshakes(t *testing.T) {
+	handler := NewHandler(echo)
+
+	valid := func() *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "http://example.com/ws", nil)
+		r.Header.Set("Connection", "keep-alive, Upgrade")
+		r.Header.Set("Upgrade", "websocket")
+		r.Header.Set("Sec-WebSocket-Version", "13")
+		r.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		return r
+	}
+
+	testCases := []struct {
+		name     string
+		modify   func(r *http.Request)
+		expected int
+	}{
+		{name: "Not GET", modify: func(r *http.Request) { r.Method = http.MethodPost }, expected: http.StatusMethodNotAllowed},
+		{name: "Not an upgrade", modify: func(r *http.Request) { r.Header.Del("Upgrade") }, expected: http.StatusUpgradeRequired},
+		{name: "Old version", modify: func(r *http.Request) { r.Header.Set("Sec-WebSocket-Version", "8") }, expected: http.StatusUpgradeRequired},
+		{name: "Invalid key", modify: func(r *http.Request) { r.Header.Set("Sec-WebSocket-Key", "short") }, expected: http.StatusBadRequest},
+		{name: "Cross origin", modify: func(r *http.Request) { r.Header.Set("Origin", "https://evil.example") }, expected: http.StatusForbidden},
+		{name: "Recorders can't be hijacked", modify: func(r *http.Request) { r.Header.Set("Origin", "https://example.com") }, expected: http.StatusInternalServerError},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := valid()
+			tc.modify(r)
+
+			handler.ServeHTTP(w, r)
+			assert.Equal(t, tc.expected, w.Code)
+		})
+	}
+}
+
+func TestConn(t *testing.T) {
+	server := httptest.NewServer(NewHandler(echo, WithMaxMessageSize(300)))
+	defer server.Close()
+
+	t.Run("Fragmented messages are reassembled", func(t *testing.T) {
+		client := dial(t, server.URL, "/")
+
+		client.writeFrame(t, false, opText, []byte("hello "), true)
+		client.writeFrame(t, true, opPing, []byte("in between"), true)
+		client.writeFrame(t, true, opContinuation, []byte("world"), true)
+
+		opcode, payload := client.readFrame(t)
+		assert.Equal(t, opPong, opcode, "pings are answered mid-message")
+		assert.Equal(t, "in between", string(payload))
+
+		opcode, payload = client.readFrame(t)
+		assert.Equal(t, opText, opcode)
+		assert.Equal(t, "hello world", string(payload))
+
+		big := []byte(strings.Repeat("x", 200))
+		client.writeFrame(t, true, opBinary, big, true)
+
+		opcode, payload = client.readFrame(t)
+		assert.Equal(t, opBinary, opcode)
+		assert.Equal(t, big, payload)
+
+		client.writeFrame(t, true, opClose, closePayload(CloseNormalClosure), true)
+		client.expectClose(t, CloseNormalClosure)
+	})
+
+	t.Run("Messages over the size limit close the connection", func(t *testing.T) {
+		client := dial(t, server.URL, "/")
+
+		client.writeFrame(t, false, opText, []byte(strings.Repeat("x", 200)), true)
+		client.writeFrame(t, true, opContinuation, []byte(strings.Repeat("x", 200)), true)
+		client.expectClose(t, CloseMessageTooBig)
+	})
+
+	t.Run("Unmasked frames are a protocol error", func(t *testing.T) {
+		client := dial(t, server.URL, "/")
+
+		client.writeFrame(t, true, opText, []byte("hello"), false)
+		client.expectClose(t, CloseProtocolError)
+	})
+
+	t.Run("Invalid UTF-8 in text messages", func(t *testing.T) {
+		client := dial(t, server.URL, "/")
+
+		client.writeFrame(t, true, opText, []byte{0xff, 0xfe}, true)
+		client.expectClose(t, CloseInvalidPayload)
+	})
+}
+
+func TestConn_PingInterval(t *testing.T) {
+	server := httptest.NewServer(NewHandler(echo, WithPingInterval(20*time.Millisecond)))
+	defer server.Close()
+
+	client := dial(t, server.URL, "/")
+
+	opcode, _ := client.readFrame(t)
+	assert.Equal(t, opPing, opcode)
+
+	/*
+	 * Without a pong, the server gives up after two intervals.
+	 */
+	_ = client.conn.SetReadDeadline(time.Now().Add(time.Second))
+
+	for {
+		_, err := client.reader.ReadByte()
+
+		if err != nil {
+			assert.ErrorIs(t, err, io.EOF)
+			break
+		}
+	}
+}
+
+func TestConn_CloseTimeoutWithPingInterval(t *testing.T) {
+	closed := make(chan time.Duration, 1)
+
+	handler := func(conn *Conn, r *http.Request) {
+		start := time.Now()
+		conn.closeTimeout = 100 * time.Millisecond
+		_ = conn.WriteClose(CloseGoingAway, "")
+
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				closed <- time.Since(start)
+				return
+			}
+		}
+	}
+
+	server := httptest.NewServer(NewHandler(handler, WithPingInterval(time.Minute)))
+	defer server.Close()
+
+	client := dial(t, server.URL, "/")
+	client.expectClose(t, CloseGoingAway)
+
+	/*
+	 * A peer that never replies to the close, but keeps sending pongs,
+	 * must not keep the connection open past the close timeout.
+	 */
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	timeout := time.After(2 * time.Second)
+	pong := []byte{finBit | opPong, maskBit, 1, 2, 3, 4}
+
+	for {
+		select {
+		case elapsed := <-closed:
+			assert.Less(t, elapsed, time.Second)
+			return
+
+		case <-ticker.C:
+			_, _ = client.conn.Write(pong)
+
+		case <-timeout:
+			t.Fatal("the connection stayed open past the close timeout")
+		}
+	}
+}
+
+func TestConn_WriteClose_LongReason(t *testing.T) {
+	handler := func(conn *Conn, r *http.Request) {
+		_ = conn.WriteClose(CloseGoingAway, strings.Repeat("é", 100))
+	}
+
+	server := httptest.NewServer(NewHandler(handler))
+	defer server.Close()
+
+	client := dial(t, server.URL, "/")
+
+	opcode, payload := client.readFrame(t)
+	require.Equal(t, opClose, opcode)
+
+	assert.LessOrEqual(t, len(payload), maxControlPayload)
+	assert.Equal(t, CloseGoingAway, int(binary.BigEndian.Uint16(payload)))
+	assert.True(t, utf8.Valid(payload[2:]), "the reason must not end with part of a character")
+	assert.Equal(t, strings.Repeat("é", 61), string(payload[2:]))
+}
+
+func TestConn_DefaultMaxMessageSize(t *testing.T) {
+	server := httptest.NewServer(NewHandler(echo, WithMaxMessageSize(0)))
+	defer server.Close()
+
+	client := dial(t, server.URL, "/")
+	client.writeFrame(t, true, opText, []byte("hello"), true)
+
+	opcode, payload := client.readFrame(t)
+	assert.Equal(t, opText, opcode)
+	assert.Equal(t, "hello", string(payload))
+}
+
+func TestSelectSubprotocol(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Sec-WebSocket-Protocol", "chat.v1, chat.v2")
+
+	assert.Equal(t, "chat.v2", selectSubprotocol(r, []string{"chat.v2", "chat.v1"}))
+	assert.Equal(t, "", selectSubprotocol(r, []string{"graphql-ws"}))
+}
@@ -0,0 +1,364 @@
+package websocket
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/adampresley/adamgokit/metrics"
+)
+
+type Hub interface {
+	Listen()
+	Publish(message Message)
+	PublishTo(room string, message Message)
+	ServeHTTP(w http.ResponseWriter, r *http.Request)
+}
+
+type Publisher interface {
+	Publish(message Message)
+	PublishTo(room string, message Message)
+}
+
+/*
+MessageHandler is called for each message a client sends. It runs on the
+client's read loop, so messages from one client are handled in order.
+*/
+type MessageHandler func(client *Client, message Message)
+
+type WebsocketHubConfig struct {
+	CancelContext  context.Context
+	OnMessage      MessageHandler
+	Rooms          func(r *http.Request) []string
+	UpgradeOptions []UpgradeOption
+}
+
+type WebsocketHub struct {
+	cancelContext  context.Context
+	clients        map[*Client]struct{}
+	closingClients chan *Client
+	lock           *sync.Mutex
+	messageChan    chan Message
+	newClients     chan *Client
+	nextClientID   atomic.Uint64
+	onMessage      MessageHandler
+	rooms          func(r *http.Request) []string
+	upgradeOptions []UpgradeOption
+}
+
+/*
+NewHub creates a hub that broadcasts messages to connected websocket
+clients. Clients can be placed in rooms, either when they connect using
+the Rooms function, or later with Client.Join. If CancelContext is nil,
+context.Background() is used.
+*/
+func NewHub(config WebsocketHubConfig) *WebsocketHub {
+	result := &WebsocketHub{
+		cancelContext:  config.CancelContext,
+		clients:        make(map[*Client]struct{}),
+		closingClients: make(chan *Client),
+		lock:           &sync.Mutex{},
+		messageChan:    make(chan Message, 64),
+		newClients:     make(chan *Client),
+		onMessage:      config.OnMessage,
+		rooms:          config.Rooms,
+		upgradeOptions: config.UpgradeOptions,
+	}
+
+	if result.cancelContext == nil {
+		result.cancelContext = context.Background()
+	}
+
+	if result.onMessage == nil {
+		result.onMessage = func(client *Client, message Message) {}
+	}
+
+	if result.rooms == nil {
+		result.rooms = func(r *http.Request) []string { return nil }
+	}
+
+	return result
+}
+
+/*
+Listen starts the hub's main loop for managing clients and broadcasting
+messages. This should be run in a separate goroutine after initializing
+the hub. When the cancel context is done, every client is sent a close
+frame with status 1001 (going away).
+*/
+func (h *WebsocketHub) Listen() {
+	slog.Info("websocket hub started")
+	defer slog.Info("websocket hub stopped")
+
+	for {
+		select {
+		case <-h.cancelContext.Done():
+			slog.Info("shutting down websocket hub")
+
+			h.lock.Lock()
+
+			for client := range h.clients {
+				delete(h.clients, client)
+				close(client.send)
+			}
+
+			h.lock.Unlock()
+
+			return
+
+		case client := <-h.newClients:
+			h.lock.Lock()
+			h.clients[client] = struct{}{}
+			h.lock.Unlock()
+
+			slog.Info("new websocket client connected", "clientID", client.id, "totalClients", h.ClientCount())
+
+		case client := <-h.closingClients:
+			h.lock.Lock()
+
+			if _, ok := h.clients[client]; ok {
+				delete(h.clients, client)
+				close(client.send)
+			}
+
+			h.lock.Unlock()
+
+			slog.Info("websocket client disconnected", "clientID", client.id, "totalClients", h.ClientCount())
+
+		case message := <-h.messageChan:
+			h.lock.Lock()
+
+			for client := range h.clients {
+				if message.Room != "" {
+					if _, ok := client.rooms[message.Room]; !ok {
+						continue
+					}
+				}
+
+				client.queue(message)
+			}
+
+			h.lock.Unlock()
+		}
+	}
+}
+
+/*
+ClientCount returns the number of currently connected clients.
+*/
+func (h *WebsocketHub) ClientCount() int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return len(h.clients)
+}
+
+/*
+RegisterMetrics registers a "websocket_connected_clients" gauge reporting
+the number of clients connected to this hub.
+*/
+func (h *WebsocketHub) RegisterMetrics(registry *metrics.Registry) {
+	registry.NewGaugeFunc("websocket_connected_clients", "Number of connected websocket clients.", func() float64 {
+		return float64(h.ClientCount())
+	})
+}
+
+/*
+Publish sends a message to every connected client, or to the clients in
+message.Room if it is set.
+*/
+func (h *WebsocketHub) Publish(message Message) {
+	select {
+	case h.messageChan <- message:
+	case <-h.cancelContext.Done():
+	}
+}
+
+/*
+PublishTo sends a message to the clients in a room.
+*/
+func (h *WebsocketHub) PublishTo(room string, message Message) {
+	message.Room = room
+	h.Publish(message)
+}
+
+/*
+ServeHTTP upgrades the request to a websocket and registers the client
+with the hub until the connection closes. Register it as a mux2.Route
+with Streaming set.
+*/
+func (h *WebsocketHub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := Upgrade(w, r, h.upgradeOptions...)
+
+	if err != nil {
+		slog.Warn("websocket handler: upgrade failed", "error", err)
+		return
+	}
+
+	defer conn.Close()
+
+	client := &Client{
+		Request: r,
+
+		conn:  conn,
+		hub:   h,
+		id:    h.nextClientID.Add(1),
+		rooms: make(map[string]struct{}),
+		send:  make(chan Message, 16),
+	}
+
+	for _, room := range h.rooms(r) {
+		client.rooms[room] = struct{}{}
+	}
+
+	select {
+	case h.newClients <- client:
+	case <-h.cancelContext.Done():
+		_ = conn.WriteClose(CloseGoingAway, "server shutting down")
+		return
+	}
+
+	writerDone := make(chan struct{})
+
+	go func() {
+		defer close(writerDone)
+		client.writeLoop()
+	}()
+
+	client.readLoop()
+
+	select {
+	case h.closingClients <- client:
+	case <-h.cancelContext.Done():
+		slog.Info("websocket handler: hub already shutting down, skip client close notification")
+	}
+
+	_ = conn.Close()
+	<-writerDone
+}
+
+/*
+Client is a websocket connection registered with a Hub.
+*/
+type Client struct {
+	Request *http.Request
+
+	conn  *Conn
+	hub   *WebsocketHub
+	id    uint64
+	rooms map[string]struct{}
+	send  chan Message
+}
+
+/*
+ID returns a number identifying the client, unique within its hub.
+*/
+func (c *Client) ID() uint64 {
+	return c.id
+}
+
+/*
+Join adds the client to a room.
+*/
+func (c *Client) Join(room string) {
+	c.hub.lock.Lock()
+	defer c.hub.lock.Unlock()
+
+	c.rooms[room] = struct{}{}
+}
+
+/*
+Leave removes the client from a room.
+*/
+func (c *Client) Leave(room string) {
+	c.hub.lock.Lock()
+	defer c.hub.lock.Unlock()
+
+	delete(c.rooms, room)
+}
+
+/*
+Rooms returns the rooms the client is in, sorted by name.
+*/
+func (c *Client) Rooms() []string {
+	c.hub.lock.Lock()
+	defer c.hub.lock.Unlock()
+
+	result := make([]string, 0, len(c.rooms))
+
+	for room := range c.rooms {
+		result = append(result, room)
+	}
+
+	slices.Sort(result)
+	return result
+}
+
+/*
+Send queues a message for this client only. If the client's buffer is
+full, the message is dropped.
+*/
+func (c *Client) Send(message Message) {
+	c.hub.lock.Lock()
+	defer c.hub.lock.Unlock()
+
+	if _, ok := c.hub.clients[c]; ok {
+		c.queue(message)
+	}
+}
+
+/*
+queue adds a message to the client's buffer. The hub lock must be held,
+so the channel isn't closed at the same time.
+*/
+func (c *Client) queue(message Message) {
+	select {
+	case c.send <- message:
+	default:
+		slog.Warn("websocket client buffer full. dropping message for a client.", "clientID", c.id)
+	}
+}
+
+func (c *Client) readLoop() {
+	for {
+		messageType, data, err := c.conn.ReadMessage()
+
+		if err != nil {
+			var closeErr *CloseError
+
+			if !errors.As(err, &closeErr) && !errors.Is(err, io.EOF) && !errors.Is(err, ErrClosed) {
+				slog.Info("websocket handler: read failed", "clientID", c.id, "error", err)
+			}
+
+			return
+		}
+
+		c.hub.onMessage(c, Message{Type: messageType, Data: data})
+	}
+}
+
+/*
+writeLoop sends queued messages until the hub closes the client's
+channel. If the hub is shutting down, the client is told it is going
+away.
+*/
+func (c *Client) writeLoop() {
+	for message := range c.send {
+		if message.Type == 0 {
+			message.Type = TextMessage
+		}
+
+		if err := c.conn.WriteMessage(message.Type, message.Data); err != nil {
+			slog.Info("websocket handler: write failed", "clientID", c.id, "error", err)
+			_ = c.conn.Close()
+			break
+		}
+	}
+
+	_ = c.conn.WriteClose(CloseGoingAway, "")
+}
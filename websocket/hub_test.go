@@ -0,0 +1,109 @@
+package websocket
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/adampresley/adamgokit/mux2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebsocketHub(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	hub := NewHub(WebsocketHubConfig{
+		CancelContext: ctx,
+		Rooms: func(r *http.Request) []string {
+			return []string{r.URL.Query().Get("room")}
+		},
+		OnMessage: func(client *Client, message Message) {
+			client.Send(NewTextMessage("you said " + string(message.Data)))
+		},
+	})
+
+	go hub.Listen()
+
+	server := httptest.NewServer(hub)
+	defer server.Close()
+
+	alice := dial(t, server.URL, "/?room=a")
+	bob := dial(t, server.URL, "/?room=b")
+
+	require.Eventually(t, func() bool { return hub.ClientCount() == 2 }, time.Second, 5*time.Millisecond)
+
+	hub.PublishTo("a", NewTextMessage("for room a"))
+	hub.Publish(Message{Data: []byte("for everyone")})
+
+	_, payload := alice.readFrame(t)
+	assert.Equal(t, "for room a", string(payload))
+
+	_, payload = alice.readFrame(t)
+	assert.Equal(t, "for everyone", string(payload))
+
+	opcode, payload := bob.readFrame(t)
+	assert.Equal(t, opText, opcode)
+	assert.Equal(t, "for everyone", string(payload), "bob isn't in room a")
+
+	bob.writeFrame(t, true, opText, []byte("hi"), true)
+	_, payload = bob.readFrame(t)
+	assert.Equal(t, "you said hi", string(payload))
+
+	bob.writeFrame(t, true, opClose, closePayload(CloseNormalClosure), true)
+	bob.expectClose(t, CloseNormalClosure)
+
+	require.Eventually(t, func() bool { return hub.ClientCount() == 1 }, time.Second, 5*time.Millisecond)
+
+	cancel()
+	alice.expectClose(t, CloseGoingAway)
+}
+
+func TestWebsocketHub_Client(t *testing.T) {
+	hub := NewHub(WebsocketHubConfig{})
+	client := &Client{hub: hub, rooms: map[string]struct{}{}}
+
+	client.Join("b")
+	client.Join("a")
+	client.Leave("b")
+
+	assert.Equal(t, []string{"a"}, client.Rooms())
+}
+
+/*
+Upgrades must get through the router's middlewares, which buffer or wrap
+the response writer for ordinary requests.
+*/
+func TestWebsocket_ThroughRouter(t *testing.T) {
+	router := mux2.Setup(
+		mux2.Config{Host: "127.0.0.1:0"},
+		[]mux2.Route{
+			{Path: "GET /ws", Handler: NewHandler(echo)},
+		},
+		nil,
+		nil,
+
+		mux2.WithAccessLog(),
+		mux2.WithRequestTimeout(50*time.Millisecond),
+		mux2.WithMiddlewares(mux2.NewCacheMiddleware()),
+		mux2.UseCompression(),
+	)
+
+	server := httptest.NewServer(router.Server.Handler)
+	defer server.Close()
+
+	client := dial(t, server.URL, "/ws")
+
+	client.writeFrame(t, true, opText, []byte("hello"), true)
+	_, payload := client.readFrame(t)
+	assert.Equal(t, "hello", string(payload))
+
+	time.Sleep(100 * time.Millisecond)
+
+	client.writeFrame(t, true, opText, []byte("still here"), true)
+	_, payload = client.readFrame(t)
+	assert.Equal(t, "still here", string(payload), "the request timeout doesn't apply to upgrades")
+}
@@ -0,0 +1,82 @@
+package websocket
+
+import (
+	"fmt"
+)
+
+type MessageType int
+
+const (
+	TextMessage   MessageType = MessageType(opText)
+	BinaryMessage MessageType = MessageType(opBinary)
+)
+
+func (t MessageType) String() string {
+	switch t {
+	case TextMessage:
+		return "text"
+
+	case BinaryMessage:
+		return "binary"
+	}
+
+	return fmt.Sprintf("MessageType(%d)", int(t))
+}
+
+/*
+Message is a complete websocket message. When published to a Hub, Room
+limits it to the clients in that room, and an unset Type is sent as a
+text message.
+*/
+type Message struct {
+	Type MessageType
+	Data []byte
+	Room string
+}
+
+/*
+NewTextMessage returns a text message.
+*/
+func NewTextMessage(data string) Message {
+	return Message{Type: TextMessage, Data: []byte(data)}
+}
+
+/*
+NewBinaryMessage returns a binary message.
+*/
+func NewBinaryMessage(data []byte) Message {
+	return Message{Type: BinaryMessage, Data: data}
+}
+
+/*
+Close status codes from RFC 6455, section 7.4.1.
+*/
+const (
+	CloseNormalClosure    = 1000
+	CloseGoingAway        = 1001
+	CloseProtocolError    = 1002
+	CloseUnsupportedData  = 1003
+	CloseNoStatusReceived = 1005
+	CloseAbnormalClosure  = 1006
+	CloseInvalidPayload   = 1007
+	ClosePolicyViolation  = 1008
+	CloseMessageTooBig    = 1009
+	CloseInternalError    = 1011
+)
+
+/*
+CloseError is returned by Conn.ReadMessage when the peer closes the
+connection.
+*/
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	if e.Reason == "" {
+		return fmt.Sprintf("websocket closed with code %d", e.Code)
+	}
+
+	return fmt.Sprintf("websocket closed with code %d: %s", e.Code, e.Reason)
+}
@@ -0,0 +1,257 @@
+package websocket
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/adampresley/adamgokit/httphelpers"
+)
+
+const (
+	acceptGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+var (
+	ErrBadHandshake = errors.New("websocket: bad handshake")
+)
+
+type UpgradeConfig struct {
+	CheckOrigin    func(r *http.Request) bool
+	MaxMessageSize int64
+	PingInterval   time.Duration
+	Subprotocols   []string
+}
+
+type UpgradeOption func(*UpgradeConfig)
+
+/*
+WithAllowedOrigins accepts connections from pages on these origins, such
+as "https://example.com". Use "*" to accept any origin. By default only
+pages from the same host may connect.
+*/
+func WithAllowedOrigins(origins ...string) UpgradeOption {
+	return func(config *UpgradeConfig) {
+		config.CheckOrigin = func(r *http.Request) bool {
+			origin := r.Header.Get("Origin")
+			return origin == "" || slices.Contains(origins, "*") || slices.Contains(origins, origin)
+		}
+	}
+}
+
+/*
+WithCheckOrigin sets a function that decides whether to accept a
+connection, based on the request. Use this to check the Origin header in
+ways WithAllowedOrigins can't.
+*/
+func WithCheckOrigin(checkOrigin func(r *http.Request) bool) UpgradeOption {
+	return func(config *UpgradeConfig) {
+		config.CheckOrigin = checkOrigin
+	}
+}
+
+/*
+WithMaxMessageSize sets the largest message, in bytes, a client may send.
+Larger messages close the connection with status 1009. Defaults to 64KB,
+which is also used if maxBytes is zero or less.
+*/
+func WithMaxMessageSize(maxBytes int64) UpgradeOption {
+	return func(config *UpgradeConfig) {
+		config.MaxMessageSize = maxBytes
+	}
+}
+
+/*
+WithPingInterval sets how often the server pings the client. If nothing,
+not even a pong, is received for twice this long, the connection is
+closed. Defaults to 30 seconds. Zero disables pings and read timeouts.
+*/
+func WithPingInterval(interval time.Duration) UpgradeOption {
+	return func(config *UpgradeConfig) {
+		config.PingInterval = interval
+	}
+}
+
+/*
+WithSubprotocols sets the subprotocols the server supports, in order of
+preference. The first one the client also requests is chosen, and is
+available as Conn.Subprotocol.
+*/
+func WithSubprotocols(subprotocols ...string) UpgradeOption {
+	return func(config *UpgradeConfig) {
+		config.Subprotocols = subprotocols
+	}
+}
+
+/*
+Upgrade completes the websocket handshake and takes over the connection.
+If the request isn't a valid handshake, an error response is written and
+ErrBadHandshake is returned. The caller must close the connection when
+done with it.
+
+Websockets need HTTP/1.1. Requests over HTTP/2 fail to upgrade.
+*/
+func Upgrade(w http.ResponseWriter, r *http.Request, options ...UpgradeOption) (*Conn, error) {
+	config := &UpgradeConfig{
+		CheckOrigin:    sameOrigin,
+		MaxMessageSize: defaultMaxMessageSize,
+		PingInterval:   30 * time.Second,
+	}
+
+	for _, opt := range options {
+		opt(config)
+	}
+
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		return nil, handshakeError(w, http.StatusMethodNotAllowed, "websocket handshake must use GET")
+	}
+
+	if !headerContainsToken(r.Header, "Connection", "upgrade") || !headerContainsToken(r.Header, "Upgrade", "websocket") {
+		w.Header().Set("Upgrade", "websocket")
+		return nil, handshakeError(w, http.StatusUpgradeRequired, "websocket upgrade required")
+	}
+
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		return nil, handshakeError(w, http.StatusUpgradeRequired, "unsupported websocket version")
+	}
+
+	key := r.Header.Get("Sec-WebSocket-Key")
+
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		return nil, handshakeError(w, http.StatusBadRequest, "invalid Sec-WebSocket-Key")
+	}
+
+	if !config.CheckOrigin(r) {
+		return nil, handshakeError(w, http.StatusForbidden, "origin not allowed")
+	}
+
+	subprotocol := selectSubprotocol(r, config.Subprotocols)
+
+	netConn, rw, err := http.NewResponseController(w).Hijack()
+
+	if err != nil {
+		slog.Error("websocket upgrade failed. unable to take over the connection", "error", err)
+		httphelpers.WriteText(w, http.StatusInternalServerError, "websocket upgrade failed")
+		return nil, fmt.Errorf("%w: %w", ErrBadHandshake, err)
+	}
+
+	/*
+	 * The server's read and write timeouts apply to the connection we
+	 * just took over. Clear them, as websockets are long-lived.
+	 */
+	_ = netConn.SetDeadline(time.Time{})
+
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n"
+
+	if subprotocol != "" {
+		response += "Sec-WebSocket-Protocol: " + subprotocol + "\r\n"
+	}
+
+	response += "\r\n"
+
+	if _, err = netConn.Write([]byte(response)); err != nil {
+		_ = netConn.Close()
+		return nil, fmt.Errorf("error writing websocket handshake: %w", err)
+	}
+
+	result := newConn(netConn, rw.Reader, config)
+	result.Subprotocol = subprotocol
+
+	return result, nil
+}
+
+/*
+NewHandler returns an http.Handler that upgrades requests and calls
+handler with the connection. The connection is closed when handler
+returns. It can be used as a mux2.Route handler.
+
+	{Path: "GET /ws/echo", Handler: websocket.NewHandler(echo), Streaming: true}
+*/
+func NewHandler(handler func(conn *Conn, r *http.Request), options ...UpgradeOption) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r, options...)
+
+		if err != nil {
+			return
+		}
+
+		defer conn.Close()
+		handler(conn, r)
+	})
+}
+
+func acceptKey(key string) string {
+	hash := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(hash[:])
+}
+
+func handshakeError(w http.ResponseWriter, status int, message string) error {
+	httphelpers.WriteText(w, status, message)
+	return fmt.Errorf("%w: %s", ErrBadHandshake, message)
+}
+
+/*
+headerContainsToken reports whether a comma-separated header contains a
+token, ignoring case.
+*/
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for item := range strings.SplitSeq(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(item), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+/*
+sameOrigin accepts requests without an Origin header, such as from
+non-browser clients, and requests where the Origin host matches the Host.
+*/
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+func selectSubprotocol(r *http.Request, supported []string) string {
+	requested := []string{}
+
+	for _, value := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for item := range strings.SplitSeq(value, ",") {
+			requested = append(requested, strings.TrimSpace(item))
+		}
+	}
+
+	for _, subprotocol := range supported {
+		if slices.Contains(requested, subprotocol) {
+			return subprotocol
+		}
+	}
+
+	return ""
+}